@@ -5,6 +5,7 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/creachadair/twitter/types"
 )
@@ -40,6 +41,9 @@ func ParseParams(args []string, kind string, opt OptionSetter) ([]string, error)
 // arbitrary string. An expansion has the form "+name".
 //
 // If dtype != "", a spec of the form ":value" is treated as "dtype:value".
+//
+// A key may also be given as the URL of a tweet, user, or list, from which
+// the ID or @username is extracted (see KeyFromURL).
 func ParseArgs(args []string, dtype string) ParsedArgs {
 	var parsed ParsedArgs
 	var expand types.Expansions
@@ -55,6 +59,12 @@ func ParseArgs(args []string, dtype string) ParsedArgs {
 			continue
 		}
 
+		// A tweet, user, or list URL is a query key.
+		if key, ok := KeyFromURL(arg); ok {
+			parsed.Keys = append(parsed.Keys, key)
+			continue
+		}
+
 		// name:field is a field spec; everything else is a query key.
 		parts := strings.SplitN(arg, ":", 2)
 		if len(parts) == 1 {
@@ -118,3 +128,14 @@ type miscFields struct {
 
 func (m miscFields) Label() string    { return m.label + ".fields" }
 func (m miscFields) Values() []string { return m.values }
+
+// ParseDate parses a date ("2006-01-02") in local time, or an RFC 3339
+// timestamp. An empty string gives the zero time.
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	} else if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/creachadair/twitter/types"
+)
+
+const (
+	// MaxBatchSize is the largest number of IDs or usernames the API accepts
+	// in a single lookup request.
+	MaxBatchSize = 100
+
+	// maxBatchConcurrency is the largest number of batch requests that will
+	// be active at the same time.
+	maxBatchConcurrency = 4
+)
+
+// Batch splits keys into batches of at most MaxBatchSize and calls f for each
+// batch, with a bounded number of calls active concurrently. The results from
+// all the batches are concatenated in the order of the input keys.
+//
+// If any of the calls fail, Batch returns the results from the batches that
+// succeeded, along with an error that combines all the failures. A call may
+// return results along with an error, for example from ItemErrors, and its
+// results are kept.
+func Batch[S ~[]T, T any](ctx context.Context, keys []string, f func(context.Context, []string) (S, error)) (S, error) {
+	var batches [][]string
+	for len(keys) > MaxBatchSize {
+		batches = append(batches, keys[:MaxBatchSize])
+		keys = keys[MaxBatchSize:]
+	}
+	if len(keys) != 0 {
+		batches = append(batches, keys)
+	}
+
+	results := make([]S, len(batches))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, maxBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		i, batch := i, batch
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			rs, err := f(ctx, batch)
+			results[i] = rs
+			if err == nil {
+				return
+			} else if len(batches) == 1 {
+				errs[i] = err
+			} else {
+				errs[i] = fmt.Errorf("batch %d of %d (%d keys): %w", i+1, len(batches), len(batch), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var out S
+	for _, rs := range results {
+		out = append(out, rs...)
+	}
+	return out, errors.Join(errs...)
+}
+
+// ItemErrors returns an error that combines the errors reported for
+// individual items in an otherwise successful reply, such as keys that were
+// not found, or nil if there are none.
+func ItemErrors(details []*types.ErrorDetail) error {
+	var errs []error
+	for _, d := range details {
+		msg := d.Detail
+		if msg == "" {
+			msg = d.Title
+		}
+		errs = append(errs, fmt.Errorf("%s %q: %s", d.ResourceType, d.Value, msg))
+	}
+	return errors.Join(errs...)
+}
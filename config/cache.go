@@ -0,0 +1,139 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/creachadair/atomicfile"
+)
+
+// DefaultCacheTTL is the default lifetime of a user cache entry.
+const DefaultCacheTTL = 7 * 24 * time.Hour
+
+// A UserCache is a persistent mapping between usernames and user IDs.
+// A nil *UserCache is valid, and behaves as an empty cache that discards
+// all updates.
+type UserCache struct {
+	path    string
+	ttl     time.Duration
+	entries map[string]*CacheEntry // lower-case username → entry
+	dirty   bool
+}
+
+// A CacheEntry records the ID for a single username.
+type CacheEntry struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Updated  time.Time `json:"updated"`
+}
+
+// LoadUserCache loads a user cache from the file at path. If the file does not
+// exist, an empty cache is returned. Entries older than ttl are discarded.
+func LoadUserCache(path string, ttl time.Duration) (*UserCache, error) {
+	uc := &UserCache{path: path, ttl: ttl, entries: make(map[string]*CacheEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return uc, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading user cache: %w", err)
+	}
+	var entries []*CacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("decoding user cache: %w", err)
+	}
+	for _, e := range entries {
+		if uc.live(e) {
+			uc.entries[strings.ToLower(e.Username)] = e
+		} else {
+			uc.dirty = true
+		}
+	}
+	return uc, nil
+}
+
+func (u *UserCache) live(e *CacheEntry) bool { return u.ttl <= 0 || time.Since(e.Updated) < u.ttl }
+
+// LookupName returns the user ID for the given username, if it is cached.
+func (u *UserCache) LookupName(name string) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	e, ok := u.entries[strings.ToLower(name)]
+	if !ok || !u.live(e) {
+		return "", false
+	}
+	return e.ID, true
+}
+
+// LookupID returns the username for the given user ID, if it is cached.
+func (u *UserCache) LookupID(id string) (string, bool) {
+	if u == nil {
+		return "", false
+	}
+	for _, e := range u.entries {
+		if e.ID == id && u.live(e) {
+			return e.Username, true
+		}
+	}
+	return "", false
+}
+
+// Add records that the given username has the specified user ID.
+func (u *UserCache) Add(id, username string) {
+	if u == nil || id == "" || username == "" {
+		return
+	}
+	key := strings.ToLower(username)
+	for name, e := range u.entries {
+		if e.ID == id && name != key {
+			delete(u.entries, name) // the user has changed their username
+		}
+	}
+	u.entries[key] = &CacheEntry{ID: id, Username: username, Updated: time.Now().UTC()}
+	u.dirty = true
+}
+
+// Entries returns the live entries of the cache, ordered by username.
+func (u *UserCache) Entries() []*CacheEntry {
+	if u == nil {
+		return nil
+	}
+	var out []*CacheEntry
+	for _, e := range u.entries {
+		if u.live(e) {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.ToLower(out[i].Username) < strings.ToLower(out[j].Username)
+	})
+	return out
+}
+
+// Save writes the contents of the cache back to its file, if it has changed
+// since it was loaded.
+func (u *UserCache) Save() error {
+	if u == nil || !u.dirty {
+		return nil
+	}
+	data, err := json.Marshal(u.Entries())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(u.path), 0700); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteData(u.path, data, 0600); err != nil {
+		return fmt.Errorf("writing user cache: %w", err)
+	}
+	u.dirty = false
+	return nil
+}
@@ -4,10 +4,13 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/creachadair/atomicfile"
 	"github.com/creachadair/twitter"
@@ -27,11 +30,56 @@ type Config struct {
 
 	Users []*User `yaml:"users,omitempty"`
 
+	// Optional settings for the username cache. If CacheFile is unset, the
+	// default is twig/users.json in the user's cache directory. If CacheTTL
+	// is zero, the default is DefaultCacheTTL.
+	CacheFile string        `yaml:"cache_file,omitempty"`
+	CacheTTL  time.Duration `yaml:"cache_ttl,omitempty"`
+
+	// Optional locations of the queue of scheduled tweets, the directory of
+	// drafts, and the directory of the local archive. If unset, the defaults
+	// are twig/schedule.json, twig/drafts, and twig/archive in the user's
+	// configuration directory.
+	ScheduleFile string `yaml:"schedule_file,omitempty"`
+	DraftDir     string `yaml:"draft_dir,omitempty"`
+	ArchiveDir   string `yaml:"archive_dir,omitempty"`
+
+	// If true, tweets and users returned by the lookup, search, timeline,
+	// and stream commands are saved in the local archive.
+	ArchiveSeen bool `yaml:"archive_seen,omitempty"`
+
+	// Optional settings for the connection to the API. APIBaseURL replaces
+	// the production API URL, for example to use a mock server, and
+	// UploadBaseURL likewise replaces the media upload URL. Proxy is an
+	// http, https, or socks5 URL; if unset, the proxy is chosen from the
+	// environment ($HTTPS_PROXY, $NO_PROXY). CABundle names a file of
+	// PEM-encoded certificates to trust in addition to the system roots.
+	APIBaseURL      string        `yaml:"api_base_url,omitempty"`
+	UploadBaseURL   string        `yaml:"upload_base_url,omitempty"`
+	Proxy           string        `yaml:"proxy,omitempty"`
+	CABundle        string        `yaml:"ca_bundle,omitempty"`
+	UserAgent       string        `yaml:"user_agent,omitempty"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout,omitempty"`
+	ResponseTimeout time.Duration `yaml:"response_timeout,omitempty"`
+
+	// If positive, removing more than this many members from a list at once
+	// requires confirmation.
+	ConfirmRemoveAbove int `yaml:"confirm_remove_above,omitempty"`
+
 	// Non-persistent fields.
-	filePath string
-	AuthUser string                            `yaml:"-"`
-	Log      func(tag jape.LogTag, msg string) `yaml:"-"`
-	LogMask  jape.LogTag                       `yaml:"-"`
+	filePath  string
+	ctx       context.Context
+	cache     *UserCache
+	record    *recordTransport
+	seen      SeenRecorder
+	AuthUser  string                            `yaml:"-"`
+	NoCache   bool                              `yaml:"-"`
+	DryRun    bool                              `yaml:"-"`
+	RecordDir string                            `yaml:"-"` // record API traffic to this directory
+	ReplayDir string                            `yaml:"-"` // replay API traffic from this directory
+	AssumeYes bool                              `yaml:"-"`
+	Log       func(tag jape.LogTag, msg string) `yaml:"-"`
+	LogMask   jape.LogTag                       `yaml:"-"`
 }
 
 // User carries an access token for an individual user.
@@ -54,10 +102,16 @@ func (c *Config) NewBearerClient() (*twitter.Client, error) {
 	if c.BearerToken == "" {
 		return nil, errors.New("no bearer token is available")
 	}
+	hc, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
 	return twitter.NewClient(&jape.Client{
-		Authorize: jape.BearerTokenAuthorizer(c.BearerToken),
-		Log:       c.Log,
-		LogMask:   c.LogMask,
+		HTTPClient: hc,
+		BaseURL:    c.APIBaseURL,
+		Authorize:  jape.BearerTokenAuthorizer(c.BearerToken),
+		Log:        c.Log,
+		LogMask:    c.LogMask,
 	}), nil
 }
 
@@ -69,13 +123,96 @@ func (c *Config) NewUserClient(user string) (*twitter.Client, error) {
 		return nil, fmt.Errorf("no access token found for user %q", user)
 	}
 	cfg := auth.Config{APIKey: c.APIKey, APISecret: c.APISecret}
+	hc, err := c.httpClient()
+	if err != nil {
+		return nil, err
+	}
 	return twitter.NewClient(&jape.Client{
-		Authorize: cfg.Authorizer(u.Token, u.Secret),
-		Log:       c.Log,
-		LogMask:   c.LogMask,
+		HTTPClient: hc,
+		BaseURL:    c.APIBaseURL,
+		Authorize:  cfg.Authorizer(u.Token, u.Secret),
+		Log:        c.Log,
+		LogMask:    c.LogMask,
 	}), nil
 }
 
+// DefaultUploadURL is the base URL of the production media upload API.
+const DefaultUploadURL = "https://upload.twitter.com"
+
+// UploadURL returns the base URL to use for media uploads. If UploadBaseURL
+// is not set but APIBaseURL is, uploads are sent to APIBaseURL.
+func (c *Config) UploadURL() string {
+	if c.UploadBaseURL != "" {
+		return c.UploadBaseURL
+	} else if c.APIBaseURL != "" {
+		return c.APIBaseURL
+	}
+	return DefaultUploadURL
+}
+
+// Context returns the context that governs API calls made with c.
+// If no context has been set, it returns context.Background().
+func (c *Config) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// SetContext sets the context that governs API calls made with c.
+func (c *Config) SetContext(ctx context.Context) { c.ctx = ctx }
+
+// UserCache returns the username cache for c, loading it if necessary.
+// If c.NoCache is true, it returns a nil cache, which is empty.
+func (c *Config) UserCache() (*UserCache, error) {
+	if c.NoCache || c.cache != nil {
+		return c.cache, nil
+	}
+	path, err := c.UserCachePath()
+	if err != nil {
+		return nil, err
+	}
+	ttl := c.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	uc, err := LoadUserCache(path, ttl)
+	if err != nil {
+		return nil, err
+	}
+	c.cache = uc
+	return uc, nil
+}
+
+// UserCachePath returns the path of the username cache file for c. If
+// c.CacheFile is set, it is returned with environment variables expanded.
+// Otherwise, the file is in the twig subdirectory of the user's cache
+// directory.
+func (c *Config) UserCachePath() (string, error) {
+	if c.CacheFile != "" {
+		return os.ExpandEnv(c.CacheFile), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+	return filepath.Join(dir, "twig", "users.json"), nil
+}
+
+// DataPath returns the path of a local data file. If path is set, it is
+// returned with environment variables expanded. Otherwise, the file is name in
+// the twig subdirectory of the user's configuration directory.
+func DataPath(path, name string) (string, error) {
+	if path != "" {
+		return os.ExpandEnv(path), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locating configuration directory: %w", err)
+	}
+	return filepath.Join(dir, "twig", name), nil
+}
+
 // FindUsername returns the access token for the given username, or nil.
 func (c *Config) FindUsername(name string) *User {
 	needle := strings.ToLower(name)
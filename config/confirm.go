@@ -0,0 +1,57 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNotConfirmed is reported when the user declines to confirm an operation.
+var ErrNotConfirmed = errors.New("operation not confirmed")
+
+// Confirm asks the user to confirm a destructive operation described by
+// prompt, and reports nil if the operation should proceed.
+//
+// If c.AssumeYes or c.DryRun is true, Confirm succeeds without asking.
+// Otherwise, if stdin is a terminal, Confirm writes prompt to w and reads an
+// answer from stdin, reporting ErrNotConfirmed unless the answer is yes. If
+// stdin is not a terminal, Confirm reports ErrNotConfirmed, since there is
+// nobody to ask; scripts must set -yes to perform destructive operations.
+func (c *Config) Confirm(w io.Writer, prompt string) error {
+	if !c.NeedConfirm() {
+		return nil
+	} else if !IsTerminal(os.Stdin) {
+		return fmt.Errorf("%w: stdin is not a terminal (use -yes to proceed)", ErrNotConfirmed)
+	}
+	fmt.Fprintf(w, "%s [y/N] ", strings.TrimSpace(prompt))
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return ErrNotConfirmed
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	}
+	return ErrNotConfirmed
+}
+
+// NeedConfirm reports whether Confirm requires the user to confirm. Callers
+// may use this to skip work that is needed only to show the user what they
+// are confirming.
+func (c *Config) NeedConfirm() bool { return !c.AssumeYes && !c.DryRun }
+
+// IsTerminal reports whether f is an interactive device. The null device is a
+// character device too, but nobody can answer a prompt on it.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// isUsername matches strings that have the form of a Twitter username.
+var isUsername = regexp.MustCompile(`^[A-Za-z0-9_]{1,15}$`).MatchString
+
+// ReadKeys expands key arguments that refer to lists of keys stored
+// elsewhere, and returns the resulting keys in order.
+//
+// The argument "-" is replaced by the keys read from stdin.
+// An argument "@file" is replaced by the keys read from the named file,
+// unless file has the form of a username, in which case it is kept as an
+// @username key. To read a file whose name looks like a username, include
+// a directory, for example "@./names".
+//
+// Input files contain one key per line. Blank lines and lines beginning
+// with "#" are ignored. A line beginning with "{" is parsed as a JSON object,
+// and its "id" field is used as the key; this allows the output of another
+// command to be used as input.
+//
+// Keys given as tweet, user, or list URLs are converted by ParseKey.
+func ReadKeys(args []string) ([]string, error) {
+	var keys []string
+	var readStdin bool
+	for _, arg := range args {
+		if arg == "-" {
+			if readStdin {
+				return nil, errors.New("stdin (-) may only be read once")
+			}
+			readStdin = true
+			ks, err := readKeys(os.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("reading keys from stdin: %w", err)
+			}
+			keys = append(keys, ks...)
+		} else if name := strings.TrimPrefix(arg, "@"); name != arg && name != "" && !isUsername(name) {
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			ks, err := readKeys(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("reading keys from %q: %w", name, err)
+			}
+			keys = append(keys, ks...)
+		} else {
+			keys = append(keys, ParseKey(arg))
+		}
+	}
+	return keys, nil
+}
+
+func readKeys(r io.Reader) ([]string, error) {
+	var keys []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20) // JSON objects may be long
+	for ln := 1; sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		} else if !strings.HasPrefix(line, "{") {
+			keys = append(keys, ParseKey(line))
+			continue
+		}
+		var obj struct {
+			ID json.Number `json:"id"` // accepts either "123" or 123
+		}
+		if err := json.Unmarshal([]byte(line), &obj); err != nil {
+			return nil, fmt.Errorf("line %d: %w", ln, err)
+		} else if obj.ID == "" {
+			return nil, fmt.Errorf("line %d: missing id field", ln)
+		}
+		keys = append(keys, obj.ID.String())
+	}
+	return keys, sc.Err()
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Parameters for locking data files.
+const (
+	lockPoll     = 20 * time.Millisecond
+	lockTimeout  = 30 * time.Second
+	lockStaleAge = time.Minute // a lock older than this was abandoned
+)
+
+// LockFile acquires a lock on the data file at path, so that concurrent
+// commands can read, update, and save it without losing each other's
+// changes. It waits for a lock held by another command to be released, and
+// returns a function that releases the lock.
+//
+// The lock is held by creating path with a ".lock" suffix. Locks are meant
+// to be held briefly, so a lock file older than a minute is assumed to have
+// been left by a command that did not exit cleanly, and is removed.
+func LockFile(path string) (unlock func(), err error) {
+	lockPath := path + ".lock"
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintln(f, os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		} else if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("locking %q: %w", path, err)
+		}
+		if fi, err := os.Stat(lockPath); err == nil && time.Since(fi.ModTime()) > lockStaleAge {
+			removeStaleLock(lockPath, fi)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("locking %q: timed out waiting for %q", path, lockPath)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// removeStaleLock removes the stale lock file at lockPath, described by fi.
+// Another command may have removed it already and taken a new lock, so the
+// file is first renamed to a name unique to this process, and put back if it
+// turns out not to be the stale lock.
+func removeStaleLock(lockPath string, fi os.FileInfo) {
+	tmp := fmt.Sprintf("%s.stale.%d", lockPath, os.Getpid())
+	if err := os.Rename(lockPath, tmp); err != nil {
+		return // removed by someone else
+	}
+	if got, err := os.Stat(tmp); err == nil && !os.SameFile(fi, got) {
+		os.Rename(tmp, lockPath) // a new lock, not ours to remove
+		return
+	}
+	os.Remove(tmp)
+}
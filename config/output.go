@@ -5,11 +5,14 @@ package config
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 
 	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/types"
 	"github.com/creachadair/twitter/users"
 )
 
@@ -38,26 +41,85 @@ func PrintJSON(v interface{}) error {
 }
 
 // ResolveID checks a slice of user specifications and attempts to resolve any
-// that begin with "@" with their user ID.
-func ResolveID(ctx context.Context, cli *twitter.Client, specs []string) ([]string, error) {
-	var ids, names []string
-	for _, spec := range specs {
-		if strings.HasPrefix(spec, "@") {
-			names = append(names, strings.TrimPrefix(spec, "@"))
+// that begin with "@" with their user ID. Profile URLs are also accepted (see
+// KeyFromURL). Usernames found in the user cache
+// are resolved without calling the API, and the cache is updated with the
+// results of any usernames that had to be looked up.
+//
+// If some of the lookups fail, or some usernames are not found, ResolveID
+// returns the IDs it was able to resolve, along with an error describing the
+// failures.
+func (c *Config) ResolveID(ctx context.Context, cli *twitter.Client, specs []string) ([]string, error) {
+	cache, err := c.UserCache()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	ids := make([]string, len(specs))
+	specs = append([]string(nil), specs...)
+	for i, spec := range specs {
+		spec = ParseKey(spec)
+		specs[i] = spec
+		if !strings.HasPrefix(spec, "@") {
+			ids[i] = spec
+		} else if id, ok := cache.LookupName(spec[1:]); ok {
+			ids[i] = id
 		} else {
-			ids = append(ids, spec)
+			names = append(names, spec[1:])
 		}
 	}
-	if len(names) != 0 {
+	found, lookupErr := Batch(ctx, names, func(ctx context.Context, names []string) (types.Users, error) {
 		rsp, err := users.LookupByName(names[0], &users.LookupOpts{
 			More: names[1:],
 		}).Invoke(ctx, cli)
 		if err != nil {
 			return nil, err
 		}
-		for _, u := range rsp.Users {
-			ids = append(ids, u.ID)
+		return rsp.Users, ItemErrors(rsp.Errors)
+	})
+	for _, u := range found {
+		cache.Add(u.ID, u.Username)
+	}
+	if err := cache.Save(); err != nil {
+		return nil, err
+	}
+
+	// Fill in the looked-up IDs in their original order. Usernames that could
+	// not be found are omitted.
+	var out []string
+	for i, spec := range specs {
+		id := ids[i]
+		if id == "" && strings.HasPrefix(spec, "@") {
+			id = lookupName(found, spec[1:])
+		}
+		if id != "" {
+			out = append(out, id)
 		}
 	}
-	return ids, nil
+	return out, lookupErr
+}
+
+func lookupName(us types.Users, name string) string {
+	for _, u := range us {
+		if strings.EqualFold(u.Username, name) {
+			return u.ID
+		}
+	}
+	return ""
+}
+
+// Interrupted reports whether err indicates that a command was cancelled or
+// timed out before it finished.
+func Interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Checkpoint writes a note to w explaining how to resume a paginated query
+// that was interrupted by err before fetching the page with the given token.
+// It returns err unmodified.
+func Checkpoint(w io.Writer, err error, pageToken string) error {
+	if Interrupted(err) && pageToken != "" {
+		fmt.Fprintf(w, "Interrupted: to resume, re-run with -page %s\n", pageToken)
+	}
+	return err
 }
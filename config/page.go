@@ -0,0 +1,80 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"flag"
+	"io"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+)
+
+// PageHelp describes the behavior of a command that lists results with
+// Paginate, using the flags set by PageOpts. It is meant to be appended to the
+// help text of the command, after a blank line.
+const PageHelp = `Field specifiers and expansions are accepted as for the lookup command.
+If listing is interrupted, the page token to resume from is printed; pass
+it to -page to continue.`
+
+// PageOpts are the options of a command that lists results with Paginate.
+type PageOpts struct {
+	MaxResults int    // the maximum number of results (0 means all)
+	PageToken  string // the page token to resume from
+}
+
+// SetFlags sets the -max and -page flags of o in fs.
+func (o *PageOpts) SetFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.MaxResults, "max", 0, "Maximum results to return (0 means all)")
+	fs.StringVar(&o.PageToken, "page", "", "Page token to resume listing from")
+}
+
+// PageToken returns the page token that req will request, or "".
+func PageToken(req *jape.Request) string {
+	// Recent search uses a different parameter from the other listings.
+	for _, name := range []string{twitter.NextTokenParam, "next_token"} {
+		if v := req.Params[name]; len(v) != 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// PageSize returns the number of results to request per page for a listing
+// of at most max results (0 means all). The API accepts sizes from min up to
+// 100.
+func PageSize(max, min int) int {
+	if max <= 0 || max > 100 {
+		return 100
+	} else if max < min {
+		return min
+	}
+	return max
+}
+
+// Paginate calls fetch to fetch each page of a query in turn, and prints the
+// results as JSON, until more reports there are no more pages or max results
+// have been printed (0 means all). The req is the request sent by fetch, from
+// which the page token is read. If a page fails, the page token to resume
+// from is written to w, as for Checkpoint.
+func Paginate[T any](w io.Writer, req *jape.Request, max int, more func() bool, fetch func() ([]T, error)) error {
+	var numResults int
+	for more() {
+		page := PageToken(req)
+		vs, err := fetch()
+		if err != nil {
+			return Checkpoint(w, err, page)
+		}
+		numResults += len(vs)
+		if max > 0 && numResults > max {
+			vs = vs[:len(vs)-(numResults-max)]
+		}
+		if err := PrintJSON(vs); err != nil {
+			return err
+		}
+		if max > 0 && numResults >= max {
+			return nil // our work here is finished
+		}
+	}
+	return nil
+}
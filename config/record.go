@@ -0,0 +1,208 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/creachadair/atomicfile"
+)
+
+// redactedHeaders are request headers whose values are not recorded, since
+// they carry credentials.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// An Interaction is a recorded HTTP request and its response. Each
+// interaction is stored as a JSON file in the recording directory, named by
+// its sequence number, for example "0001.json".
+type Interaction struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+	} `json:"request"`
+	Response struct {
+		Status     string      `json:"status"`
+		StatusCode int         `json:"status_code"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+	} `json:"response"`
+}
+
+// key returns the key used to match a request to a recorded interaction.
+// The scheme and host are not included, so that a recording can be replayed
+// against a different API base URL.
+func (in *Interaction) key() string { return in.Request.Method + " " + in.Request.URL }
+
+func requestKey(req *http.Request) string { return req.Method + " " + req.URL.RequestURI() }
+
+// recordTransport sends requests to its base transport, and records each
+// request and response to a file in dir.
+type recordTransport struct {
+	base http.RoundTripper
+	dir  string
+	seq  *atomic.Int64
+}
+
+func newRecordTransport(base http.RoundTripper, dir string) (recordTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return recordTransport{}, fmt.Errorf("creating record directory: %w", err)
+	}
+	// Continue numbering after the last interaction already in the directory,
+	// so that several commands can be recorded in sequence.
+	old, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return recordTransport{}, err
+	}
+	var last int64
+	for _, path := range old {
+		n, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), ".json"), 10, 64)
+		if err == nil && n > last {
+			last = n
+		}
+	}
+	seq := new(atomic.Int64)
+	seq.Store(last)
+	return recordTransport{base: base, dir: dir, seq: seq}, nil
+}
+
+func (r recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var in Interaction
+	in.Request.Method = req.Method
+	in.Request.URL = req.URL.RequestURI()
+	in.Request.Header = req.Header.Clone()
+	for _, h := range redactedHeaders {
+		if in.Request.Header.Get(h) != "" {
+			in.Request.Header.Set(h, "REDACTED")
+		}
+	}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		in.Request.Body = string(body)
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("%04d.json", r.seq.Add(1)))
+
+	rsp, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	in.Response.Status = rsp.Status
+	in.Response.StatusCode = rsp.StatusCode
+	in.Response.Header = rsp.Header.Clone()
+
+	// The response is written when its body is closed, so that streaming
+	// responses are recorded as far as they were read.
+	rsp.Body = &recordBody{ReadCloser: rsp.Body, save: func(body []byte) error {
+		in.Response.Body = string(body)
+		data, err := json.MarshalIndent(in, "", "  ")
+		if err != nil {
+			return err
+		}
+		return atomicfile.WriteData(path, data, 0600)
+	}}
+	return rsp, nil
+}
+
+// recordBody copies the data read from a response body, and saves it when the
+// body is closed.
+type recordBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	save func([]byte) error
+}
+
+func (b *recordBody) Read(data []byte) (int, error) {
+	nr, err := b.ReadCloser.Read(data)
+	b.buf.Write(data[:nr])
+	return nr, err
+}
+
+func (b *recordBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if serr := b.save(b.buf.Bytes()); serr != nil && err == nil {
+			err = fmt.Errorf("recording response: %w", serr)
+		}
+	})
+	return err
+}
+
+// replayTransport serves responses from interactions recorded by a
+// recordTransport, without using the network. A request matches a recorded
+// interaction with the same method, path, and query. Matching interactions
+// are served in the order they were recorded, and the last one is repeated
+// once the others are used up.
+type replayTransport struct {
+	mu    sync.Mutex
+	byKey map[string][]*Interaction
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	} else if len(paths) == 0 {
+		return nil, fmt.Errorf("no recorded interactions found in %q", dir)
+	}
+	sort.Strings(paths)
+	r := &replayTransport{byKey: make(map[string][]*Interaction)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		in := new(Interaction)
+		if err := json.Unmarshal(data, in); err != nil {
+			return nil, fmt.Errorf("reading %q: %w", path, err)
+		}
+		r.byKey[in.key()] = append(r.byKey[in.key()], in)
+	}
+	return r, nil
+}
+
+func (r *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := requestKey(req)
+	r.mu.Lock()
+	ins := r.byKey[key]
+	if len(ins) > 1 {
+		r.byKey[key] = ins[1:]
+	}
+	r.mu.Unlock()
+	if len(ins) == 0 {
+		return nil, fmt.Errorf("replay: no recorded response for %s", key)
+	}
+	in := ins[0]
+	return &http.Response{
+		Status:        in.Response.Status,
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Response.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}, nil
+}
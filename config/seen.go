@@ -0,0 +1,30 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"time"
+
+	"github.com/creachadair/twitter/types"
+)
+
+// ArchivePath returns the path of the directory of the local archive for c.
+func (c *Config) ArchivePath() (string, error) { return DataPath(c.ArchiveDir, "archive") }
+
+// A SeenRecorder records the tweets and users seen in the results of
+// commands. Its methods must be safe for concurrent use.
+type SeenRecorder interface {
+	Add(tweets types.Tweets, users types.Users, now time.Time)
+}
+
+// SetSeenRecorder sets the recorder used by RecordSeen. If r == nil, the
+// tweets and users seen are not recorded.
+func (c *Config) SetSeenRecorder(r SeenRecorder) { c.seen = r }
+
+// RecordSeen passes the given tweets and users to the recorder set by
+// SetSeenRecorder, if any. Otherwise it does nothing.
+func (c *Config) RecordSeen(tweets types.Tweets, users types.Users) {
+	if c.seen != nil && (len(tweets) != 0 || len(users) != 0) {
+		c.seen.Add(tweets, users, time.Now())
+	}
+}
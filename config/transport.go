@@ -0,0 +1,127 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ErrDryRun is reported for a request that was not sent to the API because
+// dry-run mode is enabled.
+var ErrDryRun = errors.New("dry run: request not sent")
+
+// httpClient returns the HTTP client to use for API calls made with c.
+func (c *Config) httpClient() (*http.Client, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	if c.CABundle != "" {
+		pem, err := os.ReadFile(os.ExpandEnv(c.CABundle))
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %q", c.CABundle)
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	if c.ConnectTimeout > 0 {
+		tr.DialContext = (&net.Dialer{
+			Timeout:   c.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		tr.TLSHandshakeTimeout = c.ConnectTimeout
+	}
+	if c.ResponseTimeout > 0 {
+		tr.ResponseHeaderTimeout = c.ResponseTimeout
+	}
+
+	var rt http.RoundTripper = tr
+	if c.UserAgent != "" {
+		rt = userAgentTransport{base: rt, agent: c.UserAgent}
+	}
+	if c.ReplayDir != "" {
+		rp, err := newReplayTransport(c.ReplayDir)
+		if err != nil {
+			return nil, err
+		}
+		rt = rp
+	} else if c.RecordDir != "" {
+		// All the clients made from c share one recorder, so that their
+		// interactions are numbered in a single sequence.
+		if c.record == nil {
+			rec, err := newRecordTransport(rt, c.RecordDir)
+			if err != nil {
+				return nil, err
+			}
+			c.record = &rec
+		}
+		rt = *c.record
+	}
+	if c.DryRun {
+		rt = dryRunTransport{base: rt, w: os.Stdout}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// userAgentTransport sets the User-Agent header on each request.
+type userAgentTransport struct {
+	base  http.RoundTripper
+	agent string
+}
+
+func (u userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", u.agent)
+	return u.base.RoundTrip(req)
+}
+
+// dryRunTransport passes GET requests through to its base transport.  Other
+// requests are printed to w instead of being sent, and fail with ErrDryRun.
+type dryRunTransport struct {
+	base http.RoundTripper
+	w    io.Writer
+}
+
+func (d dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == "" || req.Method == http.MethodGet {
+		return d.base.RoundTrip(req)
+	}
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprintln(d.w, req.Method, req.URL)
+	if len(body) != 0 {
+		fmt.Fprintln(d.w, string(body))
+	}
+	return nil, ErrDryRun
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package config
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// twitterHosts are the hostnames recognized for tweet, user, and list URLs.
+var twitterHosts = map[string]bool{
+	"twitter.com":        true,
+	"www.twitter.com":    true,
+	"mobile.twitter.com": true,
+	"m.twitter.com":      true,
+	"x.com":              true,
+	"www.x.com":          true,
+	"mobile.x.com":       true,
+}
+
+// reservedPaths are top-level paths on the web site that are not usernames.
+var reservedPaths = map[string]bool{
+	"compose": true, "explore": true, "hashtag": true, "home": true,
+	"i": true, "intent": true, "login": true, "logout": true,
+	"messages": true, "notifications": true, "search": true,
+	"settings": true, "share": true, "signup": true, "tos": true,
+	"privacy": true,
+}
+
+var isNumericID = regexp.MustCompile(`^[0-9]+$`).MatchString
+
+// KeyFromURL reports whether s is a Twitter (or X) web URL for a tweet, a
+// user profile, or a list. If so, it returns the corresponding key: the tweet
+// ID, "@username", or the list ID respectively. The scheme may be omitted,
+// and mobile hostnames, query strings, and fragments are accepted.
+//
+// For example:
+//
+//	https://twitter.com/jack/status/20?s=20  → 20
+//	x.com/jack                               → @jack
+//	https://mobile.twitter.com/i/lists/12345 → 12345
+func KeyFromURL(s string) (string, bool) {
+	if !strings.Contains(s, "://") {
+		host, _, _ := strings.Cut(s, "/")
+		if !twitterHosts[strings.ToLower(host)] {
+			return "", false
+		}
+		s = "https://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !twitterHosts[strings.ToLower(u.Host)] {
+		return "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) >= 3 && (parts[1] == "status" || parts[1] == "statuses") && isNumericID(parts[2]):
+		// /username/status/id
+		return parts[2], true
+
+	case len(parts) >= 4 && parts[0] == "i" && parts[1] == "web" && parts[2] == "status" && isNumericID(parts[3]):
+		return parts[3], true
+
+	case len(parts) >= 3 && parts[0] == "i" && parts[1] == "lists" && isNumericID(parts[2]):
+		return parts[2], true
+
+	case len(parts) >= 3 && parts[0] == "i" && parts[1] == "user" && isNumericID(parts[2]):
+		return parts[2], true
+
+	case len(parts) >= 2 && parts[0] == "intent" && (parts[1] == "user" || parts[1] == "follow"):
+		q := u.Query()
+		if name := q.Get("screen_name"); isUsername(name) {
+			return "@" + name, true
+		} else if id := q.Get("user_id"); isNumericID(id) {
+			return id, true
+		}
+
+	case len(parts) >= 1 && isUsername(parts[0]) && !reservedPaths[strings.ToLower(parts[0])]:
+		return "@" + parts[0], true
+	}
+	return "", false
+}
+
+// ParseKey returns the key for s if it is a URL recognized by KeyFromURL;
+// otherwise it returns s unmodified.
+func ParseKey(s string) string {
+	if key, ok := KeyFromURL(s); ok {
+		return key
+	}
+	return s
+}
@@ -6,5 +6,6 @@ require (
 	github.com/creachadair/atomicfile v0.3.0
 	github.com/creachadair/command v0.0.0-20230321183317-e4e984c4ab3c
 	github.com/creachadair/twitter v0.0.0-20230418151642-f25c04a378b6
+	golang.org/x/text v0.14.0
 	gopkg.in/yaml.v3 v3.0.1
 )
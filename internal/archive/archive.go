@@ -0,0 +1,256 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+// Package archive reads the data files of a Twitter account archive.
+//
+// An account archive is a zip file containing a "data" directory of
+// JavaScript files, each of which assigns a JSON array to a global variable:
+//
+//	window.YTD.tweets.part0 = [ { "tweet" : { ... } }, ... ]
+//
+// Large data sets are split into several parts (tweets.js, tweets-part1.js,
+// and so on). An Archive may be opened from the zip file, from a directory
+// where it has been unpacked, or from a single data file.
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Archive provides access to the data files of an account archive.
+type Archive struct {
+	files map[string]func() ([]byte, error) // data file name → contents
+	zf    *zip.ReadCloser                   // if opened from a zip file
+	one   string                            // if opened from a single data file
+}
+
+// Open opens the archive at file, which may be the zip file of an account
+// archive, a directory where it has been unpacked, or a single data file such
+// as tweets.js. The caller must close the archive when it is no longer needed.
+func Open(file string) (*Archive, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{files: make(map[string]func() ([]byte, error))}
+	if fi.IsDir() {
+		dir := file
+		if sub := filepath.Join(file, "data"); isDir(sub) {
+			dir = sub
+		}
+		names, err := filepath.Glob(filepath.Join(dir, "*.js"))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			a.addFile(name)
+		}
+		return a, nil
+	}
+
+	zf, err := zip.OpenReader(file)
+	if errors.Is(err, zip.ErrFormat) {
+		a.addFile(file) // not a zip file, treat it as a single data file
+		a.one = filepath.Base(file)
+		return a, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening archive: %w", err)
+	}
+	a.zf = zf
+	for _, f := range zf.File {
+		f := f
+		dir, base := path.Split(f.Name)
+		if strings.TrimSuffix(dir, "/") != "data" || !strings.HasSuffix(base, ".js") {
+			continue
+		}
+		a.files[base] = func() ([]byte, error) {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	}
+	return a, nil
+}
+
+func (a *Archive) addFile(name string) {
+	a.files[filepath.Base(name)] = func() ([]byte, error) { return os.ReadFile(name) }
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// Close releases the resources held by a.
+func (a *Archive) Close() error {
+	if a.zf != nil {
+		return a.zf.Close()
+	}
+	return nil
+}
+
+// Has reports whether a contains a data set with any of the given names.
+func (a *Archive) Has(names ...string) bool { return len(a.parts(names)) != 0 }
+
+// parts returns the names of the data files for the data set with any of the
+// given names, in order. A single data file is used for any data set.
+func (a *Archive) parts(names []string) []string {
+	if a.one != "" {
+		return []string{a.one}
+	}
+	var out []string
+	for _, name := range names {
+		for file := range a.files {
+			if file == name+".js" || strings.HasPrefix(file, name+"-part") && strings.HasSuffix(file, ".js") {
+				out = append(out, file)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Read decodes the items of the data set with the given names into v, which
+// must be a pointer to a slice. Older archives use different names for some
+// data sets (for example "tweet" rather than "tweets"), so any of the names
+// is accepted. Each item is an object with a single field whose name is key,
+// and the value of that field is decoded as an element of the slice.
+//
+// It is not an error if the data set is missing; Read leaves v unchanged.
+func (a *Archive) Read(key string, v any, names ...string) error {
+	var items []json.RawMessage
+	for _, file := range a.parts(names) {
+		data, err := a.files[file]()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		part, err := decodeFile(data, key)
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", file, err)
+		}
+		items = append(items, part...)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(item)
+	}
+	buf.WriteByte(']')
+	return json.Unmarshal(buf.Bytes(), v)
+}
+
+// decodeFile decodes the items of a data file, and returns the values of the
+// field of each item with the given key.
+func decodeFile(data []byte, key string) ([]json.RawMessage, error) {
+	// Discard the variable assignment before the JSON array.
+	if i := bytes.IndexByte(data, '='); i >= 0 && bytes.HasPrefix(bytes.TrimSpace(data), []byte("window.")) {
+		data = data[i+1:]
+	}
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(bytes.TrimSpace(data), &items); err != nil {
+		return nil, err
+	}
+	out := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		if v, ok := item[key]; ok {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// Tweets returns the tweets in the archive.
+func (a *Archive) Tweets() ([]*Tweet, error) {
+	var out []*Tweet
+	if err := a.Read("tweet", &out, "tweets", "tweet"); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// A Tweet is a tweet recorded in an archive. Its fields follow the v1.1
+// format in which the archive records them.
+type Tweet struct {
+	ID                  string `json:"id_str"`
+	Text                string `json:"full_text"`
+	CreatedAt           Time   `json:"created_at"`
+	Lang                string `json:"lang,omitempty"`
+	Source              string `json:"source,omitempty"`
+	FavoriteCount       Count  `json:"favorite_count"`
+	RetweetCount        Count  `json:"retweet_count"`
+	InReplyToStatusID   string `json:"in_reply_to_status_id_str,omitempty"`
+	InReplyToUserID     string `json:"in_reply_to_user_id_str,omitempty"`
+	InReplyToScreenName string `json:"in_reply_to_screen_name,omitempty"`
+	Retweeted           bool   `json:"retweeted,omitempty"`
+}
+
+// IsRetweet reports whether t is a retweet of another tweet.
+func (t *Tweet) IsRetweet() bool { return t.Retweeted || strings.HasPrefix(t.Text, "RT @") }
+
+// IsReply reports whether t is a reply to another tweet.
+func (t *Tweet) IsReply() bool { return t.InReplyToStatusID != "" }
+
+// TimeFormat is the layout of timestamps in an archive.
+const TimeFormat = "Mon Jan 02 15:04:05 -0700 2006"
+
+// Time is a timestamp encoded in the archive format.
+type Time struct{ time.Time }
+
+// UnmarshalJSON decodes a timestamp in either the archive format or RFC 3339.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	} else if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	for _, layout := range []string{TimeFormat, time.RFC3339} {
+		if ts, err := time.Parse(layout, s); err == nil {
+			t.Time = ts
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", s)
+}
+
+// MarshalJSON encodes a timestamp in RFC 3339 format.
+func (t Time) MarshalJSON() ([]byte, error) { return json.Marshal(t.Time.Format(time.RFC3339)) }
+
+// Count is a count of engagements. The archive records counts as strings.
+type Count int64
+
+// UnmarshalJSON decodes a count from either a string or a number.
+func (c *Count) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*c = 0
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid count %s", data)
+	}
+	*c = Count(v)
+	return nil
+}
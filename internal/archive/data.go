@@ -0,0 +1,204 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package archive
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/creachadair/twitter/types"
+)
+
+// Account describes the account an archive belongs to.
+type Account struct {
+	ID          string `json:"accountId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"accountDisplayName"`
+	CreatedAt   Time   `json:"createdAt"`
+	Bio         string `json:"-"` // from the profile
+}
+
+// Account returns the account the archive belongs to, or nil if the archive
+// does not say.
+func (a *Archive) Account() (*Account, error) {
+	var out []*Account
+	if err := a.Read("account", &out, "account"); err != nil || len(out) == 0 {
+		return nil, err
+	}
+	var profile []struct {
+		Description struct {
+			Bio string `json:"bio"`
+		} `json:"description"`
+	}
+	if err := a.Read("profile", &profile, "profile"); err != nil {
+		return nil, err
+	} else if len(profile) != 0 {
+		out[0].Bio = profile[0].Description.Bio
+	}
+	return out[0], nil
+}
+
+// User converts the account to the format reported by the API.
+func (a *Account) User() *types.User {
+	u := &types.User{ID: a.ID, Username: a.Username, Name: a.DisplayName, Description: a.Bio}
+	if !a.CreatedAt.IsZero() {
+		u.CreatedAt = &a.CreatedAt.Time
+	}
+	return u
+}
+
+// A Like is a tweet liked by the account.
+type Like struct {
+	TweetID string `json:"tweetId"`
+	Text    string `json:"fullText"`
+	URL     string `json:"expandedUrl"`
+}
+
+// Likes returns the tweets liked by the account.
+func (a *Archive) Likes() ([]*Like, error) {
+	var out []*Like
+	if err := a.Read("like", &out, "like"); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Tweet converts the like to the format reported by the API. Only the ID and
+// text of a liked tweet are recorded in the archive.
+func (k *Like) Tweet() *types.Tweet { return &types.Tweet{ID: k.TweetID, Text: k.Text} }
+
+// A Relation is an account related to the archive account, such as a
+// follower. Only the ID of the account is recorded.
+type Relation struct {
+	ID   string `json:"accountId"`
+	Link string `json:"userLink"`
+}
+
+// Followers returns the accounts that follow the account.
+func (a *Archive) Followers() ([]*Relation, error) { return a.relations("follower") }
+
+// Following returns the accounts followed by the account.
+func (a *Archive) Following() ([]*Relation, error) { return a.relations("following") }
+
+func (a *Archive) relations(key string) ([]*Relation, error) {
+	var out []*Relation
+	if err := a.Read(key, &out, key); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// User converts the relation to the format reported by the API.
+func (r *Relation) User() *types.User { return &types.User{ID: r.ID} }
+
+// Kinds of list recorded in an archive.
+const (
+	ListsCreated    = "created"    // lists the account created
+	ListsMember     = "member"     // lists the account is a member of
+	ListsSubscribed = "subscribed" // lists the account follows
+)
+
+// Lists returns the lists of the given kind. Only the URL of each list is
+// recorded in the archive, so only the ID of each list is filled in.
+func (a *Archive) Lists(kind string) ([]*types.List, error) {
+	var info []struct {
+		URL string `json:"url"`
+	}
+	if err := a.Read("userListInfo", &info, "lists-"+kind); err != nil {
+		return nil, err
+	}
+	var out []*types.List
+	for _, li := range info {
+		u, err := url.Parse(li.URL)
+		if err != nil {
+			continue
+		}
+		out = append(out, &types.List{ID: path.Base(u.Path)})
+	}
+	return out, nil
+}
+
+// A Message is a direct message, in the format of a v2 DM event.
+type Message struct {
+	ID             string     `json:"id"`
+	EventType      string     `json:"event_type"`
+	Text           string     `json:"text"`
+	SenderID       string     `json:"sender_id"`
+	RecipientID    string     `json:"recipient_id,omitempty"`
+	ConversationID string     `json:"dm_conversation_id"`
+	CreatedAt      *time.Time `json:"created_at,omitempty"`
+}
+
+// Messages returns the direct messages in the archive, including group
+// messages, in order of their creation.
+func (a *Archive) Messages() ([]*Message, error) {
+	var convs []struct {
+		ID       string `json:"conversationId"`
+		Messages []struct {
+			Create *struct {
+				ID          string `json:"id"`
+				Text        string `json:"text"`
+				SenderID    string `json:"senderId"`
+				RecipientID string `json:"recipientId"`
+				CreatedAt   Time   `json:"createdAt"`
+			} `json:"messageCreate"`
+		} `json:"messages"`
+	}
+	if err := a.Read("dmConversation", &convs, "direct-messages", "direct-messages-group"); err != nil {
+		return nil, err
+	}
+	var out []*Message
+	for _, c := range convs {
+		for _, m := range c.Messages {
+			if m.Create == nil {
+				continue // a membership change or other event
+			}
+			msg := &Message{
+				ID:             m.Create.ID,
+				EventType:      "MessageCreate",
+				Text:           m.Create.Text,
+				SenderID:       m.Create.SenderID,
+				RecipientID:    m.Create.RecipientID,
+				ConversationID: c.ID,
+			}
+			if ts := m.Create.CreatedAt.Time; !ts.IsZero() {
+				msg.CreatedAt = &ts
+			}
+			out = append(out, msg)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].CreatedAt != nil && out[j].CreatedAt != nil && out[i].CreatedAt.Before(*out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Tweet converts t to the format reported by the API, as posted by the user
+// with the given ID.
+func (t *Tweet) Tweet(authorID string) *types.Tweet {
+	out := &types.Tweet{
+		ID:        t.ID,
+		Text:      t.Text,
+		AuthorID:  authorID,
+		InReplyTo: t.InReplyToUserID,
+		Language:  t.Lang,
+		Source:    htmlTag.ReplaceAllString(t.Source, ""),
+	}
+	if !t.CreatedAt.IsZero() {
+		ts := t.CreatedAt.Time
+		out.CreatedAt = &ts
+	}
+	if t.IsReply() {
+		out.Referenced = append(out.Referenced, &types.Ref{Type: "replied_to", ID: t.InReplyToStatusID})
+	}
+	out.PublicMetrics = types.Metrics{
+		"like_count":    int(t.FavoriteCount),
+		"retweet_count": int(t.RetweetCount),
+	}
+	return out
+}
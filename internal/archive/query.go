@@ -0,0 +1,422 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/creachadair/twig/internal/tweettext"
+	"github.com/creachadair/twitter/types"
+)
+
+// A Query is a search query, in the syntax of the search API, that can be
+// evaluated against tweets stored locally. See the "search-query" help topic
+// for the syntax.
+type Query struct {
+	root node
+}
+
+// A Doc is a tweet to be matched by a query, along with a way to find the
+// usernames of the users it refers to.
+type Doc struct {
+	Tweet *types.Tweet
+
+	// Username returns the username of the user with the given ID, or ""
+	// if it is not known. If nil, no usernames are known.
+	Username func(id string) string
+
+	text string // the lower-case text of the tweet
+}
+
+func (d *Doc) username(id string) string {
+	if d.Username == nil || id == "" {
+		return ""
+	}
+	return d.Username(id)
+}
+
+// Match reports whether d matches q.
+func (q *Query) Match(d *Doc) bool {
+	d.text = strings.ToLower(d.Tweet.Text)
+	return q.root.match(d)
+}
+
+// A node is a term or combination of terms in a query.
+type node interface {
+	match(*Doc) bool
+}
+
+type andNode []node
+
+func (n andNode) match(d *Doc) bool {
+	for _, sub := range n {
+		if !sub.match(d) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []node
+
+func (n orNode) match(d *Doc) bool {
+	for _, sub := range n {
+		if sub.match(d) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct{ node }
+
+func (n notNode) match(d *Doc) bool { return !n.node.match(d) }
+
+type termNode func(*Doc) bool
+
+func (n termNode) match(d *Doc) bool { return n(d) }
+
+// ParseQuery parses a search query.
+func ParseQuery(s string) (*Query, error) {
+	toks, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	} else if p.pos < len(p.toks) {
+		return nil, errors.New("unbalanced parentheses in query")
+	}
+	return &Query{root: root}, nil
+}
+
+// Kinds of query token.
+const (
+	tokWord   = iota // a word or operator
+	tokPhrase        // a quoted phrase
+	tokOpen          // "("
+	tokClose         // ")"
+	tokNot           // "-" before a term or group
+	tokOr            // OR
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var out []token
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += n
+		case r == '(':
+			out = append(out, token{kind: tokOpen})
+			i++
+		case r == ')':
+			out = append(out, token{kind: tokClose})
+			i++
+		case r == '-':
+			if i+1 == len(s) || isSpaceOrClose(s[i+1]) {
+				return nil, errors.New(`"-" must be followed by a term`)
+			}
+			out = append(out, token{kind: tokNot})
+			i++
+		case r == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated quoted phrase in query")
+			}
+			out = append(out, token{kind: tokPhrase, text: s[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			end := strings.IndexFunc(s[i:], func(r rune) bool {
+				return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+			})
+			if end < 0 {
+				end = len(s) - i
+			}
+			word := s[i : i+end]
+			if word == "OR" {
+				out = append(out, token{kind: tokOr})
+			} else {
+				out = append(out, token{kind: tokWord, text: word})
+			}
+			i += end
+		}
+	}
+	return out, nil
+}
+
+func isSpaceOrClose(b byte) bool { return b == ' ' || b == '\t' || b == '\n' || b == ')' }
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos], true
+	}
+	return token{}, false
+}
+
+// parseOr parses a disjunction of conjunctions: a b OR c d.
+func (p *parser) parseOr() (node, error) {
+	var alts orNode
+	for {
+		and, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, and)
+		if tok, ok := p.peek(); !ok || tok.kind != tokOr {
+			break
+		}
+		p.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return alts, nil
+}
+
+// parseAnd parses a conjunction of terms, ending before OR or ")".
+func (p *parser) parseAnd() (node, error) {
+	var terms andNode
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokOr || tok.kind == tokClose {
+			break
+		}
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return nil, errors.New("empty query or group")
+	} else if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+// parseUnary parses a single term or group, possibly negated.
+func (p *parser) parseUnary() (node, error) {
+	tok := p.toks[p.pos]
+	p.pos++
+	switch tok.kind {
+	case tokNot:
+		if next, ok := p.peek(); !ok || next.kind == tokOr || next.kind == tokClose {
+			return nil, errors.New(`"-" must be followed by a term`)
+		}
+		sub, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{sub}, nil
+	case tokOpen:
+		sub, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		} else if next, ok := p.peek(); !ok || next.kind != tokClose {
+			return nil, errors.New("unbalanced parentheses in query")
+		}
+		p.pos++
+		return sub, nil
+	case tokPhrase:
+		return textTerm(tok.text), nil
+	case tokWord:
+		return parseTerm(tok.text)
+	}
+	return nil, errors.New("unbalanced parentheses in query")
+}
+
+// unsupported are operators of the search API that cannot be evaluated
+// without information the local store does not have.
+var unsupported = map[string]bool{
+	"list": true, "place": true, "place_country": true, "point_radius": true,
+	"bounding_box": true, "context": true, "entity": true, "bio": true,
+	"bio_name": true, "bio_location": true, "followers_count": true,
+	"sample": true, "retweets_of_tweet_id": true, "in_reply_to_tweet_id": true,
+	"quotes_of_tweet_id": true, "source": true,
+}
+
+// parseTerm parses a single word of a query, which may be an operator.
+func parseTerm(word string) (node, error) {
+	if op, arg, ok := strings.Cut(word, ":"); ok && arg != "" && isOperator(op) {
+		if unsupported[op] {
+			return nil, fmt.Errorf("operator %q is not supported in local searches", op+":")
+		}
+		return operatorTerm(op, arg)
+	}
+	switch word[0] {
+	case '@':
+		name := strings.ToLower(word[1:])
+		return termNode(func(d *Doc) bool {
+			if d.Tweet.Entities != nil {
+				for _, m := range d.Tweet.Entities.Mentions {
+					if strings.EqualFold(m.Username, name) {
+						return true
+					}
+				}
+			}
+			return containsWord(d.text, "@"+name)
+		}), nil
+	case '#':
+		tag := strings.ToLower(word[1:])
+		return termNode(func(d *Doc) bool {
+			if d.Tweet.Entities != nil {
+				for _, h := range d.Tweet.Entities.HashTags {
+					if strings.EqualFold(h.Tag, tag) {
+						return true
+					}
+				}
+			}
+			return containsWord(d.text, "#"+tag)
+		}), nil
+	}
+	return textTerm(word), nil
+}
+
+func isOperator(op string) bool {
+	if unsupported[op] {
+		return true
+	}
+	switch op {
+	case "from", "to", "has", "is", "lang", "url", "conversation_id", "retweets_of":
+		return true
+	}
+	return false
+}
+
+// textTerm matches tweets whose text contains s as a word or phrase,
+// ignoring case.
+func textTerm(s string) node {
+	s = strings.ToLower(s)
+	return termNode(func(d *Doc) bool { return containsWord(d.text, s) })
+}
+
+// containsWord reports whether text contains word, not as part of a longer
+// word.
+func containsWord(text, word string) bool {
+	if word == "" {
+		return true
+	}
+	for i := 0; i+len(word) <= len(text); {
+		j := strings.Index(text[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before) || !isWordRune(firstRune(word))) &&
+			(end == len(text) || !isWordRune(after) || !isWordRune(lastRune(word))) {
+			return true
+		}
+		i = start + 1
+	}
+	return false
+}
+
+func isWordRune(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func firstRune(s string) rune { r, _ := utf8.DecodeRuneInString(s); return r }
+
+func lastRune(s string) rune { r, _ := utf8.DecodeLastRuneInString(s); return r }
+
+var (
+	linkExpr = regexp.MustCompile(`https?://\S`)
+)
+
+// operatorTerm returns a node for the search operator op with argument arg.
+func operatorTerm(op, arg string) (node, error) {
+	user := strings.TrimPrefix(strings.ToLower(arg), "@")
+	isUser := func(d *Doc, id string) bool {
+		return id != "" && (id == user || strings.EqualFold(d.username(id), user))
+	}
+	switch op {
+	case "from":
+		return termNode(func(d *Doc) bool { return isUser(d, d.Tweet.AuthorID) }), nil
+	case "to":
+		return termNode(func(d *Doc) bool {
+			return isUser(d, d.Tweet.InReplyTo) || (isReply(d.Tweet) && strings.HasPrefix(d.text, "@"+user+" "))
+		}), nil
+	case "retweets_of":
+		return termNode(func(d *Doc) bool { return strings.HasPrefix(d.text, "rt @"+user+":") }), nil
+	case "lang":
+		return termNode(func(d *Doc) bool { return strings.EqualFold(d.Tweet.Language, arg) }), nil
+	case "conversation_id":
+		return termNode(func(d *Doc) bool {
+			return d.Tweet.ConversationID == arg || (d.Tweet.ConversationID == "" && d.Tweet.ID == arg)
+		}), nil
+	case "url":
+		want := strings.ToLower(arg)
+		return termNode(func(d *Doc) bool {
+			if d.Tweet.Entities != nil {
+				for _, u := range d.Tweet.Entities.URLs {
+					for _, s := range []string{u.URL, u.Expanded, u.Display, u.Unwound} {
+						if s != "" && strings.Contains(strings.ToLower(s), want) {
+							return true
+						}
+					}
+				}
+			}
+			return strings.Contains(d.text, want)
+		}), nil
+	case "has":
+		switch arg {
+		case "links":
+			return termNode(func(d *Doc) bool {
+				return (d.Tweet.Entities != nil && len(d.Tweet.Entities.URLs) != 0) || linkExpr.MatchString(d.text)
+			}), nil
+		case "hashtags":
+			return termNode(func(d *Doc) bool {
+				return (d.Tweet.Entities != nil && len(d.Tweet.Entities.HashTags) != 0) || len(tweettext.Extract(d.Tweet.Text).Hashtags) != 0
+			}), nil
+		case "mentions":
+			return termNode(func(d *Doc) bool {
+				return (d.Tweet.Entities != nil && len(d.Tweet.Entities.Mentions) != 0) || len(tweettext.Extract(d.Tweet.Text).Mentions) != 0
+			}), nil
+		case "media", "images", "videos":
+			// The store does not record the types of media, so any media match.
+			return termNode(func(d *Doc) bool { return len(d.Tweet.Attachments["media_keys"]) != 0 }), nil
+		}
+	case "is":
+		switch arg {
+		case "retweet":
+			return termNode(func(d *Doc) bool { return hasRef(d.Tweet, "retweeted") || strings.HasPrefix(d.text, "rt @") }), nil
+		case "quote":
+			return termNode(func(d *Doc) bool { return hasRef(d.Tweet, "quoted") }), nil
+		case "reply":
+			return termNode(func(d *Doc) bool { return isReply(d.Tweet) }), nil
+		case "nullcast":
+			return termNode(func(*Doc) bool { return false }), nil // stored tweets are not promoted
+		}
+	}
+	return nil, fmt.Errorf("operator %q is not supported in local searches", op+":"+arg)
+}
+
+func hasRef(t *types.Tweet, kind string) bool {
+	for _, ref := range t.Referenced {
+		if ref.Type == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func isReply(t *types.Tweet) bool { return t.InReplyTo != "" || hasRef(t, "replied_to") }
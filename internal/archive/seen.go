@@ -0,0 +1,141 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package archive
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/creachadair/twitter/types"
+)
+
+// Names of the collections of tweets and users seen in the results of
+// commands.
+const (
+	StoreSeenTweets = "seen-tweets" // []*SeenTweet
+	StoreSeenUsers  = "seen-users"  // []*SeenUser
+)
+
+// A SeenTweet is a tweet seen in the results of a command, along with when
+// it was first and last seen.
+type SeenTweet struct {
+	*types.Tweet
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// A SeenUser is a user seen in the results of a command, along with when it
+// was first and last seen.
+type SeenUser struct {
+	*types.User
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Seen is the set of tweets and users seen in the results of commands, kept
+// in a Store. Each tweet and user is recorded once, by ID.
+type Seen struct {
+	st     *Store
+	tweets map[string]*SeenTweet
+	users  map[string]*SeenUser
+}
+
+// LoadSeen loads the tweets and users seen from st.
+func LoadSeen(st *Store) (*Seen, error) {
+	var tweets []*SeenTweet
+	var users []*SeenUser
+	if err := st.Load(StoreSeenTweets, &tweets); err != nil {
+		return nil, err
+	} else if err := st.Load(StoreSeenUsers, &users); err != nil {
+		return nil, err
+	}
+	s := &Seen{st: st, tweets: make(map[string]*SeenTweet), users: make(map[string]*SeenUser)}
+	for _, t := range tweets {
+		s.tweets[t.ID] = t
+	}
+	for _, u := range users {
+		s.users[u.ID] = u
+	}
+	return s, nil
+}
+
+// Add records that the given tweets and users were seen at the given time. A
+// tweet or user seen before is updated with the fields of the new copy, and
+// keeps any fields the new copy lacks, since commands may request different
+// fields.
+func (s *Seen) Add(tweets types.Tweets, users types.Users, now time.Time) {
+	now = now.UTC().Truncate(time.Second)
+	for _, t := range tweets {
+		if old, ok := s.tweets[t.ID]; ok {
+			old.Tweet = merge(old.Tweet, t)
+			old.LastSeen = now
+		} else {
+			s.tweets[t.ID] = &SeenTweet{Tweet: t, FirstSeen: now, LastSeen: now}
+		}
+	}
+	for _, u := range users {
+		if old, ok := s.users[u.ID]; ok {
+			old.User = merge(old.User, u)
+			old.LastSeen = now
+		} else {
+			s.users[u.ID] = &SeenUser{User: u, FirstSeen: now, LastSeen: now}
+		}
+	}
+}
+
+// merge returns a copy of old updated with the fields of cur.
+func merge[T any](old, cur *T) *T {
+	var fields map[string]json.RawMessage
+	oldData, err1 := json.Marshal(old)
+	newData, err2 := json.Marshal(cur)
+	if err1 != nil || err2 != nil || json.Unmarshal(oldData, &fields) != nil || json.Unmarshal(newData, &fields) != nil {
+		return cur
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return cur
+	}
+	out := new(T)
+	if json.Unmarshal(data, out) != nil {
+		return cur
+	}
+	return out
+}
+
+// Save writes the tweets and users seen back to the store.
+func (s *Seen) Save() error {
+	if err := s.st.Save(StoreSeenTweets, s.Tweets()); err != nil {
+		return err
+	}
+	return s.st.Save(StoreSeenUsers, s.Users())
+}
+
+// Tweets returns the tweets seen, newest first.
+func (s *Seen) Tweets() []*SeenTweet {
+	out := make([]*SeenTweet, 0, len(s.tweets))
+	for _, t := range s.tweets {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return IDLess(out[j].ID, out[i].ID) })
+	return out
+}
+
+// Users returns the users seen, in order of ID.
+func (s *Seen) Users() []*SeenUser {
+	out := make([]*SeenUser, 0, len(s.users))
+	for _, u := range s.users {
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool { return IDLess(out[i].ID, out[j].ID) })
+	return out
+}
+
+// IDLess reports whether ID a precedes ID b. IDs are decimal numbers, and
+// those of tweets increase with time.
+func IDLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
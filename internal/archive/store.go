@@ -0,0 +1,78 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/creachadair/atomicfile"
+)
+
+// Names of the collections in a Store.
+const (
+	StoreAccount   = "account"   // a *types.User
+	StoreTweets    = "tweets"    // []*types.Tweet
+	StoreLikes     = "likes"     // []*types.Tweet
+	StoreFollowers = "followers" // []*types.User
+	StoreFollowing = "following" // []*types.User
+	StoreMessages  = "messages"  // []*Message
+)
+
+// StoreLists returns the name of the collection of lists of the given kind
+// (ListsCreated, ListsMember, or ListsSubscribed), a []*types.List.
+func StoreLists(kind string) string { return "lists-" + kind }
+
+// A Store is a local database of records, kept in a directory with one JSON
+// file for each collection of records.
+type Store struct {
+	dir string
+}
+
+// OpenStore returns a store kept in the given directory. The directory is
+// created when the first collection is saved.
+func OpenStore(dir string) *Store { return &Store{dir: dir} }
+
+// Dir returns the directory of the store.
+func (s *Store) Dir() string { return s.dir }
+
+func (s *Store) path(name string) string { return filepath.Join(s.dir, name+".json") }
+
+// Has reports whether the store contains the named collection.
+func (s *Store) Has(name string) bool {
+	_, err := os.Stat(s.path(name))
+	return err == nil
+}
+
+// Load decodes the named collection into v. If the collection does not
+// exist, v is unchanged and Load reports nil.
+func (s *Store) Load(name string, v any) error {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save replaces the contents of the named collection with v.
+func (s *Store) Save(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteData(s.path(name), data, 0600); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
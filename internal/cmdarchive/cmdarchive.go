@@ -0,0 +1,532 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdarchive
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/archive"
+	"github.com/creachadair/twitter/types"
+)
+
+var queryOpts struct {
+	match string
+	since string
+	until string
+	with  string
+	kind  string
+	max   int
+}
+
+var Command = &command.C{
+	Name: "archive",
+	Help: `Commands to import and query a local archive of Twitter data.
+
+The local archive is kept in a directory (see archive_dir in "help config").
+Use "archive import" to load the data from a Twitter account archive, and
+the "archive query" commands to print the records it contains, in the same
+format as the commands that fetch them from the API.
+
+If archive_seen is set in the config file, or the global -archive-seen flag
+is set, the tweets and users returned by the lookup, search, timeline, and
+stream commands are also saved in the local archive, at least once a minute
+while the command runs and again when it ends. Each is saved once, with the
+times it was first and last seen. Use "archive search" to search the saved
+and imported tweets.`,
+	Commands: []*command.C{
+		{
+			Name:  "import",
+			Usage: "path",
+			Help: `Import the contents of a Twitter account archive.
+
+The path is the zip file of the archive, or the directory where it has been
+unpacked. The account, tweets, likes, followers, following, lists, and
+direct messages in the archive are imported, replacing any of the same kind
+imported before. The number of records of each kind is printed.`,
+			Run: runImport,
+		},
+		{
+			Name:  "search",
+			Usage: "query...",
+			Help: `Search the tweets in the local archive.
+
+The query has the syntax of the search command (see "help search-query"),
+and is evaluated locally, without calling the API. The tweets searched are
+those imported from an account archive, including likes, and those saved
+from the results of other commands. Matching tweets are printed newest
+first; set -max to limit the number printed.
+
+Operators that need data the archive does not record, such as list: and
+is:verified, are reported as errors. The types of media are not recorded,
+so has:images and has:videos match tweets with any media.`,
+			SetFlags: setQueryFlags(false, false),
+			Run:      runSearch,
+		},
+		{
+			Name: "query",
+			Help: `Commands to print records from the local archive.
+
+Records are printed one per line as JSON. Tweets, users, and lists are
+printed in the format of the API, with the fields the archive records.
+Direct messages are printed in the format of DM events.
+
+Set -match to print only records whose text matches a regular expression
+(use "(?i)" for case-insensitive matching), -since and -until to print only
+records created on or after -since and before -until (a date "2006-01-02" in
+local time, or an RFC 3339 time), and -max to limit the number printed.`,
+			Commands: []*command.C{
+				{
+					Name: "account",
+					Help: "Print the account the archive belongs to.",
+					Run:  runAccount,
+				},
+				{
+					Name:     "tweets",
+					Help:     "Print tweets posted by the account, newest first.",
+					SetFlags: setQueryFlags(true, true),
+					Run:      runTweets(archive.StoreTweets),
+				},
+				{
+					Name:     "likes",
+					Help:     "Print tweets liked by the account, most recently liked first.",
+					SetFlags: setQueryFlags(true, false),
+					Run:      runTweets(archive.StoreLikes),
+				},
+				{
+					Name:     "followers",
+					Help:     "Print users who follow the account.",
+					SetFlags: setQueryFlags(false, false),
+					Run:      runUsers(archive.StoreFollowers),
+				},
+				{
+					Name:     "following",
+					Help:     "Print users followed by the account.",
+					SetFlags: setQueryFlags(false, false),
+					Run:      runUsers(archive.StoreFollowing),
+				},
+				{
+					Name: "lists",
+					Help: `Print lists created by, including, or followed by the account.
+
+Set -kind to print only lists of one kind: created, member, or subscribed.`,
+					SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+						setQueryFlags(false, false)(env, fs)
+						fs.StringVar(&queryOpts.kind, "kind", "", "Print only lists of this kind")
+					},
+					Run: runLists,
+				},
+				{
+					Name: "messages",
+					Help: `Print direct messages sent or received by the account, oldest first.
+
+Set -with to print only messages sent to or by the user with this ID.`,
+					SetFlags: func(env *command.Env, fs *flag.FlagSet) {
+						setQueryFlags(true, true)(env, fs)
+						fs.StringVar(&queryOpts.with, "with", "", "Print only messages to or from this user ID")
+					},
+					Run: runMessages,
+				},
+			},
+		},
+	},
+}
+
+// setQueryFlags returns a SetFlags function for a query command that sets the
+// -max flag, and the -match and -since/-until flags if text and dated are set.
+func setQueryFlags(text, dated bool) func(*command.Env, *flag.FlagSet) {
+	return func(_ *command.Env, fs *flag.FlagSet) {
+		fs.IntVar(&queryOpts.max, "max", 0, "Print at most this many records (0 for all)")
+		if text {
+			fs.StringVar(&queryOpts.match, "match", "", "Print only records whose text matches this regexp")
+		}
+		if dated {
+			fs.StringVar(&queryOpts.since, "since", "", "Print only records created on or after this date")
+			fs.StringVar(&queryOpts.until, "until", "", "Print only records created before this date")
+		}
+	}
+}
+
+func runImport(env *command.Env, args []string) error {
+	if len(args) != 1 {
+		return command.FailWithUsage(env, args)
+	}
+	a, err := archive.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	st, err := openStore(env.Config.(*config.Config))
+	if err != nil {
+		return err
+	}
+
+	// Each kind of record is saved even if the archive contains none, so that
+	// the records of an earlier import are replaced. All the records are read
+	// before any are saved, so that an archive that cannot be read does not
+	// leave the store with a mix of old and new records.
+	type collection struct {
+		label, name string
+		n           int // the number of records, printed if nonzero
+		v           any
+	}
+	var imported []collection
+	add := func(label, name string, n int, v any) {
+		imported = append(imported, collection{label: label, name: name, n: n, v: v})
+	}
+
+	acct, err := a.Account()
+	if err != nil {
+		return err
+	}
+	var authorID string
+	var user *types.User
+	var nacct int
+	if acct != nil {
+		authorID, user, nacct = acct.ID, acct.User(), 1
+	}
+	add("account", archive.StoreAccount, nacct, user)
+
+	tweets, err := a.Tweets()
+	if err != nil {
+		return err
+	}
+	tw := make([]*types.Tweet, len(tweets))
+	for i, t := range tweets {
+		tw[i] = t.Tweet(authorID)
+	}
+	sort.SliceStable(tw, func(i, j int) bool { return newer(tw[i].CreatedAt, tw[j].CreatedAt) })
+	add("tweets", archive.StoreTweets, len(tw), tw)
+
+	likes, err := a.Likes()
+	if err != nil {
+		return err
+	}
+	lk := make([]*types.Tweet, len(likes))
+	for i, k := range likes {
+		lk[i] = k.Tweet()
+	}
+	add("likes", archive.StoreLikes, len(lk), lk)
+
+	for _, rel := range []struct {
+		label string
+		read  func() ([]*archive.Relation, error)
+	}{
+		{archive.StoreFollowers, a.Followers},
+		{archive.StoreFollowing, a.Following},
+	} {
+		rs, err := rel.read()
+		if err != nil {
+			return err
+		}
+		us := make([]*types.User, len(rs))
+		for i, r := range rs {
+			us[i] = r.User()
+		}
+		add(rel.label, rel.label, len(us), us)
+	}
+
+	for _, kind := range []string{archive.ListsCreated, archive.ListsMember, archive.ListsSubscribed} {
+		ls, err := a.Lists(kind)
+		if err != nil {
+			return err
+		}
+		if kind == archive.ListsCreated {
+			for _, l := range ls {
+				l.OwnerID = authorID
+			}
+		}
+		add("lists "+kind, archive.StoreLists(kind), len(ls), ls)
+	}
+
+	msgs, err := a.Messages()
+	if err != nil {
+		return err
+	}
+	add("messages", archive.StoreMessages, len(msgs), msgs)
+
+	for _, c := range imported {
+		if err := st.Save(c.name, c.v); err != nil {
+			return err
+		} else if c.n != 0 {
+			fmt.Printf("%s: %d\n", c.label, c.n)
+		}
+	}
+	return nil
+}
+
+// newer reports whether time a is after time b. A missing time is older than
+// any other.
+func newer(a, b *time.Time) bool { return a != nil && (b == nil || a.After(*b)) }
+
+// A recordFilter selects records by the query flags.
+type recordFilter struct {
+	match        *regexp.Regexp
+	since, until time.Time
+	n            int // records selected so far
+}
+
+func newRecordFilter() (*recordFilter, error) {
+	f := new(recordFilter)
+	var err error
+	if queryOpts.match != "" {
+		if f.match, err = regexp.Compile(queryOpts.match); err != nil {
+			return nil, fmt.Errorf("invalid -match: %w", err)
+		}
+	}
+	if f.since, err = config.ParseDate(queryOpts.since); err != nil {
+		return nil, fmt.Errorf("invalid -since: %w", err)
+	}
+	if f.until, err = config.ParseDate(queryOpts.until); err != nil {
+		return nil, fmt.Errorf("invalid -until: %w", err)
+	}
+	return f, nil
+}
+
+// done reports whether the -max limit has been reached.
+func (f *recordFilter) done() bool { return queryOpts.max > 0 && f.n >= queryOpts.max }
+
+// selects reports whether a record with the given text and creation time is
+// selected, and counts it if so.
+func (f *recordFilter) selects(text string, created *time.Time) bool {
+	if f.match != nil && !f.match.MatchString(text) {
+		return false
+	}
+	if !f.since.IsZero() || !f.until.IsZero() {
+		if created == nil || created.Before(f.since) || (!f.until.IsZero() && !created.Before(f.until)) {
+			return false
+		}
+	}
+	f.n++
+	return true
+}
+
+func runAccount(env *command.Env, args []string) error {
+	if len(args) != 0 {
+		return command.FailWithUsage(env, args)
+	}
+	st, err := openStore(env.Config.(*config.Config))
+	if err != nil {
+		return err
+	}
+	var u *types.User
+	if err := st.Load(archive.StoreAccount, &u); err != nil {
+		return err
+	} else if u == nil {
+		return fmt.Errorf("no account has been imported to %s", st.Dir())
+	}
+	return config.PrintJSON(u)
+}
+
+func runTweets(name string) func(*command.Env, []string) error {
+	return func(env *command.Env, args []string) error {
+		if len(args) != 0 {
+			return command.FailWithUsage(env, args)
+		}
+		f, err := newRecordFilter()
+		if err != nil {
+			return err
+		}
+		st, err := openStore(env.Config.(*config.Config))
+		if err != nil {
+			return err
+		}
+		var tw types.Tweets
+		if err := st.Load(name, &tw); err != nil {
+			return err
+		}
+		for _, t := range tw {
+			if f.done() {
+				break
+			} else if f.selects(t.Text, t.CreatedAt) {
+				if err := config.PrintJSON(t); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func runUsers(name string) func(*command.Env, []string) error {
+	return func(env *command.Env, args []string) error {
+		if len(args) != 0 {
+			return command.FailWithUsage(env, args)
+		}
+		cfg := env.Config.(*config.Config)
+		st, err := openStore(env.Config.(*config.Config))
+		if err != nil {
+			return err
+		}
+		var us types.Users
+		if err := st.Load(name, &us); err != nil {
+			return err
+		}
+		cache, err := cfg.UserCache()
+		if err != nil {
+			return err
+		}
+		for i, u := range us {
+			if queryOpts.max > 0 && i >= queryOpts.max {
+				break
+			}
+			// The archive records only user IDs; fill in usernames we know.
+			if u.Username == "" {
+				u.Username, _ = cache.LookupID(u.ID)
+			}
+			if err := config.PrintJSON(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func runLists(env *command.Env, args []string) error {
+	if len(args) != 0 {
+		return command.FailWithUsage(env, args)
+	}
+	kinds := []string{archive.ListsCreated, archive.ListsMember, archive.ListsSubscribed}
+	switch queryOpts.kind {
+	case "":
+	case archive.ListsCreated, archive.ListsMember, archive.ListsSubscribed:
+		kinds = []string{queryOpts.kind}
+	default:
+		return fmt.Errorf("invalid -kind %q (want created, member, or subscribed)", queryOpts.kind)
+	}
+	st, err := openStore(env.Config.(*config.Config))
+	if err != nil {
+		return err
+	}
+	var n int
+	for _, kind := range kinds {
+		var ls []*types.List
+		if err := st.Load(archive.StoreLists(kind), &ls); err != nil {
+			return err
+		}
+		for _, l := range ls {
+			if queryOpts.max > 0 && n >= queryOpts.max {
+				return nil
+			}
+			n++
+			if err := config.PrintJSON(l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runMessages(env *command.Env, args []string) error {
+	if len(args) != 0 {
+		return command.FailWithUsage(env, args)
+	}
+	f, err := newRecordFilter()
+	if err != nil {
+		return err
+	}
+	st, err := openStore(env.Config.(*config.Config))
+	if err != nil {
+		return err
+	}
+	var msgs []*archive.Message
+	if err := st.Load(archive.StoreMessages, &msgs); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if f.done() {
+			break
+		} else if queryOpts.with != "" && m.SenderID != queryOpts.with && m.RecipientID != queryOpts.with {
+			continue
+		} else if f.selects(m.Text, m.CreatedAt) {
+			if err := config.PrintJSON(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runSearch(env *command.Env, args []string) error {
+	if len(args) == 0 {
+		return command.FailWithUsage(env, args)
+	}
+	q, err := archive.ParseQuery(strings.Join(args, " "))
+	if err != nil {
+		return fmt.Errorf("invalid query: %w", err)
+	}
+	cfg := env.Config.(*config.Config)
+	st, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	seen, err := archive.LoadSeen(st)
+	if err != nil {
+		return err
+	}
+
+	// Usernames are found among the users seen, the account the archive
+	// belongs to, and the username cache.
+	names := make(map[string]string)
+	for _, u := range seen.Users() {
+		names[u.ID] = u.Username
+	}
+	var acct *types.User
+	if err := st.Load(archive.StoreAccount, &acct); err != nil {
+		return err
+	} else if acct != nil {
+		names[acct.ID] = acct.Username
+	}
+	cache, err := cfg.UserCache()
+	if err != nil {
+		return err
+	}
+	username := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		name, _ := cache.LookupID(id)
+		return name
+	}
+
+	// Tweets seen are preferred to imported copies, which record less.
+	byID := make(map[string]*types.Tweet)
+	for _, t := range seen.Tweets() {
+		byID[t.ID] = t.Tweet
+	}
+	for _, name := range []string{archive.StoreTweets, archive.StoreLikes} {
+		var tw types.Tweets
+		if err := st.Load(name, &tw); err != nil {
+			return err
+		}
+		for _, t := range tw {
+			if _, ok := byID[t.ID]; !ok {
+				byID[t.ID] = t
+			}
+		}
+	}
+	all := make(types.Tweets, 0, len(byID))
+	for _, t := range byID {
+		all = append(all, t)
+	}
+	sort.Slice(all, func(i, j int) bool { return archive.IDLess(all[j].ID, all[i].ID) })
+
+	var n int
+	for _, t := range all {
+		if queryOpts.max > 0 && n >= queryOpts.max {
+			break
+		} else if q.Match(&archive.Doc{Tweet: t, Username: username}) {
+			n++
+			if err := config.PrintJSON(t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdarchive
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/archive"
+	"github.com/creachadair/twitter/types"
+)
+
+// openStore returns the store of the local archive for cfg.
+func openStore(cfg *config.Config) (*archive.Store, error) {
+	dir, err := cfg.ArchivePath()
+	if err != nil {
+		return nil, err
+	}
+	return archive.OpenStore(dir), nil
+}
+
+// Limits on how many records are kept in memory before they are saved.
+const (
+	seenFlushBatches  = 100         // batches of tweets and users
+	seenFlushInterval = time.Minute // time since the last save
+)
+
+// RecordSeen arranges for the tweets and users seen by a command to be saved
+// in the local archive, if cfg.ArchiveSeen is true. They are kept in memory,
+// and saved once seenFlushBatches batches have been seen or seenFlushInterval
+// after the first of them, whichever comes first. The rest are saved by the
+// function RecordSeen returns, which the caller must call when the command is
+// done. It reports the first error from any save.
+func RecordSeen(cfg *config.Config) (save func() error) {
+	if !cfg.ArchiveSeen {
+		return func() error { return nil }
+	}
+	r := &seenRecorder{cfg: cfg}
+	cfg.SetSeenRecorder(r)
+	return func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.flushLocked()
+		return r.err
+	}
+}
+
+// A seenRecorder keeps the tweets and users seen by a command until they are
+// saved.
+type seenRecorder struct {
+	cfg *config.Config
+
+	mu    sync.Mutex
+	seen  []seenBatch
+	timer *time.Timer // saves the records when it fires
+	err   error       // the first error saving records
+}
+
+type seenBatch struct {
+	tweets types.Tweets
+	users  types.Users
+	at     time.Time
+}
+
+// Add implements the config.SeenRecorder interface.
+func (r *seenRecorder) Add(tweets types.Tweets, users types.Users, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = append(r.seen, seenBatch{tweets: tweets, users: users, at: now})
+	if len(r.seen) >= seenFlushBatches {
+		r.flushLocked()
+	} else if r.timer == nil {
+		r.timer = time.AfterFunc(seenFlushInterval, func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.flushLocked()
+		})
+	}
+}
+
+// flushLocked saves the records kept by r, and discards them whether or not
+// the save succeeds, so that a failing archive does not hold them in memory.
+// The caller must hold r.mu.
+func (r *seenRecorder) flushLocked() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	if len(r.seen) == 0 {
+		return
+	}
+	err := r.save()
+	r.seen = nil
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("saving seen tweets and users: %w", err)
+	}
+}
+
+// save adds the tweets and users recorded by r to those saved in the local
+// archive. The saved records are reloaded while the archive is locked, so
+// that records saved by other commands in the meantime are kept.
+func (r *seenRecorder) save() error {
+	st, err := openStore(r.cfg)
+	if err != nil {
+		return err
+	}
+	unlock, err := config.LockFile(filepath.Join(st.Dir(), "seen"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	seen, err := archive.LoadSeen(st)
+	if err != nil {
+		return err
+	}
+	for _, b := range r.seen {
+		seen.Add(b.tweets, b.users, b.at)
+	}
+	return seen.Save()
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdarchive
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/archive"
+	"github.com/creachadair/twitter/types"
+)
+
+func TestRecordSeen(t *testing.T) {
+	cfg := &config.Config{ArchiveDir: t.TempDir(), ArchiveSeen: true}
+	save := RecordSeen(cfg)
+	st, err := openStore(cfg)
+	if err != nil {
+		t.Fatalf("Opening store: %v", err)
+	}
+	numSaved := func() int {
+		t.Helper()
+		seen, err := archive.LoadSeen(st)
+		if err != nil {
+			t.Fatalf("Loading seen: %v", err)
+		}
+		return len(seen.Tweets())
+	}
+
+	// Records are kept in memory until enough batches have been seen.
+	record := func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			cfg.RecordSeen(types.Tweets{{ID: strconv.Itoa(i), Text: "seen"}}, nil)
+		}
+	}
+	record(0, seenFlushBatches-1)
+	if n := numSaved(); n != 0 {
+		t.Errorf("Before flush: got %d saved, want 0", n)
+	}
+	record(seenFlushBatches-1, seenFlushBatches+5)
+	if n := numSaved(); n != seenFlushBatches {
+		t.Errorf("After flush: got %d saved, want %d", n, seenFlushBatches)
+	}
+
+	// The rest are saved when the command ends.
+	if err := save(); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	if n := numSaved(); n != seenFlushBatches+5 {
+		t.Errorf("After save: got %d saved, want %d", n, seenFlushBatches+5)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdbookmark
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/edit"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+var Command = &command.C{
+	Name: "bookmark",
+	Help: `Commands to manage the bookmarks of the authorized user.
+
+Bookmarks are private to each user, so these commands require -auth-user.
+
+The add and remove commands accept either a single tweet ID, "-" to read
+tweet IDs from stdin, or "@file" to read them from the named file. Input
+lines containing JSON objects contribute their "id" field.`,
+
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) { opts.SetFlags(fs) },
+
+	Commands: []*command.C{
+		{
+			Name:  "add",
+			Usage: "id | - | @file",
+			Help:  "Bookmark the specified tweets.",
+			Run: runWithID(func(userID, tweetID string) edit.Query {
+				return edit.Bookmark(userID, tweetID)
+			}),
+		},
+		{
+			Name:  "remove",
+			Usage: "id | - | @file",
+			Help:  "Remove the specified tweets from bookmarks.",
+			Run: runWithID(func(userID, tweetID string) edit.Query {
+				return edit.Unbookmark(userID, tweetID)
+			}),
+		},
+		{
+			Name:  "list",
+			Usage: "[tweet.fields...]",
+			Help: `List the bookmarked tweets, most recently bookmarked first.
+
+` + config.PageHelp,
+			Run: runList,
+		},
+	},
+}
+
+var opts config.PageOpts
+
+// userClient returns a client for the authorized user, and that user's ID.
+func userClient(ctx context.Context, cfg *config.Config) (*twitter.Client, string, error) {
+	if cfg.AuthUser == "" {
+		return nil, "", errors.New("bookmarks require -auth-user")
+	}
+	cli, err := cfg.NewClient()
+	if err != nil {
+		return nil, "", fmt.Errorf("creating client: %w", err)
+	}
+	ids, err := cfg.ResolveID(ctx, cli, []string{"@" + cfg.AuthUser})
+	if err != nil {
+		return nil, "", fmt.Errorf("resolving user: %w", err)
+	} else if len(ids) == 0 {
+		return nil, "", fmt.Errorf("resolving user: %q not found", cfg.AuthUser)
+	}
+	return cli, ids[0], nil
+}
+
+func runWithID(newQuery func(uid, tid string) edit.Query) func(*command.Env, []string) error {
+	return func(env *command.Env, args []string) error {
+		if len(args) != 1 || args[0] == "" {
+			return command.FailWithUsage(env, args)
+		}
+		tweetIDs, err := config.ReadKeys(args)
+		if err != nil {
+			return err
+		}
+		cfg := env.Config.(*config.Config)
+		ctx := cfg.Context()
+		cli, uid, err := userClient(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		for _, tweetID := range tweetIDs {
+			ok, err := newQuery(uid, tweetID).Invoke(ctx, cli)
+			if errors.Is(err, config.ErrDryRun) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("tweet %q: %w", tweetID, err)
+			}
+			fmt.Printf("%s: %v\n", tweetID, ok)
+		}
+		return nil
+	}
+}
+
+func runList(env *command.Env, args []string) error {
+	parsed := config.ParseArgs(args, "tweet")
+	if len(parsed.Keys) != 0 {
+		fmt.Fprintf(env, "Error: extra arguments %v\n", parsed.Keys)
+		return command.FailWithUsage(env, args)
+	}
+	cfg := env.Config.(*config.Config)
+	ctx := cfg.Context()
+	cli, uid, err := userClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	q := tweets.BookmarkedBy(uid, &tweets.ListOpts{
+		PageToken:  opts.PageToken,
+		MaxResults: config.PageSize(opts.MaxResults, 1),
+		Optional:   parsed.Fields,
+	})
+	return config.Paginate(env, q.Request, opts.MaxResults, q.HasMorePages, func() ([]*types.Tweet, error) {
+		rsp, err := q.Invoke(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Tweets, nil
+	})
+}
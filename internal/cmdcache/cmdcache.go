@@ -0,0 +1,68 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdcache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+)
+
+var Command = &command.C{
+	Name: "cache",
+	Help: `Commands to manage the local username cache.
+
+Commands that accept @username arguments resolve them to user IDs using
+a local cache, and only ask the API for usernames that are not already
+cached. Cache entries expire after the cache_ttl set in the config file
+(by default, one week). Use the global -no-cache flag to bypass the cache.`,
+	Commands: []*command.C{
+		{
+			Name: "list",
+			Help: "List the contents of the username cache.",
+			Run: func(env *command.Env, args []string) error {
+				if len(args) != 0 {
+					return command.FailWithUsage(env, args)
+				}
+				cache, err := env.Config.(*config.Config).UserCache()
+				if err != nil {
+					return err
+				}
+				return config.PrintJSON(cache.Entries())
+			},
+		},
+		{
+			Name: "clear",
+			Help: `Discard the contents of the username cache.
+
+The cache file is removed even if it cannot be read, and whether or not
+the -no-cache flag is set.`,
+			Run: func(env *command.Env, args []string) error {
+				if len(args) != 0 {
+					return command.FailWithUsage(env, args)
+				}
+				path, err := env.Config.(*config.Config).UserCachePath()
+				if err != nil {
+					return err
+				}
+
+				// The entries are counted for the report only, since a cache
+				// that cannot be read is the main reason to clear it.
+				var count string
+				if cache, err := config.LoadUserCache(path, 0); err != nil {
+					count = "unreadable cache"
+				} else {
+					count = fmt.Sprintf("%d entries", len(cache.Entries()))
+				}
+				if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return fmt.Errorf("clearing cache: %w", err)
+				}
+				fmt.Printf("cleared: %s\n", count)
+				return nil
+			},
+		},
+	},
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmddraft
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/cmdtweet"
+	"github.com/creachadair/twitter/types"
+)
+
+var draftOpts struct {
+	name  string
+	force bool
+	keep  bool
+}
+
+// Command is the command to manage drafts of tweets. It shares the options
+// and posting logic of "tweet create".
+var Command = &command.C{
+	Name: "draft",
+	Help: `Commands to save drafts of tweets and post them later.
+
+Drafts are kept as JSON files in a local directory (see draft_dir in "help
+config"), which may be shared, for example to let several people prepare
+tweets for one account. A draft records the text of a tweet along with the
+options of "tweet create": the tweet to reply to or quote, media files and
+their alt text, a poll, and reply settings. Media files are recorded by
+path, and are uploaded when the draft is posted.`,
+	Commands: []*command.C{
+		{
+			Name:  "save",
+			Usage: "[options] [text... | -]",
+			Help: `Save a new draft.
+
+The options are the same as for "tweet create", and are checked when the
+draft is saved. The text is given as for "tweet create": as arguments, from
+stdin with "-", or in an editor if there is no text or -e is set.
+
+The draft is named by -name, or else by the next unused number.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+				cmdtweet.SetPostFlags(fs)
+				fs.StringVar(&draftOpts.name, "name", "", "Name of the draft (default is a number)")
+				fs.BoolVar(&draftOpts.force, "f", false, "Replace an existing draft with the same name")
+			},
+			Run: runDraftSave,
+		},
+		{
+			Name: "list",
+			Help: "List the saved drafts.",
+			Run: func(env *command.Env, args []string) error {
+				if len(args) != 0 {
+					return command.FailWithUsage(env, args)
+				}
+				s, err := openDrafts(env)
+				if err != nil {
+					return err
+				}
+				ds, err := s.list()
+				if err != nil {
+					return err
+				}
+				return config.PrintJSON(ds)
+			},
+		},
+		{
+			Name:  "show",
+			Usage: "name",
+			Help:  "Show the draft with the given name.",
+			Run: func(env *command.Env, args []string) error {
+				if len(args) != 1 {
+					return command.FailWithUsage(env, args)
+				}
+				s, err := openDrafts(env)
+				if err != nil {
+					return err
+				}
+				d, err := s.load(args[0])
+				if err != nil {
+					return err
+				}
+				return config.PrintJSON(d)
+			},
+		},
+		{
+			Name:  "edit",
+			Usage: "[options] name [text... | -]",
+			Help: `Change a saved draft.
+
+Options set on the command line replace those of the draft; the others are
+unchanged. Any text given replaces the text of the draft. Set -e to edit
+the text of the draft in an editor.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) { cmdtweet.SetPostFlags(fs) },
+			Run:      runDraftEdit,
+		},
+		{
+			Name:  "post",
+			Usage: "name",
+			Help: `Post the draft with the given name, and delete it.
+
+The draft is posted as "tweet create" would post it, as the -auth-user.
+Set -keep to keep the draft after it is posted.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+				fs.BoolVar(&draftOpts.keep, "keep", false, "Keep the draft after it is posted")
+			},
+			Run: runDraftPost,
+		},
+		{
+			Name:  "delete",
+			Usage: "name ...",
+			Help:  "Delete the drafts with the given names.",
+			Run: func(env *command.Env, args []string) error {
+				if len(args) == 0 {
+					return command.FailWithUsage(env, args)
+				}
+				s, err := openDrafts(env)
+				if err != nil {
+					return err
+				}
+				for _, name := range args {
+					if err := s.remove(name); err != nil {
+						return err
+					}
+				}
+				fmt.Printf("deleted: %d drafts\n", len(args))
+				return nil
+			},
+		},
+	},
+}
+
+func runDraftSave(env *command.Env, args []string) error {
+	s, err := openDrafts(env)
+	if err != nil {
+		return err
+	}
+	name := draftOpts.name
+	if name == "" {
+		name, err = s.nextName()
+		if err != nil {
+			return err
+		}
+	} else if _, err := s.path(name); err != nil {
+		return err
+	} else if _, err := s.load(name); err == nil && !draftOpts.force {
+		return fmt.Errorf("draft %q already exists (use -f to replace it)", name)
+	}
+
+	cfg := env.Config.(*config.Config)
+	now := time.Now().UTC().Truncate(time.Second)
+	d := &Draft{Name: name, Author: cfg.AuthUser, Created: now, Updated: now}
+	if err := d.setFromFlags(env, true); err != nil {
+		return err
+	}
+	return saveDraft(env, s, d, args, true)
+}
+
+func runDraftEdit(env *command.Env, args []string) error {
+	if len(args) == 0 {
+		return command.FailWithUsage(env, args)
+	}
+	s, err := openDrafts(env)
+	if err != nil {
+		return err
+	}
+	d, err := s.load(args[0])
+	if err != nil {
+		return err
+	}
+	if err := d.setFromFlags(env, false); err != nil {
+		return err
+	}
+	d.Updated = time.Now().UTC().Truncate(time.Second)
+	return saveDraft(env, s, d, args[1:], len(args) > 1 || editFlag(env.Command))
+}
+
+// saveDraft checks the options of d, sets its text from args if setText is
+// true, and saves it.
+func saveDraft(env *command.Env, s draftStore, d *Draft, args []string, setText bool) error {
+	p, err := d.post()
+	if err != nil {
+		return err
+	}
+	if setText {
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
+		if err != nil {
+			return fmt.Errorf("creating client: %w", err)
+		}
+		d.Text, err = cmdtweet.PostText(env, cli, p, args, d.Text)
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.save(d); err != nil {
+		return err
+	}
+	return config.PrintJSON(d)
+}
+
+func runDraftPost(env *command.Env, args []string) error {
+	if len(args) != 1 {
+		return command.FailWithUsage(env, args)
+	}
+	s, err := openDrafts(env)
+	if err != nil {
+		return err
+	}
+	d, err := s.load(args[0])
+	if err != nil {
+		return err
+	}
+	p, err := d.post()
+	if err != nil {
+		return fmt.Errorf("draft %q: %w", d.Name, err)
+	} else if err := cmdtweet.CheckText(d.Text); err != nil {
+		return fmt.Errorf("draft %q: %w", d.Name, err)
+	}
+
+	cfg := env.Config.(*config.Config)
+	cli, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+	tw, err := p.Send(cfg.Context(), env, cli, types.TweetFields{})
+	if err != nil {
+		return err
+	}
+	if err := config.PrintJSON(tw); err != nil {
+		return err
+	}
+	if !draftOpts.keep {
+		return s.remove(d.Name)
+	}
+	return nil
+}
+
+// editFlag reports whether the -e flag of "tweet create" is set on the
+// command line of cmd.
+func editFlag(cmd *command.C) bool {
+	f := cmd.Flags.Lookup("e")
+	return f != nil && f.Value.String() == "true"
+}
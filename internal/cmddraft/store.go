@@ -0,0 +1,257 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmddraft
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creachadair/atomicfile"
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/cmdtweet"
+)
+
+// A Draft is a tweet saved to be posted later. Each draft is stored as a JSON
+// file in the drafts directory, named by the draft name.
+type Draft struct {
+	Name          string       `json:"name"`
+	Text          string       `json:"text"`
+	InReplyTo     string       `json:"in_reply_to,omitempty"`
+	AutoPopReply  bool         `json:"auto_reply,omitempty"`
+	Quote         string       `json:"quote,omitempty"`
+	ReplySettings string       `json:"reply_settings,omitempty"`
+	ExcludeReply  []string     `json:"exclude_reply_users,omitempty"`
+	Media         []DraftMedia `json:"media,omitempty"`
+	Poll          []string     `json:"poll,omitempty"`
+	PollMinutes   int          `json:"poll_minutes,omitempty"`
+	Author        string       `json:"author,omitempty"` // the -auth-user who saved it, if any
+	Created       time.Time    `json:"created"`
+	Updated       time.Time    `json:"updated"`
+}
+
+// DraftMedia is a media file attached to a draft.
+type DraftMedia struct {
+	Path string `json:"path"` // absolute
+	Alt  string `json:"alt,omitempty"`
+}
+
+// post returns the post described by d, after checking that its options and
+// media files are valid.
+func (d *Draft) post() (*cmdtweet.Post, error) {
+	o := cmdtweet.PostOptions{
+		Text:          d.Text,
+		InReplyTo:     d.InReplyTo,
+		AutoPopReply:  d.AutoPopReply,
+		Poll:          d.Poll,
+		PollMinutes:   d.PollMinutes,
+		Quote:         d.Quote,
+		ReplySettings: d.ReplySettings,
+		ExcludeReply:  d.ExcludeReply,
+	}
+	for _, m := range d.Media {
+		o.Media = append(o.Media, m.Path)
+		o.Alt = append(o.Alt, m.Alt)
+	}
+	return cmdtweet.NewPost(o)
+}
+
+// setFromFlags updates d with the post options set on the command line of
+// env. If all is true, every option is set, whether or not its flag was.
+func (d *Draft) setFromFlags(env *command.Env, all bool) error {
+	o, err := cmdtweet.PostFlags()
+	if err != nil {
+		return err
+	}
+	set := func(name string) bool { return all || isFlagSet(env.Command, name) }
+	if set("reply-to") {
+		d.InReplyTo = o.InReplyTo
+	}
+	if set("auto-reply") {
+		d.AutoPopReply = o.AutoPopReply
+	}
+	if set("quote") {
+		d.Quote = o.Quote
+	}
+	if set("reply-settings") {
+		d.ReplySettings = o.ReplySettings
+	}
+	if set("exclude-reply-user") {
+		d.ExcludeReply = o.ExcludeReply
+	}
+	if set("media") {
+		d.Media = nil
+		for _, path := range o.Media {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			d.Media = append(d.Media, DraftMedia{Path: abs})
+		}
+	}
+	if set("alt") {
+		if len(o.Alt) > len(d.Media) {
+			return fmt.Errorf("got %d -alt texts for %d media files", len(o.Alt), len(d.Media))
+		}
+		for i := range d.Media {
+			d.Media[i].Alt = ""
+			if i < len(o.Alt) {
+				d.Media[i].Alt = o.Alt[i]
+			}
+		}
+	}
+	if set("poll") {
+		d.Poll = o.Poll
+	}
+	if set("poll-minutes") || d.PollMinutes == 0 {
+		d.PollMinutes = o.PollMinutes
+	}
+	if len(d.Poll) == 0 {
+		if isFlagSet(env.Command, "poll-minutes") {
+			return errors.New("-poll-minutes requires -poll")
+		}
+		d.PollMinutes = 0
+	}
+	return nil
+}
+
+// isFlagSet reports whether the flag with the given name was set on the
+// command line of cmd.
+func isFlagSet(cmd *command.C, name string) (ok bool) {
+	cmd.Flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			ok = true
+		}
+	})
+	return
+}
+
+// draftNamePattern matches valid draft names, which are used as filenames.
+var draftNamePattern = regexp.MustCompile(`^[A-Za-z0-9][\w.-]*$`)
+
+// A draftStore is a directory of drafts.
+type draftStore struct{ dir string }
+
+func openDrafts(env *command.Env) (draftStore, error) {
+	cfg := env.Config.(*config.Config)
+	dir, err := config.DataPath(cfg.DraftDir, "drafts")
+	if err != nil {
+		return draftStore{}, err
+	}
+	return draftStore{dir: dir}, nil
+}
+
+func (s draftStore) path(name string) (string, error) {
+	if !draftNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid draft name %q", name)
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// load reads the draft with the given name.
+func (s draftStore) load(name string) (*Draft, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no draft named %q", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("reading draft: %w", err)
+	}
+	d := new(Draft)
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, fmt.Errorf("decoding draft %q: %w", name, err)
+	}
+	return d, nil
+}
+
+// save writes d to the store, replacing any draft with the same name.
+func (s draftStore) save(d *Draft) error {
+	path, err := s.path(d.Name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteData(path, data, 0600); err != nil {
+		return fmt.Errorf("writing draft: %w", err)
+	}
+	return nil
+}
+
+// remove deletes the draft with the given name.
+func (s draftStore) remove(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no draft named %q", name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// list returns all the drafts in the store, ordered by name.
+func (s draftStore) list() ([]*Draft, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Draft
+	for _, path := range paths {
+		d, err := s.load(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return draftLess(out[i].Name, out[j].Name) })
+	return out, nil
+}
+
+// nextName returns the smallest numeric name greater than the names of the
+// drafts in the store.
+func (s draftStore) nextName() (string, error) {
+	ds, err := s.list()
+	if err != nil {
+		return "", err
+	}
+	next := 1
+	for _, d := range ds {
+		if n, err := strconv.Atoi(d.Name); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+	return strconv.Itoa(next), nil
+}
+
+// draftLess orders numeric names numerically, before other names.
+func draftLess(a, b string) bool {
+	na, aerr := strconv.Atoi(a)
+	nb, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return na < nb
+	case aerr == nil || berr == nil:
+		return aerr == nil
+	}
+	return a < b
+}
@@ -204,6 +204,80 @@ the sum of terms from the following list:
 
 For example, to log the request URL and the response body, set -log-level 9.
 To log all of these items, set -log-level 15.
+`,
+	},
+	{
+		Name: "dry-run",
+		Help: `
+Help for the -dry-run command-line flag.
+
+When the -dry-run flag is set, commands that would modify state (creating
+or deleting tweets, likes, retweets, lists, list members, and stream rules)
+print the HTTP method, URL, and request body they would send, instead of
+sending them. For example:
+
+  twig -dry-run -auth-user me list add-member 12345 @alice
+
+Requests that only read data, such as resolving @usernames to user IDs,
+are still sent, so that the printed requests are exactly those that would
+be sent without -dry-run.
+`,
+	},
+	{
+		Name: "record",
+		Help: `
+Help for the -record and -replay command-line flags.
+
+When -record is set to a directory, each request sent to the API and the
+response received are saved as a numbered JSON file in that directory.
+Authorization headers are redacted, so the files do not contain your
+credentials, but check them for other private data before sharing.
+Recording into a directory that already has files adds to them, so
+several commands can be recorded in sequence.
+
+When -replay is set to a directory of recorded files, responses are served
+from those files and nothing is sent over the network. A request is matched
+to a recording by its method, path, and query parameters; repeated requests
+get their responses in the order they were recorded. For example:
+
+  twig -record /tmp/bug lookup 1234567890
+  twig -replay /tmp/bug lookup 1234567890
+`,
+	},
+	{
+		Name: "config",
+		Help: `
+Help on configuration file settings.
+
+The configuration file (set with -config) is a YAML file with the
+following settings. Only the credentials are required.
+
+  api_key, api_secret         : application credentials
+  access_token, access_secret : application access token
+  bearer_token                : bearer token for app-only requests
+  users                       : list of {username, token, secret} entries
+                                for use with -auth-user
+
+  cache_file                  : path of the username cache
+  cache_ttl                   : lifetime of username cache entries (e.g., 48h)
+  confirm_remove_above        : confirm removing more than this many list members
+  schedule_file               : path of the queue of scheduled tweets
+  draft_dir                   : directory of saved drafts
+  archive_dir                 : directory of the local archive
+  archive_seen                : save tweets and users seen by lookup, search,
+                                timeline, and stream in the local archive
+
+  api_base_url                : base URL of the API (e.g., a mock server)
+  upload_base_url             : base URL for media uploads (default is
+                                api_base_url if set, else upload.twitter.com)
+  proxy                       : http, https, or socks5 proxy URL
+  ca_bundle                   : file of extra trusted CA certificates (PEM)
+  user_agent                  : User-Agent header for API requests
+  connect_timeout             : time limit for connecting (e.g., 10s)
+  response_timeout            : time limit for response headers (e.g., 30s)
+
+The api_base_url, proxy, ca_bundle, user_agent, and connect_timeout
+settings can also be set by command-line flags, which take precedence.
 `,
 	},
 }
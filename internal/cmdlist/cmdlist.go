@@ -4,12 +4,14 @@ package cmdlist
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"strings"
 
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
 	"github.com/creachadair/twitter/lists"
 	"github.com/creachadair/twitter/types"
 	"github.com/creachadair/twitter/users"
@@ -19,9 +21,7 @@ var Command = &command.C{
 	Name: "list",
 	Help: "Commands to interact with user lists.",
 
-	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
-		fs.IntVar(&opts.maxResults, "max", 0, "Maximum results to return (0 means all)")
-	},
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) { opts.SetFlags(fs) },
 
 	Commands: []*command.C{
 		{
@@ -40,7 +40,8 @@ var Command = &command.C{
 			Help:  "Fetch information about the lists owned by user-id.",
 			Run: runList(func(parsed config.ParsedArgs) lists.Query {
 				return lists.OwnedBy(parsed.Keys[0], &lists.ListOpts{
-					MaxResults: maxQueryResults(),
+					PageToken:  opts.PageToken,
+					MaxResults: config.PageSize(opts.MaxResults, 10),
 					Optional:   parsed.Fields,
 				})
 			}),
@@ -51,7 +52,8 @@ var Command = &command.C{
 			Help:  "Fetch the followers of the specified user.",
 			Run: runUsers(func(parsed config.ParsedArgs) users.Query {
 				return users.FollowersOf(parsed.Keys[0], &users.ListOpts{
-					MaxResults: maxQueryResults(),
+					PageToken:  opts.PageToken,
+					MaxResults: config.PageSize(opts.MaxResults, 10),
 					Optional:   parsed.Fields,
 				})
 			}),
@@ -62,7 +64,8 @@ var Command = &command.C{
 			Help:  "Fetch the users followed by the specified user.",
 			Run: runUsers(func(parsed config.ParsedArgs) users.Query {
 				return users.FollowedBy(parsed.Keys[0], &users.ListOpts{
-					MaxResults: maxQueryResults(),
+					PageToken:  opts.PageToken,
+					MaxResults: config.PageSize(opts.MaxResults, 10),
 					Optional:   parsed.Fields,
 				})
 			}),
@@ -81,12 +84,13 @@ var Command = &command.C{
 				name := args[0]
 				desc := strings.Join(args[1:], " ")
 
-				cli, err := env.Config.(*config.Config).NewClient()
+				cfg := env.Config.(*config.Config)
+				cli, err := cfg.NewClient()
 				if err != nil {
 					return fmt.Errorf("creating client: %w", err)
 				}
 
-				rsp, err := lists.Create(name, desc, opts.private).Invoke(context.Background(), cli)
+				rsp, err := lists.Create(name, desc, opts.private).Invoke(cfg.Context(), cli)
 				if err != nil {
 					return err
 				}
@@ -96,17 +100,34 @@ var Command = &command.C{
 		{
 			Name:  "delete",
 			Usage: "id",
-			Help:  "Delete the list with the specified id.",
+			Help: `Delete the list with the specified id.
+
+Before deleting, the list is fetched and shown, and you are asked to
+confirm the deletion. Set -yes to skip confirmation, for example in a script.`,
 			Run: func(env *command.Env, args []string) error {
 				if len(args) == 0 {
 					return command.FailWithUsage(env, args)
 				}
-				cli, err := env.Config.(*config.Config).NewClient()
+				cfg := env.Config.(*config.Config)
+				cli, err := cfg.NewClient()
 				if err != nil {
 					return fmt.Errorf("creating client: %w", err)
 				}
 
-				ok, err := lists.Delete(args[0]).Invoke(context.Background(), cli)
+				listID := config.ParseKey(args[0])
+				if cfg.NeedConfirm() {
+					lst, err := lookupList(cfg.Context(), cli, listID)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(env, "List %s %q has %d members and %d followers.\n",
+						lst.ID, lst.Name, lst.Members, lst.Followers)
+					if err := cfg.Confirm(env, "Delete this list?"); err != nil {
+						return err
+					}
+				}
+
+				ok, err := lists.Delete(listID).Invoke(cfg.Context(), cli)
 				if err != nil {
 					return err
 				}
@@ -138,12 +159,13 @@ var Command = &command.C{
 					uopts.SetPrivate(opts.private)
 				}
 
-				cli, err := env.Config.(*config.Config).NewClient()
+				cfg := env.Config.(*config.Config)
+				cli, err := cfg.NewClient()
 				if err != nil {
 					return fmt.Errorf("creating client: %w", err)
 				}
 
-				ok, err := lists.Update(args[0], uopts).Invoke(context.Background(), cli)
+				ok, err := lists.Update(config.ParseKey(args[0]), uopts).Invoke(cfg.Context(), cli)
 				if err != nil {
 					return err
 				}
@@ -154,27 +176,37 @@ var Command = &command.C{
 		{
 			Name:  "add-member",
 			Usage: "list-id user-id...",
-			Help:  "Add the given user ids to the specified list id.",
+			Help: `Add the given user ids to the specified list id.
+
+A user argument "-" reads user IDs or @usernames from stdin, one per line,
+and "@file" reads them from the named file.`,
 			Run: func(env *command.Env, args []string) error {
 				if len(args) < 2 {
 					return command.FailWithUsage(env, args)
 				}
 
-				ctx := context.Background()
-				cli, err := env.Config.(*config.Config).NewClient()
+				cfg := env.Config.(*config.Config)
+				ctx := cfg.Context()
+				cli, err := cfg.NewClient()
 				if err != nil {
 					return fmt.Errorf("creating client: %w", err)
 				}
 
-				listID := args[0]
-				users, err := config.ResolveID(ctx, cli, args[1:])
+				listID := config.ParseKey(args[0])
+				keys, err := config.ReadKeys(args[1:])
+				if err != nil {
+					return err
+				}
+				users, err := cfg.ResolveID(ctx, cli, keys)
 				if err != nil {
 					return err
 				}
 
 				for _, userID := range users {
 					ok, err := lists.AddMember(listID, userID).Invoke(ctx, cli)
-					if err != nil {
+					if errors.Is(err, config.ErrDryRun) {
+						continue
+					} else if err != nil {
 						return fmt.Errorf("add user %q: %w", userID, err)
 					}
 					fmt.Printf("%s: %v\n", userID, ok)
@@ -185,27 +217,52 @@ var Command = &command.C{
 		{
 			Name:  "remove-member",
 			Usage: "list-id user-id...",
-			Help:  "Remove the given user ids from the specified list id.",
+			Help: `Remove the given user ids from the specified list id.
+
+A user argument "-" reads user IDs or @usernames from stdin, one per line,
+and "@file" reads them from the named file.
+
+If the confirm_remove_above setting in the config file is positive, and
+more than that many users are to be removed, you are asked to confirm.
+Set -yes to skip confirmation, for example in a script.`,
 			Run: func(env *command.Env, args []string) error {
 				if len(args) < 2 {
 					return command.FailWithUsage(env, args)
 				}
 
-				ctx := context.Background()
-				cli, err := env.Config.(*config.Config).NewClient()
+				cfg := env.Config.(*config.Config)
+				ctx := cfg.Context()
+				cli, err := cfg.NewClient()
 				if err != nil {
 					return fmt.Errorf("creating client: %w", err)
 				}
 
-				listID := args[0]
-				users, err := config.ResolveID(ctx, cli, args[1:])
+				listID := config.ParseKey(args[0])
+				keys, err := config.ReadKeys(args[1:])
+				if err != nil {
+					return err
+				}
+				users, err := cfg.ResolveID(ctx, cli, keys)
 				if err != nil {
 					return err
 				}
 
+				if n := cfg.ConfirmRemoveAbove; n > 0 && len(users) > n && cfg.NeedConfirm() {
+					lst, err := lookupList(ctx, cli, listID)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(env, "List %s %q has %d members.\n", lst.ID, lst.Name, lst.Members)
+					if err := cfg.Confirm(env, fmt.Sprintf("Remove %d members from this list?", len(users))); err != nil {
+						return err
+					}
+				}
+
 				for _, userID := range users {
 					ok, err := lists.RemoveMember(listID, userID).Invoke(ctx, cli)
-					if err != nil {
+					if errors.Is(err, config.ErrDryRun) {
+						continue
+					} else if err != nil {
 						return fmt.Errorf("add user %q: %w", userID, err)
 					}
 					fmt.Printf("%s: %v\n", userID, !ok)
@@ -219,7 +276,8 @@ var Command = &command.C{
 			Help:  "Fetch the members of the specified list.",
 			Run: runUsers(func(parsed config.ParsedArgs) users.Query {
 				return lists.Members(parsed.Keys[0], &lists.ListOpts{
-					MaxResults: maxQueryResults(),
+					PageToken:  opts.PageToken,
+					MaxResults: config.PageSize(opts.MaxResults, 10),
 					Optional:   parsed.Fields,
 				})
 			}),
@@ -230,7 +288,8 @@ var Command = &command.C{
 			Help:  "Fetch the followers of the specified list.",
 			Run: runUsers(func(parsed config.ParsedArgs) users.Query {
 				return lists.Followers(parsed.Keys[0], &lists.ListOpts{
-					MaxResults: maxQueryResults(),
+					PageToken:  opts.PageToken,
+					MaxResults: config.PageSize(opts.MaxResults, 10),
 					Optional:   parsed.Fields,
 				})
 			}),
@@ -239,18 +298,9 @@ var Command = &command.C{
 }
 
 var opts struct {
-	maxResults int
-	fields     types.UserFields
-	private    bool
-}
-
-func maxQueryResults() int {
-	if opts.maxResults <= 0 || opts.maxResults > 100 {
-		return 100
-	} else if opts.maxResults < 10 {
-		return 10
-	}
-	return opts.maxResults
+	config.PageOpts
+	fields  types.UserFields
+	private bool
 }
 
 func isSet(fs flag.FlagSet, name string) (s string, ok bool) {
@@ -263,6 +313,19 @@ func isSet(fs flag.FlagSet, name string) (s string, ok bool) {
 	return
 }
 
+// lookupList fetches the name and member counts of the specified list.
+func lookupList(ctx context.Context, cli *twitter.Client, listID string) (*types.List, error) {
+	rsp, err := lists.Lookup(listID, &lists.ListOpts{
+		Optional: []types.Fields{types.ListFields{Followers: true, Members: true}},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		return nil, fmt.Errorf("looking up list: %w", err)
+	} else if len(rsp.Lists) == 0 {
+		return nil, fmt.Errorf("list %q not found", listID)
+	}
+	return rsp.Lists[0], nil
+}
+
 func runList(newQuery func(config.ParsedArgs) lists.Query) func(*command.Env, []string) error {
 	return func(env *command.Env, args []string) error {
 		parsed := config.ParseArgs(args, "list")
@@ -271,38 +334,27 @@ func runList(newQuery func(config.ParsedArgs) lists.Query) func(*command.Env, []
 			return command.FailWithUsage(env, args)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
 
-		ctx := context.Background()
-		if ids, err := config.ResolveID(ctx, cli, parsed.Keys); err != nil {
+		ctx := cfg.Context()
+		if ids, err := cfg.ResolveID(ctx, cli, parsed.Keys); err != nil {
 			return fmt.Errorf("resolving users: %w", err)
 		} else {
 			parsed.Keys = ids
 		}
 
 		q := newQuery(parsed)
-		var numResults int
-		for q.HasMorePages() {
+		return config.Paginate(env, q.Request, opts.MaxResults, q.HasMorePages, func() ([]*types.List, error) {
 			rsp, err := q.Invoke(ctx, cli)
 			if err != nil {
-				return err
-			}
-			lst := rsp.Lists
-			numResults += len(lst)
-			if opts.maxResults > 0 && numResults > opts.maxResults {
-				lst = lst[:len(lst)-(numResults-opts.maxResults)]
-			}
-			if err := config.PrintJSON(lst); err != nil {
-				return err
+				return nil, err
 			}
-			if opts.maxResults > 0 && numResults >= opts.maxResults {
-				return nil // nothing more to do
-			}
-		}
-		return nil
+			return rsp.Lists, nil
+		})
 	}
 }
 
@@ -314,37 +366,26 @@ func runUsers(newQuery func(config.ParsedArgs) users.Query) func(*command.Env, [
 			return command.FailWithUsage(env, args)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
 
-		ctx := context.Background()
-		if ids, err := config.ResolveID(ctx, cli, parsed.Keys); err != nil {
+		ctx := cfg.Context()
+		if ids, err := cfg.ResolveID(ctx, cli, parsed.Keys); err != nil {
 			return fmt.Errorf("resolving users: %w", err)
 		} else {
 			parsed.Keys = ids
 		}
 
 		q := newQuery(parsed)
-		var numResults int
-		for q.HasMorePages() {
+		return config.Paginate(env, q.Request, opts.MaxResults, q.HasMorePages, func() ([]*types.User, error) {
 			rsp, err := q.Invoke(ctx, cli)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			users := rsp.Users
-			numResults += len(users)
-			if opts.maxResults > 0 && numResults > opts.maxResults {
-				users = users[:len(users)-(numResults-opts.maxResults)]
-			}
-			if err := config.PrintJSON(users); err != nil {
-				return err
-			}
-			if opts.maxResults > 0 && numResults >= opts.maxResults {
-				return nil // nothing more to do
-			}
-		}
-		return nil
+			return rsp.Users, nil
+		})
 	}
 }
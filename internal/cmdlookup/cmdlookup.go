@@ -9,6 +9,7 @@ import (
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
 	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
 )
 
 var Command = &command.C{
@@ -20,26 +21,51 @@ Look up the specified tweets by ID.
 Each argument is either a tweet ID or field specifier.
 A field specifier has the form type:field, e.g., "tweet:entities".
 As a special case, :field is shorthand for "tweet:field".
+
+An argument "-" reads tweet IDs from stdin, one per line, and "@file"
+reads them from the named file. Lines containing JSON objects, such as
+the output of the search command, contribute their "id" field.
+
+Any number of keys may be given. Keys beyond the API limit of 100 per
+request are looked up in multiple batches, and the results are printed
+in the order of the keys.
 `,
 
 	Run: func(env *command.Env, args []string) error {
 		parsed := config.ParseArgs(args, "tweet")
+		keys, err := config.ReadKeys(parsed.Keys)
+		if err != nil {
+			return err
+		}
+		parsed.Keys = keys
 		if len(parsed.Keys) == 0 {
 			fmt.Fprintln(env, "Error: no tweet IDs were specified")
 			return command.FailWithUsage(env, args)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
-		rsp, err := tweets.Lookup(parsed.Keys[0], &tweets.LookupOpts{
-			More:     parsed.Keys[1:],
-			Optional: parsed.Fields,
-		}).Invoke(context.Background(), cli)
-		if err != nil {
-			return err
+		tw, err := config.Batch(cfg.Context(), parsed.Keys, func(ctx context.Context, ids []string) (types.Tweets, error) {
+			rsp, err := tweets.Lookup(ids[0], &tweets.LookupOpts{
+				More:     ids[1:],
+				Optional: parsed.Fields,
+			}).Invoke(ctx, cli)
+			if err != nil {
+				return nil, err
+			}
+			users, err := rsp.IncludedUsers()
+			if err != nil {
+				return nil, err
+			}
+			cfg.RecordSeen(rsp.Tweets, users)
+			return rsp.Tweets, config.ItemErrors(rsp.Errors)
+		})
+		if perr := config.PrintJSON(tw); perr != nil {
+			return perr
 		}
-		return config.PrintJSON(rsp.Tweets)
+		return err
 	},
 }
@@ -3,7 +3,6 @@
 package cmdrules
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
@@ -33,12 +32,13 @@ rules are listed.
 `,
 
 	Run: func(env *command.Env, args []string) error {
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
 
-		rsp, err := rules.Get(args...).Invoke(context.Background(), cli)
+		rsp, err := rules.Get(args...).Invoke(cfg.Context(), cli)
 		if err != nil {
 			return err
 		}
@@ -57,11 +57,12 @@ var cmdDelete = &command.C{
 			return command.FailWithUsage(env, args)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
-		rsp, err := rules.Update(rules.Deletes(args)).Invoke(context.Background(), cli)
+		rsp, err := rules.Update(rules.Deletes(args)).Invoke(cfg.Context(), cli)
 		if err != nil {
 			return err
 		}
@@ -94,11 +95,12 @@ If a tag= prefix is given, the rule is labelled with that tag.
 			adds = append(adds, rule)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
-		rsp, err := rules.Update(adds).Invoke(context.Background(), cli)
+		rsp, err := rules.Update(adds).Invoke(cfg.Context(), cli)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,456 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdschedule
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/cmdtweet"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/ostatus"
+)
+
+// maxRetryDelay is the longest the runner waits to retry a failed post.
+const maxRetryDelay = time.Hour
+
+// maxPostTime is the longest a runner may take to post a tweet. A tweet
+// claimed by a runner longer ago than this was left by a runner that stopped
+// while posting it.
+const maxPostTime = 10 * time.Minute
+
+var addOpts struct {
+	at        string
+	inReplyTo string
+}
+
+var editOpts struct {
+	at        string
+	inReplyTo string
+}
+
+var listOpts struct {
+	all bool
+}
+
+var runOpts struct {
+	once        bool
+	maxAttempts int
+	retryDelay  time.Duration
+	poll        time.Duration
+}
+
+var Command = &command.C{
+	Name: "schedule",
+	Help: `Commands to schedule tweets to be posted later.
+
+Scheduled tweets are kept in a local queue (see schedule_file in "help config"),
+and are posted by "schedule run", which must be running (or be run, for
+example by cron with -once) when they are due. Each tweet is posted as the
+-auth-user that scheduled it.
+
+Times may be given as an RFC 3339 timestamp ("2023-05-01T09:30:00-07:00"),
+a local date and time ("2023-05-01 09:30"), a local time of day ("09:30",
+meaning the next time the clock shows that time), or a duration from now
+("+90m").`,
+	Commands: []*command.C{
+		{
+			Name:  "add",
+			Usage: "-at TIME text... | -",
+			Help: `Schedule a tweet with the given text to be posted at a later time.
+
+If the text is "-", it is read from stdin. The text is checked when it is
+added, so that a tweet that is too long is reported right away.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+				fs.StringVar(&addOpts.at, "at", "", "When to post the tweet (required)")
+				fs.StringVar(&addOpts.inReplyTo, "reply-to", "", "Reply to this tweet ID or URL")
+			},
+			Run: runAdd,
+		},
+		{
+			Name: "list",
+			Help: `List scheduled tweets that have not been posted yet.
+
+Set -all to include tweets that were posted, cancelled, or failed.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+				fs.BoolVar(&listOpts.all, "all", false, "List all tweets, including those already handled")
+			},
+			Run: runList,
+		},
+		{
+			Name:  "cancel",
+			Usage: "id ...",
+			Help:  "Cancel the scheduled tweets with the given IDs.",
+			Run:   runCancel,
+		},
+		{
+			Name:  "edit",
+			Usage: "id [text... | -]",
+			Help: `Change the time, reply, or text of a scheduled tweet.
+
+Any text given replaces the text of the tweet. Editing a tweet that failed
+puts it back in the queue, with its attempts reset.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+				fs.StringVar(&editOpts.at, "at", "", "When to post the tweet")
+				fs.StringVar(&editOpts.inReplyTo, "reply-to", "", "Reply to this tweet ID or URL")
+			},
+			Run: runEdit,
+		},
+		{
+			Name: "run",
+			Help: `Post scheduled tweets as they come due.
+
+The runner waits until the next tweet is due, posts it, and records the
+result in the queue. Tweets added while the runner is waiting are noticed
+within the -poll interval. Each tweet posted is printed as it is posted.
+
+If posting a tweet fails, it is retried after -retry-delay, doubling the
+delay after each failure up to one hour. After -max-attempts failures, the
+tweet is marked failed and not retried; use "schedule edit" to retry it.
+
+Set -once to post the tweets that are due and exit, instead of waiting.
+
+Several runners may share a queue, for example a cron job with -once and a
+runner that is always waiting, and each tweet is posted by only one of them.
+If a runner stops while it is posting a tweet, the tweet is marked failed,
+since it may have been posted; check, and use "schedule edit" to retry it.`,
+			SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+				fs.BoolVar(&runOpts.once, "once", false, "Post the tweets that are due, then exit")
+				fs.IntVar(&runOpts.maxAttempts, "max-attempts", 5, "Give up on a tweet after this many failures")
+				fs.DurationVar(&runOpts.retryDelay, "retry-delay", time.Minute, "Wait this long to retry after the first failure")
+				fs.DurationVar(&runOpts.poll, "poll", time.Minute, "Check for new tweets this often while waiting")
+			},
+			Run: runRun,
+		},
+	},
+}
+
+func runAdd(env *command.Env, args []string) error {
+	if addOpts.at == "" {
+		return errors.New("missing required -at time")
+	}
+	cfg := env.Config.(*config.Config)
+	if cfg.AuthUser == "" {
+		return errors.New("scheduling a tweet requires -auth-user")
+	} else if cfg.FindUsername(cfg.AuthUser) == nil {
+		return fmt.Errorf("no access token found for user %q", cfg.AuthUser)
+	}
+	now := time.Now()
+	at, err := parseTime(addOpts.at, now)
+	if err != nil {
+		return err
+	}
+	text, err := readText(args)
+	if err != nil {
+		return err
+	}
+	e := &Entry{
+		At:        at,
+		User:      cfg.AuthUser,
+		Text:      text,
+		InReplyTo: config.ParseKey(addOpts.inReplyTo),
+		State:     statePending,
+		Created:   now.UTC().Truncate(time.Second),
+	}
+	if err := updateQueue(cfg, func(q *queue) error {
+		q.add(e)
+		return nil
+	}); err != nil {
+		return err
+	}
+	return config.PrintJSON(e)
+}
+
+func runList(env *command.Env, args []string) error {
+	if len(args) != 0 {
+		return command.FailWithUsage(env, args)
+	}
+	q, err := loadQueue(env.Config.(*config.Config))
+	if err != nil {
+		return err
+	}
+	for _, e := range q.Entries {
+		if listOpts.all || e.State == statePending || e.State == statePosting {
+			if err := config.PrintJSON(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runCancel(env *command.Env, args []string) error {
+	if len(args) == 0 {
+		return command.FailWithUsage(env, args)
+	}
+	if err := updateQueue(env.Config.(*config.Config), func(q *queue) error {
+		for _, id := range args {
+			e, err := q.find(id)
+			if err != nil {
+				return err
+			} else if e.State != statePending {
+				return fmt.Errorf("cannot cancel tweet %s: it is %s", id, e.State)
+			}
+			e.State = stateCancelled
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("cancelled: %d tweets\n", len(args))
+	return nil
+}
+
+func runEdit(env *command.Env, args []string) error {
+	if len(args) == 0 {
+		return command.FailWithUsage(env, args)
+	}
+	var at time.Time
+	var text string
+	var err error
+	if editOpts.at != "" {
+		at, err = parseTime(editOpts.at, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		text, err = readText(args[1:])
+		if err != nil {
+			return err
+		}
+	}
+	var e *Entry
+	if err := updateQueue(env.Config.(*config.Config), func(q *queue) error {
+		e, err = q.find(args[0])
+		if err != nil {
+			return err
+		} else if e.State != statePending && e.State != stateFailed {
+			return fmt.Errorf("cannot edit tweet %s: it is %s", e.ID, e.State)
+		}
+		if !at.IsZero() {
+			e.At = at
+		}
+		if editOpts.inReplyTo != "" {
+			e.InReplyTo = config.ParseKey(editOpts.inReplyTo)
+		}
+		if text != "" {
+			e.Text = text
+		}
+		e.State = statePending
+		e.Attempts, e.RetryAt, e.LastError = 0, nil, ""
+		return nil
+	}); err != nil {
+		return err
+	}
+	return config.PrintJSON(e)
+}
+
+func runRun(env *command.Env, args []string) error {
+	if len(args) != 0 {
+		return command.FailWithUsage(env, args)
+	} else if runOpts.maxAttempts < 1 {
+		return errors.New("-max-attempts must be positive")
+	} else if runOpts.retryDelay <= 0 || runOpts.poll <= 0 {
+		return errors.New("-retry-delay and -poll must be positive")
+	}
+	cfg := env.Config.(*config.Config)
+	host, _ := os.Hostname()
+	r := &runner{
+		env:     env,
+		cfg:     cfg,
+		id:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+		clients: make(map[string]*twitter.Client),
+		skip:    make(map[string]bool),
+	}
+	ctx := cfg.Context()
+	for {
+		next, err := r.postDue(ctx)
+		if config.Interrupted(err) {
+			return nil
+		} else if err != nil || runOpts.once {
+			return err
+		}
+
+		wait := runOpts.poll
+		if !next.IsZero() {
+			if d := time.Until(next); d < wait {
+				wait = d
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// A runner posts scheduled tweets.
+type runner struct {
+	env     *command.Env
+	cfg     *config.Config
+	id      string                     // identifies the runner in claimed entries
+	clients map[string]*twitter.Client // by username
+	skip    map[string]bool            // entries not to post again in this run
+}
+
+// postDue posts all the tweets that are due, and returns the time the next
+// tweet is due, or zero if there are none. Each tweet is attempted at most once
+// per call, even if a failed tweet is due to be retried before it returns.
+//
+// Before posting a tweet, the runner claims it in the queue, so that other
+// runners sharing the queue do not post it too.
+func (r *runner) postDue(ctx context.Context) (time.Time, error) {
+	tried := make(map[string]bool) // entries attempted in this call
+	for {
+		todo, next, err := r.claimDue(tried)
+		if err != nil {
+			return time.Time{}, err
+		} else if todo == nil {
+			return next, nil
+		}
+		tried[todo.ID] = true
+		todo.Runner, todo.Claimed = "", nil // the claim is recorded in the queue
+		perr := r.post(ctx, todo)
+		if todo.State == statePosting {
+			todo.State = statePending // not posted, so it may be tried again
+		}
+
+		// Record the outcome and release the claim. The queue may have changed
+		// while the tweet was being posted, so update the current queue rather
+		// than saving the copy loaded before posting.
+		if err := updateQueue(r.cfg, func(q *queue) error {
+			e, err := q.find(todo.ID)
+			if err != nil || e.State != statePosting || e.Runner != r.id {
+				return errUnchanged // no longer ours; nothing to record
+			}
+			e.State, e.Attempts, e.RetryAt, e.LastError = todo.State, todo.Attempts, todo.RetryAt, todo.LastError
+			e.Posted, e.TweetID = todo.Posted, todo.TweetID
+			e.Runner, e.Claimed = "", nil
+			return nil
+		}); err != nil {
+			return time.Time{}, err
+		} else if perr != nil {
+			return time.Time{}, perr
+		}
+	}
+}
+
+// claimDue finds a tweet that is due and has not been tried, and claims it
+// for r. It returns the claimed entry, or nil if none is due, along with the
+// time the next tweet is due, or zero if there are none.
+func (r *runner) claimDue(tried map[string]bool) (todo *Entry, next time.Time, err error) {
+	err = updateQueue(r.cfg, func(q *queue) error {
+		changed := false
+		now := time.Now()
+		for _, e := range q.Entries {
+			if e.State == statePosting && e.Claimed != nil && now.Sub(*e.Claimed) > maxPostTime {
+				e.State = stateFailed
+				e.LastError = fmt.Sprintf("runner %s stopped while posting; check whether the tweet was posted", e.Runner)
+				e.Runner, e.Claimed = "", nil
+				changed = true
+				fmt.Fprintf(r.env, "Tweet %s: %s\n", e.ID, e.LastError)
+				continue
+			}
+			at, ok := e.due()
+			if !ok || r.skip[e.ID] {
+				continue
+			} else if todo == nil && !at.After(now) && !tried[e.ID] {
+				todo = e
+			} else if next.IsZero() || at.Before(next) {
+				next = at
+			}
+		}
+		if todo == nil {
+			if !changed {
+				return errUnchanged
+			}
+			return nil
+		}
+		claimed := now.UTC()
+		todo.State, todo.Runner, todo.Claimed = statePosting, r.id, &claimed
+		return nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return todo, next, nil
+}
+
+// post posts e and updates it with the result. It reports an error only if
+// the runner should stop.
+func (r *runner) post(ctx context.Context, e *Entry) error {
+	cli, err := r.client(e.User)
+	if err == nil {
+		var rsp *ostatus.Reply
+		rsp, err = ostatus.Create(e.Text, &ostatus.CreateOpts{InReplyTo: e.InReplyTo}).Invoke(ctx, cli)
+		if err == nil && len(rsp.Tweets) == 0 {
+			err = errors.New("no tweet was returned")
+		} else if err == nil {
+			now := time.Now().UTC().Truncate(time.Second)
+			e.State, e.Posted, e.TweetID = statePosted, &now, rsp.Tweets[0].ID
+			e.RetryAt, e.LastError = nil, ""
+			return config.PrintJSON(e)
+		}
+	}
+	if errors.Is(err, config.ErrDryRun) {
+		r.skip[e.ID] = true
+		return nil
+	} else if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	e.Attempts++
+	e.LastError = err.Error()
+	if e.Attempts >= runOpts.maxAttempts {
+		e.State = stateFailed
+		fmt.Fprintf(r.env, "Tweet %s failed (attempt %d of %d), giving up: %v\n", e.ID, e.Attempts, runOpts.maxAttempts, err)
+		return nil
+	}
+	delay := runOpts.retryDelay << (e.Attempts - 1)
+	if delay > maxRetryDelay || delay < runOpts.retryDelay { // or overflowed
+		delay = maxRetryDelay
+	}
+	retry := time.Now().Add(delay).UTC()
+	e.RetryAt = &retry
+	fmt.Fprintf(r.env, "Tweet %s failed (attempt %d of %d), retrying in %v: %v\n", e.ID, e.Attempts, runOpts.maxAttempts, delay, err)
+	return nil
+}
+
+func (r *runner) client(user string) (*twitter.Client, error) {
+	if cli, ok := r.clients[user]; ok {
+		return cli, nil
+	}
+	cli, err := r.cfg.NewUserClient(user)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[user] = cli
+	return cli, nil
+}
+
+// readText returns the text of a tweet from args, or from stdin if args is
+// "-", and checks that it can be posted.
+func readText(args []string) (string, error) {
+	text := strings.TrimSpace(strings.Join(args, " "))
+	if len(args) == 1 && args[0] == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading text: %w", err)
+		}
+		text = strings.TrimSpace(string(data))
+	}
+	if err := cmdtweet.CheckText(text); err != nil {
+		return "", err
+	}
+	return text, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdschedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creachadair/atomicfile"
+	"github.com/creachadair/twig/config"
+)
+
+// States of a scheduled tweet.
+const (
+	statePending   = "pending"   // waiting to be posted
+	statePosting   = "posting"   // being posted by a runner
+	statePosted    = "posted"    // posted successfully
+	stateFailed    = "failed"    // gave up after too many attempts
+	stateCancelled = "cancelled" // cancelled before it was posted
+)
+
+// An Entry is a tweet scheduled to be posted.
+type Entry struct {
+	ID        string     `json:"id"`
+	At        time.Time  `json:"at"`
+	User      string     `json:"user"` // the username to post as
+	Text      string     `json:"text"`
+	InReplyTo string     `json:"in_reply_to,omitempty"`
+	State     string     `json:"state"`
+	Created   time.Time  `json:"created"`
+	Attempts  int        `json:"attempts,omitempty"`
+	RetryAt   *time.Time `json:"retry_at,omitempty"` // when to retry after a failure
+	LastError string     `json:"last_error,omitempty"`
+	Posted    *time.Time `json:"posted,omitempty"`
+	TweetID   string     `json:"tweet_id,omitempty"`
+
+	// While the tweet is being posted, the runner posting it and when it
+	// began to do so.
+	Runner  string     `json:"runner,omitempty"`
+	Claimed *time.Time `json:"claimed,omitempty"`
+}
+
+// due reports when e should next be posted, and whether it is waiting.
+func (e *Entry) due() (time.Time, bool) {
+	if e.State != statePending {
+		return time.Time{}, false
+	} else if e.RetryAt != nil && e.RetryAt.After(e.At) {
+		return *e.RetryAt, true
+	}
+	return e.At, true
+}
+
+// A queue is the persistent set of scheduled tweets, stored as JSON.
+type queue struct {
+	path    string
+	NextID  int      `json:"next_id"`
+	Entries []*Entry `json:"entries"`
+}
+
+// loadQueue loads the queue of scheduled tweets for cfg. If the file does not
+// exist, an empty queue is returned.
+func loadQueue(cfg *config.Config) (*queue, error) {
+	path, err := config.DataPath(cfg.ScheduleFile, "schedule.json")
+	if err != nil {
+		return nil, err
+	}
+	q := &queue{path: path, NextID: 1}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading schedule: %w", err)
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("decoding schedule: %w", err)
+	}
+	return q, nil
+}
+
+// errUnchanged is reported by an update function to updateQueue when it did
+// not change the queue, so there is nothing to save.
+var errUnchanged = errors.New("queue unchanged")
+
+// updateQueue loads the queue of scheduled tweets for cfg, calls f to modify
+// it, and saves the result if f succeeds. The queue file is locked until the
+// update is complete, so that concurrent updates are not lost.
+func updateQueue(cfg *config.Config, f func(*queue) error) error {
+	path, err := config.DataPath(cfg.ScheduleFile, "schedule.json")
+	if err != nil {
+		return err
+	}
+	unlock, err := config.LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	q, err := loadQueue(cfg)
+	if err != nil {
+		return err
+	} else if err := f(q); errors.Is(err, errUnchanged) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return q.save()
+}
+
+// save writes the contents of q back to its file.
+func (q *queue) save() error {
+	sort.SliceStable(q.Entries, func(i, j int) bool { return q.Entries[i].At.Before(q.Entries[j].At) })
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0700); err != nil {
+		return err
+	}
+	if err := atomicfile.WriteData(q.path, data, 0600); err != nil {
+		return fmt.Errorf("writing schedule: %w", err)
+	}
+	return nil
+}
+
+// add adds e to the queue, assigning it an ID.
+func (q *queue) add(e *Entry) {
+	e.ID = strconv.Itoa(q.NextID)
+	q.NextID++
+	q.Entries = append(q.Entries, e)
+}
+
+// find returns the entry with the given ID, or an error.
+func (q *queue) find(id string) (*Entry, error) {
+	for _, e := range q.Entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("no scheduled tweet with ID %q", id)
+}
+
+// parseTime parses a time to post at, relative to now. It accepts an RFC 3339
+// timestamp, a local date and time ("2006-01-02 15:04"), a local time of day
+// ("15:04", the next time that time occurs), or a duration from now ("+2h30m").
+func parseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if d, ok := strings.CutPrefix(s, "+"); ok {
+		dur, err := time.ParseDuration(d)
+		if err != nil || dur < 0 {
+			return time.Time{}, fmt.Errorf("invalid duration %q", s)
+		}
+		return now.Add(dur), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.ParseInLocation("15:04", s, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (see help for formats)", s)
+}
@@ -3,7 +3,6 @@
 package cmdsearch
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"time"
@@ -16,7 +15,7 @@ import (
 
 var Command = &command.C{
 	Name:  "search",
-	Usage: "[-max n] -query query [field-spec...]",
+	Usage: "[-max n] [-page token] -query query [field-spec...]",
 	Help: `
 Search for recent tweets matching the specified query.
 
@@ -24,11 +23,12 @@ A field spec has the form type:field, e.g., "tweet:entities".
 As a special case, :field is shorthand for "tweet:field".
 
 If the results span multiple pages, use -page to set the
-page token to resume searching from.
+page token to resume searching from. If a search is interrupted,
+the token needed to resume it is printed before exiting.
 `,
 	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
 		fs.StringVar(&opts.query, "query", "", "Search query (required)")
-		fs.IntVar(&opts.maxResults, "max", 0, "Maximum results to request (0 means all)")
+		opts.SetFlags(fs)
 		fs.StringVar(&opts.sinceID, "after", "", "Return tweets (strictly) after this ID")
 		fs.StringVar(&opts.untilID, "before", "", "Return tweets (strictly) before this ID")
 		fs.Var(timestamp{&opts.since}, "since", "Return tweets no older than this")
@@ -46,58 +46,42 @@ page token to resume searching from.
 			return command.FailWithUsage(env, args)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
 
-		// Choose a page size based on the requested max results.  The service
-		// will not accept arbitrary sizes, so we'll paginate based on what the
-		// user requested.
-		max := opts.maxResults
-		if max <= 0 || max > 100 {
-			max = 100
-		} else if max < 10 {
-			max = 10
-		}
-
+		ctx := cfg.Context()
 		q := tweets.SearchRecent(opts.query, &tweets.SearchOpts{
+			PageToken:  opts.PageToken,
 			StartTime:  opts.since,
 			EndTime:    opts.until,
-			MaxResults: max,
+			MaxResults: config.PageSize(opts.MaxResults, 10),
 			SinceID:    opts.sinceID,
 			UntilID:    opts.untilID,
 			Optional:   parsed.Fields,
 		})
-		var numResults int
-		for q.HasMorePages() {
-			rsp, err := q.Invoke(context.Background(), cli)
+		return config.Paginate(env, q.Request, opts.MaxResults, q.HasMorePages, func() ([]*types.Tweet, error) {
+			rsp, err := q.Invoke(ctx, cli)
 			if err != nil {
-				return err
-			}
-			tw := rsp.Tweets
-			numResults += len(tw)
-			if opts.maxResults > 0 && numResults > opts.maxResults {
-				tw = rsp.Tweets[:len(tw)-(numResults-opts.maxResults)]
+				return nil, err
 			}
-			if err := config.PrintJSON(tw); err != nil {
-				return err
+			if err := recordSeen(cfg, rsp); err != nil {
+				return nil, err
 			}
-			if opts.maxResults > 0 && numResults >= opts.maxResults {
-				return nil // our work here is finished
-			}
-		}
-		return nil
+			return rsp.Tweets, nil
+		})
 	},
 }
 
 var opts struct {
-	maxResults int
-	sinceID    string
-	untilID    string
-	since      time.Time
-	until      time.Time
-	query      string
+	config.PageOpts
+	sinceID string
+	untilID string
+	since   time.Time
+	until   time.Time
+	query   string
 }
 
 type timestamp struct {
@@ -126,3 +110,14 @@ func (ts timestamp) String() string {
 
 // Get satisfies flag.Getter, the concrete type is time.Time.
 func (ts timestamp) Get() interface{} { return *ts.Time }
+
+// recordSeen saves the tweets and users in rsp in the local archive, if that
+// is enabled.
+func recordSeen(cfg *config.Config, rsp *tweets.Reply) error {
+	users, err := rsp.IncludedUsers()
+	if err != nil {
+		return err
+	}
+	cfg.RecordSeen(rsp.Tweets, users)
+	return nil
+}
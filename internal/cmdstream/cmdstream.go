@@ -3,12 +3,13 @@
 package cmdstream
 
 import (
-	"context"
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter/jape"
 	"github.com/creachadair/twitter/tweets"
 )
 
@@ -18,9 +19,25 @@ var Command = &command.C{
 	Help: `Stream matches to the current query rules.
 
 See the "rules" command for creating, viewing, and deleting the
-streaming search rules.`,
+streaming search rules.
+
+If the stream is disconnected by a network error, a stall, or an error
+from the server, it is reconnected automatically following the backoff
+schedule recommended by the API documentation:
+
+  network errors and stalls : linear from 250ms, at most 16s
+  HTTP errors               : exponential from 5s, at most 320s
+  HTTP 429 (rate limited)   : exponential from 1m, at most 16m
+
+Set -backfill to ask the server to re-deliver up to that many minutes of
+tweets missed while disconnected. Tweets already reported before the
+disconnect are not printed again.`,
 	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
 		fs.IntVar(&opts.maxResults, "max", 0, "Maximum results to fetch (0 means all)")
+		fs.BoolVar(&opts.reconnect, "reconnect", true, "Reconnect automatically when disconnected")
+		fs.IntVar(&opts.maxRetries, "max-retries", 0, "Maximum consecutive reconnects (0 means no limit)")
+		fs.IntVar(&opts.backfill, "backfill", 0, "Backfill up to this many minutes on reconnect (1-5)")
+		fs.DurationVar(&opts.stallTimeout, "stall-timeout", 90*time.Second, "Reconnect if nothing is received for this long")
 	},
 	Run: func(env *command.Env, args []string) error {
 		parsed := config.ParseArgs(args, "tweet")
@@ -28,19 +45,39 @@ streaming search rules.`,
 			fmt.Fprintf(env, "Error: extra arguments after query %v\n", parsed.Keys)
 			return command.FailWithUsage(env, args)
 		}
-		cli, err := env.Config.(*config.Config).NewClient()
+		if opts.backfill < 0 || opts.backfill > 5 {
+			return fmt.Errorf("invalid -backfill %d: must be between 0 and 5 minutes", opts.backfill)
+		}
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
-		return tweets.SearchStream(func(rsp *tweets.Reply) error {
-			return config.PrintJSON(rsp.Tweets)
-		}, &tweets.StreamOpts{
-			MaxResults: opts.maxResults,
-			Optional:   parsed.Fields,
-		}).Invoke(context.Background(), cli)
+
+		s := newStreamer(cli, env)
+		err = s.run(cfg.Context(), func(rsp *tweets.Reply) error {
+			if err := config.PrintJSON(rsp.Tweets); err != nil {
+				return err
+			}
+			users, err := rsp.IncludedUsers()
+			if err != nil {
+				return err
+			}
+			cfg.RecordSeen(rsp.Tweets, users)
+			if opts.maxResults > 0 && s.numResults >= opts.maxResults {
+				return jape.ErrStopStreaming
+			}
+			return nil
+		}, parsed)
+		s.summarize(env)
+		return err
 	},
 }
 
 var opts struct {
-	maxResults int
+	maxResults   int
+	reconnect    bool
+	maxRetries   int
+	backfill     int
+	stallTimeout time.Duration
 }
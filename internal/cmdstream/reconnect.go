@@ -0,0 +1,293 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+// Causes of a stream disconnect, used to select a backoff schedule.
+const (
+	causeNetwork = "network"
+	causeStall   = "stall"
+	causeHTTP    = "http"
+	causeLimit   = "rate-limit"
+)
+
+// maxSeen is the number of most-recent tweet IDs remembered for duplicate
+// suppression across reconnects.
+const maxSeen = 50000
+
+// A streamer manages a search stream that reconnects when disconnected.
+type streamer struct {
+	cli  *twitter.Client
+	log  io.Writer
+	seen *idSet
+
+	numResults  int            // total tweets delivered to the callback
+	numDups     int            // duplicate tweets suppressed
+	stopped     bool           // the callback requested a stop
+	disconnects map[string]int // cause → count
+}
+
+func newStreamer(cli *twitter.Client, log io.Writer) *streamer {
+	return &streamer{
+		cli:         cli,
+		log:         log,
+		seen:        newIDSet(maxSeen),
+		disconnects: make(map[string]int),
+	}
+}
+
+// run streams results to f until the callback stops the stream, ctx ends, or
+// a permanent error occurs. Transient errors cause a reconnect.
+func (s *streamer) run(ctx context.Context, f tweets.Callback, parsed config.ParsedArgs) error {
+	var retries int
+	var delay time.Duration
+	var lastCause string
+	for attempt := 0; ; attempt++ {
+		var active bool
+		stalled, err := s.connect(ctx, func(rsp *tweets.Reply) error {
+			active = true
+			var fresh types.Tweets
+			for _, tw := range rsp.Tweets {
+				if s.seen.add(tw.ID) {
+					fresh = append(fresh, tw)
+				} else {
+					s.numDups++
+				}
+			}
+			if len(fresh) == 0 {
+				return nil
+			}
+			rsp.Tweets = fresh
+			s.numResults += len(fresh)
+			err := f(rsp)
+			if errors.Is(err, jape.ErrStopStreaming) {
+				s.stopped = true
+			}
+			return err
+		}, parsed, attempt > 0)
+
+		if s.stopped {
+			return nil
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		cause := classify(err, stalled)
+		if cause == "" {
+			return err
+		}
+		s.disconnects[cause]++
+		if active {
+			retries = 0
+		}
+		if !opts.reconnect || (opts.maxRetries > 0 && retries >= opts.maxRetries) {
+			if err == nil {
+				err = errors.New("stream closed by server")
+			}
+			return fmt.Errorf("stream disconnected: %w", err)
+		}
+		if cause != lastCause || active {
+			delay = 0
+		}
+		delay = nextDelay(cause, delay)
+		lastCause = cause
+		retries++
+
+		fmt.Fprintf(s.log, "stream disconnected (%s): %v; reconnecting in %v\n", cause, errText(err), delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect makes a single streaming connection and delivers results to f until
+// the stream ends. It reports whether the connection was closed because it
+// stalled, along with any error from the stream.
+func (s *streamer) connect(ctx context.Context, f tweets.Callback, parsed config.ParsedArgs, backfill bool) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stalled atomic.Bool
+	timer := time.AfterFunc(opts.stallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	q := tweets.SearchStream(f, &tweets.StreamOpts{Optional: parsed.Fields})
+	if backfill && opts.backfill > 0 {
+		q.Request.Params.Set("backfill_minutes", strconv.Itoa(opts.backfill))
+	}
+	err := q.Invoke(ctx, watchClient(s.cli, func() { timer.Reset(opts.stallTimeout) }))
+	return stalled.Load(), err
+}
+
+// summarize writes a summary of disconnects and suppressed duplicates to w,
+// if there was anything to report.
+func (s *streamer) summarize(w io.Writer) {
+	var total int
+	var causes []string
+	for _, cause := range []string{causeNetwork, causeStall, causeHTTP, causeLimit} {
+		if n := s.disconnects[cause]; n > 0 {
+			total += n
+			causes = append(causes, fmt.Sprintf("%s: %d", cause, n))
+		}
+	}
+	if total == 0 && s.numDups == 0 {
+		return
+	}
+	fmt.Fprintf(w, "stream: %d disconnects", total)
+	if len(causes) != 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(causes, ", "))
+	}
+	fmt.Fprintf(w, ", %d tweets delivered, %d duplicates suppressed\n", s.numResults, s.numDups)
+}
+
+// classify reports the cause of a stream disconnect, or "" if err is a
+// permanent error that should not be retried.
+func classify(err error, stalled bool) string {
+	if stalled {
+		return causeStall
+	} else if err == nil {
+		return causeNetwork // the server closed the stream
+	}
+	var jerr *jape.Error
+	if !errors.As(err, &jerr) {
+		return causeNetwork
+	}
+	switch {
+	case jerr.Status == http.StatusTooManyRequests:
+		return causeLimit
+	case jerr.Status >= 500:
+		return causeHTTP
+	case jerr.Status != 0:
+		return "" // other HTTP errors (auth, bad request) will not go away
+	case jerr.Message == "callback" && jerr.Err == nil:
+		return causeNetwork // jape reports a clean close by the server this way
+	case jerr.Message == "callback":
+		return "" // errors from the callback are not the stream's fault
+	}
+	return causeNetwork
+}
+
+// nextDelay returns the backoff delay following prev for the given cause.
+// See: https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/integrate/handling-disconnections
+func nextDelay(cause string, prev time.Duration) time.Duration {
+	switch cause {
+	case causeHTTP:
+		return backoff(prev, 5*time.Second, 320*time.Second)
+	case causeLimit:
+		return backoff(prev, time.Minute, 16*time.Minute)
+	}
+	if next := prev + 250*time.Millisecond; next < 16*time.Second {
+		return next
+	}
+	return 16 * time.Second
+}
+
+func backoff(prev, start, limit time.Duration) time.Duration {
+	if prev < start {
+		return start
+	} else if next := 2 * prev; next < limit {
+		return next
+	}
+	return limit
+}
+
+func errText(err error) string {
+	if err == nil {
+		return "closed by server"
+	}
+	return err.Error()
+}
+
+// watchClient returns a copy of cli whose transport calls ping each time data
+// are received from the server.
+func watchClient(cli *twitter.Client, ping func()) *twitter.Client {
+	jc := *(*jape.Client)(cli) // shallow copy
+	hc := http.DefaultClient
+	if jc.HTTPClient != nil {
+		hc = jc.HTTPClient
+	}
+	wc := *hc // shallow copy
+	base := wc.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wc.Transport = watchTransport{base: base, ping: ping}
+	jc.HTTPClient = &wc
+	return (*twitter.Client)(&jc)
+}
+
+type watchTransport struct {
+	base http.RoundTripper
+	ping func()
+}
+
+func (w watchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rsp, err := w.base.RoundTrip(req)
+	if err == nil {
+		w.ping()
+		rsp.Body = watchBody{ReadCloser: rsp.Body, ping: w.ping}
+	}
+	return rsp, err
+}
+
+// watchBody calls ping whenever data are read, including the keep-alive
+// newlines the server sends on an idle stream.
+type watchBody struct {
+	io.ReadCloser
+	ping func()
+}
+
+func (w watchBody) Read(data []byte) (int, error) {
+	nr, err := w.ReadCloser.Read(data)
+	if nr > 0 {
+		w.ping()
+	}
+	return nr, err
+}
+
+// An idSet is a set of IDs of bounded size. When the set is full, the oldest
+// IDs are evicted first.
+type idSet struct {
+	ids  map[string]bool
+	ring []string
+	next int
+}
+
+func newIDSet(size int) *idSet {
+	return &idSet{ids: make(map[string]bool), ring: make([]string, size)}
+}
+
+// add adds id to the set, and reports whether it was not already present.
+func (s *idSet) add(id string) bool {
+	if s.ids[id] {
+		return false
+	}
+	if old := s.ring[s.next]; old != "" {
+		delete(s.ids, old)
+	}
+	s.ring[s.next] = id
+	s.next = (s.next + 1) % len(s.ring)
+	s.ids[id] = true
+	return true
+}
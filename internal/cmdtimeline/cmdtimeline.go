@@ -3,8 +3,8 @@
 package cmdtimeline
 
 import (
-	"context"
 	"fmt"
+	"strings"
 
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
@@ -62,21 +62,22 @@ func runWithID(newQuery func(id string) ostatus.TimelineQuery) func(*command.Env
 		} else if len(rest) > 1 {
 			return command.FailWithUsage(env, rest)
 		} else if len(rest) == 1 {
-			user = rest[0]
+			user = strings.TrimPrefix(config.ParseKey(rest[0]), "@")
 		}
 		if user == "" {
 			return command.FailWithUsage(env, rest)
 		}
 
-		cli, err := env.Config.(*config.Config).NewClient()
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
 
-		rsp, err := newQuery(user).Invoke(context.Background(), cli)
+		rsp, err := newQuery(user).Invoke(cfg.Context(), cli)
 		if err != nil {
 			return err
 		}
+		cfg.RecordSeen(rsp.Tweets, nil)
 		return config.PrintJSON(rsp.Tweets)
 	}
 }
@@ -4,134 +4,127 @@ package cmdtweet
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
 	"github.com/creachadair/twitter/edit"
-	"github.com/creachadair/twitter/ostatus"
+	"github.com/creachadair/twitter/tweets"
 	"github.com/creachadair/twitter/types"
-	"github.com/creachadair/twitter/users"
 )
 
 var Command = &command.C{
 	Name: "tweet",
-	Help: "Commands to create and manipulate tweets",
+	Help: `Commands to create and manipulate tweets.
+
+The delete, like, unlike, retweet, unretweet, hide, and unhide commands
+accept any number of tweet IDs, "-" to read tweet IDs from stdin, or "@file"
+to read them from the named file. Input lines containing JSON objects
+contribute their "id" field, so the output of search or lookup can be piped
+in directly.`,
 	Commands: []*command.C{
 		cmdCreate,
+		cmdThread,
+		cmdPurge,
 		{
 			Name:  "delete",
-			Usage: "id",
-			Help:  "Delete the tweet with the specified ID.",
-			Run: runWithID(func(_, tweetID string) edit.Query {
+			Usage: "id|-|@file ...",
+			Help: `Delete the tweets with the specified IDs.
+
+Before deleting, the tweets are fetched and shown, and you are asked to
+confirm the deletion. Set -yes to skip confirmation, for example in a script.
+` + mutateHelp,
+			SetFlags: setMutateFlags,
+			Run: runWithID(confirmDelete, func(tweetID string) edit.Query {
 				return edit.DeleteTweet(tweetID)
 			}),
 		},
 		{
-			Name:  "like",
-			Usage: " id",
-			Help:  "Mark tweet id as liked by the authorized user.",
-			Run: runWithID(func(userID, tweetID string) edit.Query {
+			Name:     "like",
+			Usage:    "id|-|@file ...",
+			Help:     "Mark the specified tweets as liked by the authorized user.\n" + mutateHelp,
+			SetFlags: setMutateFlags,
+			Run: runAsUser(func(userID, tweetID string) edit.Query {
 				return edit.Like(userID, tweetID)
 			}),
 		},
 		{
-			Name:  "unlike",
-			Usage: "id",
-			Help:  "Unmark tweet id as liked by the authorized user.",
-			Run: runWithID(func(userID, tweetID string) edit.Query {
+			Name:     "unlike",
+			Usage:    "id|-|@file ...",
+			Help:     "Unmark the specified tweets as liked by the authorized user.\n" + mutateHelp,
+			SetFlags: setMutateFlags,
+			Run: runAsUser(func(userID, tweetID string) edit.Query {
 				return edit.Unlike(userID, tweetID)
 			}),
 		},
 		{
-			Name:  "retweet",
-			Usage: "id",
-			Help:  "Retweet tweet id from the authorized users.",
-			Run: runWithID(func(userID, tweetID string) edit.Query {
+			Name:     "retweet",
+			Usage:    "id|-|@file ...",
+			Help:     "Retweet the specified tweets from the authorized user.\n" + mutateHelp,
+			SetFlags: setMutateFlags,
+			Run: runAsUser(func(userID, tweetID string) edit.Query {
 				return edit.Retweet(userID, tweetID)
 			}),
 		},
 		{
-			Name:  "unretweet",
-			Usage: "id",
-			Help:  "Un-retweet tweet id from the authorized user.",
-			Run: runWithID(func(userID, tweetID string) edit.Query {
+			Name:     "unretweet",
+			Usage:    "id|-|@file ...",
+			Help:     "Un-retweet the specified tweets from the authorized user.\n" + mutateHelp,
+			SetFlags: setMutateFlags,
+			Run: runAsUser(func(userID, tweetID string) edit.Query {
 				return edit.Unretweet(userID, tweetID)
 			}),
 		},
+		cmdHide,
+		cmdUnhide,
+		cmdModerate,
+		cmdLikingUsers,
+		cmdRetweetedBy,
+		cmdQuotes,
 	},
 }
 
-var (
-	inReplyTo    string
-	autoPopReply bool
-)
-
-func init() {
-	cmdCreate.Flags.StringVar(&inReplyTo, "reply-to", "",
-		"Reply to this tweet ID")
-	cmdCreate.Flags.BoolVar(&autoPopReply, "auto-reply", false,
-		"Automatically populate reply based on mentions")
-}
-
-var cmdCreate = &command.C{
-	Name:  "create",
-	Usage: "text...",
-	Help:  `Create a new tweet from the given text.`,
-
-	Run: func(env *command.Env, args []string) error {
-		var opts types.TweetFields
-		rest, err := config.ParseParams(args, "tweet", &opts)
-		if err != nil {
-			return err
-		}
-		text := strings.TrimSpace(strings.Join(rest, " "))
-		if text == "" {
-			return errors.New("empty status update")
-		}
-
-		cli, err := env.Config.(*config.Config).NewClient()
-		if err != nil {
-			return fmt.Errorf("creating client: %w", err)
-		}
+// A checkFunc is called with the tweet IDs a command will modify, before any
+// changes are made. If it reports an error, no changes are made.
+type checkFunc func(env *command.Env, cli *twitter.Client, tweetIDs []string) error
 
-		rsp, err := ostatus.Create(text, &ostatus.CreateOpts{
-			InReplyTo:         inReplyTo,
-			AutoPopulateReply: autoPopReply,
-			Optional:          opts,
-		}).Invoke(context.Background(), cli)
-		if err != nil {
-			return err
-		}
-		return config.PrintJSON(rsp.Tweets)
-	},
-}
+// maxShown is the maximum number of tweets shown when confirming a deletion.
+const maxShown = 10
 
-func runWithID(newQuery func(uid, tid string) edit.Query) func(*command.Env, []string) error {
-	return func(env *command.Env, args []string) error {
-		if len(args) != 1 || args[0] == "" {
-			return command.FailWithUsage(env, args)
-		}
-		cfg := env.Config.(*config.Config)
-		cli, err := cfg.NewClient()
+// confirmDelete is a checkFunc that shows the tweets to be deleted and asks
+// the user to confirm.
+func confirmDelete(env *command.Env, cli *twitter.Client, tweetIDs []string) error {
+	cfg := env.Config.(*config.Config)
+	if !cfg.NeedConfirm() {
+		return nil // skip fetching the tweets
+	}
+	tw, err := config.Batch(cfg.Context(), tweetIDs, func(ctx context.Context, ids []string) (types.Tweets, error) {
+		rsp, err := tweets.Lookup(ids[0], &tweets.LookupOpts{More: ids[1:]}).Invoke(ctx, cli)
 		if err != nil {
-			return fmt.Errorf("creating client: %w", err)
+			return nil, err
 		}
+		return rsp.Tweets, nil
+	})
+	if err != nil {
+		return fmt.Errorf("fetching tweets to delete: %w", err)
+	}
+	text := make(map[string]string)
+	for _, t := range tw {
+		text[t.ID] = strings.Join(strings.Fields(t.Text), " ")
+	}
 
-		ctx := context.Background()
-		var uid string
-		if rsp, err := users.LookupByName(cfg.AuthUser, nil).Invoke(ctx, cli); err != nil {
-			return fmt.Errorf("resolving user: %w", err)
+	fmt.Fprintf(env, "Deleting %d tweet(s):\n", len(tweetIDs))
+	for i, id := range tweetIDs {
+		if i == maxShown {
+			fmt.Fprintf(env, "  ... and %d more\n", len(tweetIDs)-i)
+			break
+		} else if t, ok := text[id]; ok {
+			fmt.Fprintf(env, "  %s: %s\n", id, t)
 		} else {
-			uid = rsp.Users[0].ID
-		}
-
-		rsp, err := newQuery(uid, args[0]).Invoke(context.Background(), cli)
-		if err != nil {
-			return err
+			fmt.Fprintf(env, "  %s: (not found)\n", id)
 		}
-		return config.PrintJSON(rsp)
 	}
+	return cfg.Confirm(env, "Delete these tweets?")
 }
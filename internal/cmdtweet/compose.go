@@ -0,0 +1,155 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+// scissors separates the text of a tweet being composed from the template
+// below it. Everything from this line onward is discarded, so that the tweet
+// itself may contain lines beginning with "#".
+const scissors = "# ------------------------ >8 ------------------------"
+
+// readStdinText reads the text of a tweet from stdin.
+func readStdinText() (string, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("reading text: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// compose opens an editor to write the text of p, starting from text, and
+// returns the result. The editor is opened again until the text is valid or
+// empty; an empty text cancels the tweet. If the editor leaves invalid text
+// unchanged, compose reports why the text is invalid.
+func compose(ctx context.Context, cli *twitter.Client, p *Post, text string) (string, error) {
+	reply := replyContext(ctx, cli, p.inReplyTo)
+	f, err := os.CreateTemp("", "twig-tweet-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	for {
+		if err := os.WriteFile(path, []byte(composeTemplate(text, reply)), 0600); err != nil {
+			return "", err
+		}
+		if err := runEditor(path); err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		prev := text
+		text, _, _ = strings.Cut(string(data), scissors)
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return "", errors.New("empty status update (tweet cancelled)")
+		} else if err := CheckText(text); err == nil {
+			return text, nil
+		} else if text == prev {
+			return "", err
+		}
+	}
+}
+
+// composeTemplate returns the contents of the file to edit for a tweet with
+// the given text, and lines describing the tweet replied to.
+func composeTemplate(text string, reply []string) string {
+	var sb strings.Builder
+	if text != "" {
+		fmt.Fprintln(&sb, text)
+	}
+	fmt.Fprintln(&sb)
+	fmt.Fprintln(&sb, scissors)
+	fmt.Fprintln(&sb, "# Write the tweet above this line. Everything below it is ignored.")
+	fmt.Fprintln(&sb, "# To cancel, leave the tweet empty.")
+	if len(reply) != 0 {
+		fmt.Fprintln(&sb, "#")
+		for _, line := range reply {
+			fmt.Fprintln(&sb, "#", line)
+		}
+	}
+	fmt.Fprintln(&sb, "#")
+
+	ti := parseText(text, maxTweetLength)
+	fmt.Fprintf(&sb, "# Length: %d of %d characters", ti.Length, maxTweetLength)
+	if ti.Overflow >= 0 {
+		fmt.Fprintf(&sb, ", %d too many", ti.Length-maxTweetLength)
+	} else {
+		fmt.Fprintf(&sb, ", %d remaining", maxTweetLength-ti.Length)
+	}
+	fmt.Fprintln(&sb, " (URLs count as 23, CJK characters and emoji as 2).")
+	if err := CheckText(text); err != nil && text != "" {
+		fmt.Fprintf(&sb, "# Error: %v\n", err)
+	}
+	return sb.String()
+}
+
+// replyContext returns lines describing the tweet with the given ID, for the
+// template of a reply. Lookup errors are described rather than reported.
+func replyContext(ctx context.Context, cli *twitter.Client, id string) []string {
+	if id == "" {
+		return nil
+	}
+	rsp, err := tweets.Lookup(id, &tweets.LookupOpts{
+		Optional: []types.Fields{
+			types.TweetFields{AuthorID: true},
+			types.Expansions{AuthorID: true},
+		},
+	}).Invoke(ctx, cli)
+	if err != nil {
+		return []string{fmt.Sprintf("Replying to tweet %s (lookup failed: %v)", id, err)}
+	} else if len(rsp.Tweets) == 0 {
+		return []string{fmt.Sprintf("Replying to tweet %s (not found)", id)}
+	}
+	tw := rsp.Tweets[0]
+	who := "user " + tw.AuthorID
+	if users, err := rsp.IncludedUsers(); err == nil {
+		for _, u := range users {
+			if u.ID == tw.AuthorID {
+				who = fmt.Sprintf("@%s (%s)", u.Username, u.Name)
+			}
+		}
+	}
+	out := []string{fmt.Sprintf("Replying to %s, tweet %s:", who, id)}
+	for _, line := range strings.Split(tw.Text, "\n") {
+		out = append(out, "  "+line)
+	}
+	return out
+}
+
+// runEditor runs the user's editor on the file at path. The editor is given
+// by $VISUAL or $EDITOR, and may include arguments.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("/bin/sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running editor %q: %w", editor, err)
+	}
+	return nil
+}
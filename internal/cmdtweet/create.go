@@ -0,0 +1,415 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/ostatus"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+// Limits on polls.
+// See: https://developer.twitter.com/en/docs/twitter-api/tweets/manage-tweets/api-reference/post-tweets
+const (
+	minPollOptions     = 2
+	maxPollOptions     = 4
+	maxPollOptionChars = 25
+	minPollMinutes     = 5
+	maxPollMinutes     = 7 * 24 * 60
+)
+
+var opts struct {
+	inReplyTo     string
+	autoPopReply  bool
+	media         stringList
+	alt           stringList
+	poll          string
+	pollMinutes   int
+	quote         string
+	replySettings string
+	excludeReply  stringList
+	edit          bool
+}
+
+func init() { SetPostFlags(&cmdCreate.Flags) }
+
+// SetPostFlags adds flags for the options of a post to fs. The commands that
+// create posts share these flags.
+func SetPostFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.inReplyTo, "reply-to", "", "Reply to this tweet ID or URL")
+	fs.BoolVar(&opts.autoPopReply, "auto-reply", false, "Automatically populate reply based on mentions")
+	fs.Var(&opts.media, "media", "Attach this image, GIF, or video file (repeatable)")
+	fs.Var(&opts.alt, "alt", "Alt text for the corresponding -media file (repeatable)")
+	fs.StringVar(&opts.poll, "poll", "", "Comma-separated poll options")
+	fs.IntVar(&opts.pollMinutes, "poll-minutes", 24*60, "Poll duration in minutes")
+	fs.StringVar(&opts.quote, "quote", "", "Quote this tweet ID or URL")
+	fs.StringVar(&opts.replySettings, "reply-settings", "",
+		"Who may reply: following or mentionedUsers (default everyone)")
+	fs.Var(&opts.excludeReply, "exclude-reply-user", "Do not mention this user in the reply (repeatable)")
+	fs.BoolVar(&opts.edit, "e", false, "Edit the text in $EDITOR before posting")
+}
+
+var cmdCreate = &command.C{
+	Name:  "create",
+	Usage: "[text... | -]",
+	Help: `Create a new tweet from the given text.
+
+If no text is given, or if -e is set, an editor is opened to write the text
+of the tweet, starting from the text given, if any. The editor is $VISUAL or
+$EDITOR (default vi). The file to edit shows the tweet being replied to and
+the length of the text; if the text is too long when the editor exits, the
+editor is opened again, unless the text was not changed. Saving an empty
+text cancels the tweet. The editor is only used from a terminal.
+
+If the text is "-", it is read from stdin.
+
+The text is checked before it is sent. Its length is counted as Twitter
+counts it: each URL counts as 23 characters, and each CJK character and
+emoji counts as 2. If the text is too long, the position where the excess
+begins is reported.
+
+Use -media to attach a file to the tweet. The flag may be repeated to attach
+up to 4 images (JPEG, PNG, or WebP), or a single GIF or video (MP4 or MOV).
+Files are uploaded in chunks before the tweet is posted, and the upload
+progress is printed. Videos and GIFs are processed by the server after
+upload; the tweet is posted once processing is complete.
+
+Use -alt to set the alt text of a media file. The nth -alt flag applies to
+the nth -media flag.
+
+Use -poll to attach a poll with 2 to 4 comma-separated options of at most
+25 characters each, open for -poll-minutes (5 minutes to 7 days). A poll
+cannot be combined with media or a quoted tweet.
+
+Use -quote to quote another tweet, and -reply-settings to limit who may
+reply to the new tweet. When replying with -reply-to, the users mentioned
+in the original tweet are mentioned in the reply automatically; use
+-exclude-reply-user (by @username or ID) to leave a user out.
+
+The -poll, -quote, -reply-settings, and -exclude-reply-user options are only
+available in API v2, and cannot be combined with -auto-reply. A tweet created
+with them is reported with only its ID and text.`,
+
+	Run: func(env *command.Env, args []string) error {
+		var fields types.TweetFields
+		rest, err := config.ParseParams(args, "tweet", &fields)
+		if err != nil {
+			return err
+		}
+		p, err := newPost(env)
+		if err != nil {
+			return err
+		}
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
+		if err != nil {
+			return fmt.Errorf("creating client: %w", err)
+		}
+		ctx := cfg.Context()
+		p.text, err = PostText(env, cli, p, rest, "")
+		if err != nil {
+			return err
+		}
+		tw, err := p.Send(ctx, env, cli, fields)
+		if err != nil {
+			return err
+		}
+		return config.PrintJSON(tw)
+	},
+}
+
+// PostText returns the text for p given by args, and checks it. If args is
+// "-", the text is read from stdin. If args is empty or the -e flag is set,
+// the text is composed in an editor, starting from args, or from old if args
+// is empty. The editor is used only if stdin and stdout are terminals.
+func PostText(env *command.Env, cli *twitter.Client, p *Post, args []string, old string) (string, error) {
+	text := strings.TrimSpace(strings.Join(args, " "))
+	var err error
+	if len(args) == 1 && args[0] == "-" {
+		if opts.edit {
+			return "", errors.New("-e cannot be used when reading text from stdin")
+		}
+		text, err = readStdinText()
+	} else if text == "" || opts.edit {
+		if !config.IsTerminal(os.Stdin) || !config.IsTerminal(os.Stdout) {
+			fmt.Fprintln(env, `Composing a tweet in an editor requires a terminal; give the text as arguments, or "-" to read it from stdin.`)
+			return "", command.FailWithUsage(env, args)
+		}
+		if text == "" {
+			text = old
+		}
+		cfg := env.Config.(*config.Config)
+		text, err = compose(cfg.Context(), cli, p, text)
+	}
+	if err != nil {
+		return "", err
+	} else if err := CheckText(text); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// A Post is a tweet to be created, with its options.
+type Post struct {
+	text          string
+	inReplyTo     string
+	autoPopReply  bool
+	media         []*mediaFile
+	pollOptions   []string
+	pollMinutes   int
+	quote         string
+	replySettings string
+	excludeReply  []string // user keys, resolved when sent
+}
+
+// PostOptions are the text and options of a tweet to be created. The options
+// correspond to the flags added by SetPostFlags.
+type PostOptions struct {
+	Text          string
+	InReplyTo     string   // tweet ID
+	AutoPopReply  bool     // -auto-reply
+	Media         []string // paths of media files
+	Alt           []string // alt text for the corresponding Media
+	Poll          []string // poll options
+	PollMinutes   int
+	Quote         string // tweet ID
+	ReplySettings string
+	ExcludeReply  []string // user keys
+}
+
+// PostFlags returns the options set by the flags added by SetPostFlags. The
+// text is not set.
+func PostFlags() (PostOptions, error) {
+	poll, err := parsePoll(opts.poll)
+	if err != nil {
+		return PostOptions{}, err
+	}
+	return PostOptions{
+		InReplyTo:     config.ParseKey(opts.inReplyTo),
+		AutoPopReply:  opts.autoPopReply,
+		Media:         opts.media,
+		Alt:           opts.alt,
+		Poll:          poll,
+		PollMinutes:   opts.pollMinutes,
+		Quote:         config.ParseKey(opts.quote),
+		ReplySettings: opts.replySettings,
+		ExcludeReply:  opts.excludeReply,
+	}, nil
+}
+
+// NewPost returns a post with the given options, after checking that they
+// are valid together and that the media files can be uploaded. The text is
+// not checked.
+func NewPost(o PostOptions) (*Post, error) {
+	media, err := checkMedia(o.Media, o.Alt)
+	if err != nil {
+		return nil, err
+	}
+	p := &Post{
+		text:          o.Text,
+		inReplyTo:     o.InReplyTo,
+		autoPopReply:  o.AutoPopReply,
+		media:         media,
+		pollOptions:   o.Poll,
+		quote:         o.Quote,
+		replySettings: o.ReplySettings,
+		excludeReply:  o.ExcludeReply,
+	}
+	if len(p.pollOptions) != 0 {
+		p.pollMinutes = o.PollMinutes
+	}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// newPost returns a post with the options set by the create command flags,
+// after checking that they are valid together. The text is not set.
+func newPost(env *command.Env) (*Post, error) {
+	o, err := PostFlags()
+	if err != nil {
+		return nil, err
+	} else if len(o.Poll) == 0 && isFlagSet(env.Command, "poll-minutes") {
+		return nil, errors.New("-poll-minutes requires -poll")
+	}
+	return NewPost(o)
+}
+
+// parsePoll parses a comma-separated list of poll options.
+func parsePoll(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var out []string
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			return nil, errors.New("empty -poll option")
+		}
+		out = append(out, opt)
+	}
+	return out, nil
+}
+
+// check reports an error if the options of p are not valid together.
+func (p *Post) check() error {
+	if len(p.pollOptions) != 0 {
+		for _, opt := range p.pollOptions {
+			if n := utf8.RuneCountInString(opt); n > maxPollOptionChars {
+				return fmt.Errorf("poll option %q is too long (%d > %d characters)", opt, n, maxPollOptionChars)
+			}
+		}
+		if n := len(p.pollOptions); n < minPollOptions || n > maxPollOptions {
+			return fmt.Errorf("a poll must have %d to %d options (got %d)", minPollOptions, maxPollOptions, n)
+		}
+		if p.pollMinutes < minPollMinutes || p.pollMinutes > maxPollMinutes {
+			return fmt.Errorf("-poll-minutes must be between %d and %d", minPollMinutes, maxPollMinutes)
+		}
+	}
+
+	switch p.replySettings {
+	case "", "following", "mentionedUsers":
+	default:
+		return fmt.Errorf("invalid -reply-settings %q (want following or mentionedUsers)", p.replySettings)
+	}
+	switch {
+	case len(p.pollOptions) != 0 && len(p.media) != 0:
+		return errors.New("a poll cannot be combined with -media")
+	case len(p.pollOptions) != 0 && p.quote != "":
+		return errors.New("a poll cannot be combined with -quote")
+	case len(p.excludeReply) != 0 && p.inReplyTo == "":
+		return errors.New("-exclude-reply-user requires -reply-to")
+	case p.autoPopReply && p.useV2():
+		return errors.New("-auto-reply cannot be combined with -poll, -quote, -reply-settings, or -exclude-reply-user")
+	}
+	return nil
+}
+
+// useV2 reports whether p requires the v2 API to create.
+func (p *Post) useV2() bool {
+	return len(p.pollOptions) != 0 || p.quote != "" || p.replySettings != "" || len(p.excludeReply) != 0
+}
+
+// Send uploads the media for p, then creates the tweet and returns it.
+// Progress messages are written to env.
+func (p *Post) Send(ctx context.Context, env *command.Env, cli *twitter.Client, fields types.TweetFields) (types.Tweets, error) {
+	cfg := env.Config.(*config.Config)
+	var mediaIDs []string
+	if len(p.media) != 0 {
+		upcli := *cli
+		upcli.BaseURL = cfg.UploadURL()
+		up := uploader{cli: &upcli, log: env}
+		for _, mf := range p.media {
+			id, err := up.upload(ctx, mf)
+			if err != nil {
+				return nil, err
+			}
+			mediaIDs = append(mediaIDs, id)
+		}
+	}
+
+	if !p.useV2() {
+		q := ostatus.Create(p.text, &ostatus.CreateOpts{
+			InReplyTo:         p.inReplyTo,
+			AutoPopulateReply: p.autoPopReply,
+			Optional:          fields,
+		})
+		if len(mediaIDs) != 0 {
+			if err := addFormParam(q.Request, "media_ids", strings.Join(mediaIDs, ",")); err != nil {
+				return nil, err
+			}
+		}
+		rsp, err := q.Invoke(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Tweets, nil
+	}
+
+	var exclude []string
+	if len(p.excludeReply) != 0 {
+		var err error
+		exclude, err = cfg.ResolveID(ctx, cli, p.excludeReply)
+		if err != nil {
+			return nil, fmt.Errorf("resolving -exclude-reply-user: %w", err)
+		}
+	}
+	req, err := p.v2Request(mediaIDs, exclude)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := tweets.Query{Request: req}.Invoke(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Tweets, nil
+}
+
+// v2Request returns a request to create p with the v2 API. The tweets package
+// does not support all the options of the v2 API, so the request is
+// constructed here.
+func (p *Post) v2Request(mediaIDs, exclude []string) (*jape.Request, error) {
+	type pollOpts struct {
+		Options  []string `json:"options"`
+		Duration int      `json:"duration_minutes"`
+	}
+	type replyOpts struct {
+		InReplyTo string   `json:"in_reply_to_tweet_id"`
+		Exclude   []string `json:"exclude_reply_user_ids,omitempty"`
+	}
+	type mediaOpts struct {
+		IDs []string `json:"media_ids"`
+	}
+	body := struct {
+		Text          string     `json:"text"`
+		Quote         string     `json:"quote_tweet_id,omitempty"`
+		ReplySettings string     `json:"reply_settings,omitempty"`
+		Poll          *pollOpts  `json:"poll,omitempty"`
+		Reply         *replyOpts `json:"reply,omitempty"`
+		Media         *mediaOpts `json:"media,omitempty"`
+	}{Text: p.text, Quote: p.quote, ReplySettings: p.replySettings}
+	if len(p.pollOptions) != 0 {
+		body.Poll = &pollOpts{Options: p.pollOptions, Duration: p.pollMinutes}
+	}
+	if p.inReplyTo != "" {
+		body.Reply = &replyOpts{InReplyTo: p.inReplyTo, Exclude: exclude}
+	}
+	if len(mediaIDs) != 0 {
+		body.Media = &mediaOpts{IDs: mediaIDs}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &jape.Request{
+		Method:      "2/tweets",
+		HTTPMethod:  "POST",
+		Params:      make(jape.Params),
+		Data:        data,
+		ContentType: "application/json",
+	}, nil
+}
+
+// isFlagSet reports whether the named flag was set on the command line.
+func isFlagSet(cmd *command.C, name string) (ok bool) {
+	cmd.Flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			ok = true
+		}
+	})
+	return
+}
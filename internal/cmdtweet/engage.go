@@ -0,0 +1,130 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+	"github.com/creachadair/twitter/users"
+)
+
+var engageOpts config.PageOpts
+
+func setEngageFlags(_ *command.Env, fs *flag.FlagSet) { engageOpts.SetFlags(fs) }
+
+// engageHelp describes the behavior common to the engagement commands.
+const engageHelp = `
+The tweet may be given as an ID or a URL.
+
+` + config.PageHelp
+
+var cmdLikingUsers = &command.C{
+	Name:  "liking-users",
+	Usage: "[-max n] id [user.fields...]",
+	Help: `List the users who liked the specified tweet.
+
+The tweet may be given as an ID or a URL. Field specifiers and expansions
+are accepted as for the lookup command. The service does not paginate this
+listing, so it cannot be resumed with -page.`,
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+		fs.IntVar(&engageOpts.MaxResults, "max", 0, "Maximum results to return (0 means all)")
+	},
+	Run: runEngageUsers(func(tweetID string, opts *users.ListOpts) users.Query {
+		// The service reports an error if the page size or token is set.
+		return users.LikersOf(tweetID, &users.ListOpts{Optional: opts.Optional})
+	}),
+}
+
+var cmdRetweetedBy = &command.C{
+	Name:     "retweeted-by",
+	Usage:    "[-max n] [-page token] id [user.fields...]",
+	Help:     "List the users who retweeted the specified tweet.\n" + engageHelp,
+	SetFlags: setEngageFlags,
+	Run: runEngageUsers(func(tweetID string, opts *users.ListOpts) users.Query {
+		return users.RetweetersOf(tweetID, opts)
+	}),
+}
+
+var cmdQuotes = &command.C{
+	Name:     "quotes",
+	Usage:    "[-max n] [-page token] id [tweet.fields...]",
+	Help:     "List the tweets that quote the specified tweet, most recent first.\n" + engageHelp,
+	SetFlags: setEngageFlags,
+	Run:      runQuotes,
+}
+
+// engageArgs parses the arguments of an engagement command, which must name
+// exactly one tweet, with the given default field type.
+func engageArgs(env *command.Env, args []string, dtype string) (config.ParsedArgs, error) {
+	parsed := config.ParseArgs(args, dtype)
+	if len(parsed.Keys) != 1 {
+		fmt.Fprintln(env, "Error: exactly one tweet ID is required")
+		return parsed, command.FailWithUsage(env, args)
+	}
+	return parsed, nil
+}
+
+func runEngageUsers(newQuery func(string, *users.ListOpts) users.Query) func(*command.Env, []string) error {
+	return func(env *command.Env, args []string) error {
+		parsed, err := engageArgs(env, args, "user")
+		if err != nil {
+			return err
+		}
+		cfg := env.Config.(*config.Config)
+		cli, err := cfg.NewClient()
+		if err != nil {
+			return fmt.Errorf("creating client: %w", err)
+		}
+
+		ctx := cfg.Context()
+		q := newQuery(parsed.Keys[0], &users.ListOpts{
+			PageToken:  engageOpts.PageToken,
+			MaxResults: config.PageSize(engageOpts.MaxResults, 1),
+			Optional:   parsed.Fields,
+		})
+		return config.Paginate(env, q.Request, engageOpts.MaxResults, q.HasMorePages, func() ([]*types.User, error) {
+			rsp, err := q.Invoke(ctx, cli)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RecordSeen(nil, rsp.Users)
+			return rsp.Users, nil
+		})
+	}
+}
+
+func runQuotes(env *command.Env, args []string) error {
+	parsed, err := engageArgs(env, args, "tweet")
+	if err != nil {
+		return err
+	}
+	cfg := env.Config.(*config.Config)
+	cli, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+
+	ctx := cfg.Context()
+	q := tweets.Quotes(parsed.Keys[0], &tweets.ListOpts{
+		PageToken:  engageOpts.PageToken,
+		MaxResults: config.PageSize(engageOpts.MaxResults, 10),
+		Optional:   parsed.Fields,
+	})
+	return config.Paginate(env, q.Request, engageOpts.MaxResults, q.HasMorePages, func() ([]*types.Tweet, error) {
+		rsp, err := q.Invoke(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		users, err := rsp.IncludedUsers()
+		if err != nil {
+			return nil, err
+		}
+		cfg.RecordSeen(rsp.Tweets, users)
+		return rsp.Tweets, nil
+	})
+}
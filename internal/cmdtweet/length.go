@@ -0,0 +1,186 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/creachadair/twig/internal/tweettext"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Parameters for counting the length of tweet text. Most characters count as
+// 2 toward the limit, except those in lightRanges, which count as 1. URLs
+// count as urlLength regardless of their length, and an emoji sequence counts
+// as 2 however many code points it has.
+// See: https://github.com/twitter/twitter-text/blob/master/config/v3.json
+const (
+	maxTweetLength = 280
+	weightScale    = 100
+	defaultWeight  = 200
+	urlLength      = 23
+)
+
+var lightRanges = []struct{ lo, hi rune }{
+	{0x0000, 0x10FF}, // Latin, Greek, Cyrillic, Hebrew, Arabic, ...
+	{0x2000, 0x200D}, // spaces and joiners
+	{0x2010, 0x201F}, // dashes and quotation marks
+	{0x2032, 0x2037}, // primes
+}
+
+// A textInfo describes the text of a tweet.
+type textInfo struct {
+	Text     string // NFC normalized
+	Length   int    // weighted length
+	Overflow int    // offset of the first rune past the limit, or -1
+	Invalid  int    // offset of the first invalid rune, or -1
+
+	tweettext.Entities // offsets are in runes of Text
+}
+
+// parseText normalizes and measures text, and extracts its entities. The
+// Overflow position is computed for a tweet of at most limit characters.
+func parseText(text string, limit int) *textInfo {
+	ti := &textInfo{Text: norm.NFC.String(text), Overflow: -1, Invalid: -1}
+	rs := []rune(ti.Text)
+	ti.Entities = tweettext.Extract(ti.Text)
+
+	weight, nextURL := 0, 0
+	for i := 0; i < len(rs); {
+		start := i
+		if nextURL < len(ti.URLs) && ti.URLs[nextURL].Start == i {
+			weight += urlLength * weightScale
+			i = ti.URLs[nextURL].End
+			nextURL++
+		} else if n := emojiLength(rs[i:]); n > 0 {
+			weight += defaultWeight
+			i += n
+		} else {
+			weight += runeWeight(rs[i])
+			if ti.Invalid < 0 && isInvalid(rs[i]) {
+				ti.Invalid = i
+			}
+			i++
+		}
+		if ti.Overflow < 0 && weight > limit*weightScale {
+			ti.Overflow = start
+		}
+	}
+	ti.Length = (weight + weightScale - 1) / weightScale
+	return ti
+}
+
+// tweetLength reports the weighted length of text.
+func tweetLength(text string) int { return parseText(text, maxTweetLength).Length }
+
+// CheckText reports an error if text cannot be posted as a tweet, because it
+// is empty, too long, or contains invalid characters.
+func CheckText(text string) error {
+	ti := parseText(text, maxTweetLength)
+	rs := []rune(ti.Text)
+	if strings.TrimSpace(ti.Text) == "" {
+		return errors.New("empty status update")
+	} else if ti.Invalid >= 0 {
+		return fmt.Errorf("text contains invalid character %U at position %d", rs[ti.Invalid], ti.Invalid+1)
+	} else if ti.Overflow >= 0 {
+		return fmt.Errorf("text is too long (%d > %d characters); the excess begins at position %d: %q",
+			ti.Length, maxTweetLength, ti.Overflow+1, snippet(rs[ti.Overflow:], 20))
+	}
+	return nil
+}
+
+// fitPrefix returns the number of runes of the longest prefix of text that
+// fits within limit characters. The text must be normalized.
+func fitPrefix(text string, limit int) int {
+	if ti := parseText(text, limit); ti.Overflow >= 0 {
+		return ti.Overflow
+	}
+	return utf8.RuneCountInString(text)
+}
+
+func snippet(rs []rune, n int) string {
+	if len(rs) > n {
+		return string(rs[:n]) + "…"
+	}
+	return string(rs)
+}
+
+func runeWeight(r rune) int {
+	for _, lr := range lightRanges {
+		if r >= lr.lo && r <= lr.hi {
+			return weightScale
+		}
+	}
+	return defaultWeight
+}
+
+// isInvalid reports whether r is not permitted in a tweet.
+func isInvalid(r rune) bool {
+	switch {
+	case r == 0xFFFE, r == 0xFEFF, r == 0xFFFF:
+		return true
+	case r >= 0x202A && r <= 0x202E: // directional formatting
+		return true
+	}
+	return false
+}
+
+// emojiLength returns the number of runes in the emoji sequence at the start
+// of rs, or 0 if rs does not start with an emoji.
+func emojiLength(rs []rune) int {
+	if len(rs) == 0 {
+		return 0
+	}
+	i := 1
+	switch r := rs[0]; {
+	case isRegionalIndicator(r):
+		if len(rs) > 1 && isRegionalIndicator(rs[1]) {
+			i = 2 // a flag
+		}
+	case r >= '0' && r <= '9' || r == '#' || r == '*':
+		// A keycap sequence, for example 1️⃣.
+		if len(rs) > 1 && rs[1] == 0xFE0F {
+			i++
+		}
+		if i >= len(rs) || rs[i] != 0x20E3 {
+			return 0
+		}
+		return i + 1
+	case isPictographic(r):
+	case len(rs) > 1 && rs[1] == 0xFE0F && unicode.In(r, unicode.So, unicode.Sm, unicode.Po):
+		// A symbol with emoji presentation, for example ©️.
+	default:
+		return 0
+	}
+	for i < len(rs) {
+		switch r := rs[i]; {
+		case r == 0xFE0E || r == 0xFE0F || r == 0x20E3:
+		case r >= 0x1F3FB && r <= 0x1F3FF: // skin tone
+		case r >= 0xE0020 && r <= 0xE007F: // tag sequence, for subdivision flags
+		case r == 0x200D && i+1 < len(rs) && isPictographic(rs[i+1]):
+			i++ // zero-width joiner sequence
+		default:
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1F1E6 && r <= 0x1F1FF }
+
+func isPictographic(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF:
+		return true
+	case r >= 0x2600 && r <= 0x27BF, r >= 0x2300 && r <= 0x23FF, r >= 0x2B00 && r <= 0x2BFF:
+		return true
+	case r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	}
+	return false
+}
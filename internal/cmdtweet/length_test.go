@@ -0,0 +1,96 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTweetLength(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello, world", 12},
+		{"naïve café", 10},
+
+		// CJK characters count as 2.
+		{"字", 2},
+		{"日本語です", 10},
+		{"go 言語", 7},
+
+		// URLs count as 23, whatever their length.
+		{"https://example.com/a/very/long/path/that/goes/on/and/on", 23},
+		{"http://x.co", 23},
+		{"see example.com.", 28},
+		{"(https://example.com/a)", 25},
+		{"node.js", 7},
+
+		// Emoji sequences count as 2.
+		{"👍", 2},
+		{"👍🏽", 2},
+		{"👨‍👩‍👧", 2},
+		{"🇯🇵", 2},
+		{"1️⃣", 2},
+
+		// Text is normalized to NFC before it is counted.
+		{"e\u0301", 1},
+		{"cafe\u0301", 4},
+		{"\u1100\u1161", 2}, // a Hangul syllable from its jamo
+	}
+	for _, tc := range tests {
+		if got := tweetLength(tc.text); got != tc.want {
+			t.Errorf("tweetLength(%q): got %d, want %d", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // substring of the error, or "" for success
+	}{
+		{"", "empty"},
+		{" \n\t", "empty"},
+		{"hello", ""},
+		{strings.Repeat("a", 280), ""},
+		{strings.Repeat("a", 281), "begins at position 281"},
+		{strings.Repeat("字", 140), ""},
+		{strings.Repeat("字", 141), "begins at position 141"},
+		{strings.Repeat("e\u0301", 280), ""},
+		{strings.Repeat("a", 256) + " https://example.com/x", ""},
+		{strings.Repeat("a", 257) + " https://example.com/x", "begins at position 259"},
+		{"ok \u202e reversed", "invalid character U+202E at position 4"},
+	}
+	for _, tc := range tests {
+		err := CheckText(tc.text)
+		if tc.want == "" {
+			if err != nil {
+				t.Errorf("CheckText(%q): unexpected error: %v", snippet([]rune(tc.text), 20), err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("CheckText(%q): got %v, want error containing %q", snippet([]rune(tc.text), 20), err, tc.want)
+		}
+	}
+}
+
+func TestFitPrefix(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  int
+	}{
+		{"hello", 10, 5},
+		{"hello, world", 5, 5},
+		{"字字字", 5, 2},
+		{"ab https://example.com/x", 10, 3},
+		{"ab https://example.com/x", 30, 24},
+	}
+	for _, tc := range tests {
+		if got := fitPrefix(tc.text, tc.limit); got != tc.want {
+			t.Errorf("fitPrefix(%q, %d): got %d, want %d", tc.text, tc.limit, got, tc.want)
+		}
+	}
+}
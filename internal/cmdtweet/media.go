@@ -0,0 +1,355 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/jape"
+)
+
+// Limits on media attached to a single tweet.
+// See: https://developer.twitter.com/en/docs/twitter-api/v1/media/upload-media/uploading-media/media-best-practices
+const (
+	maxImages     = 4
+	maxImageBytes = 5 << 20
+	maxGIFBytes   = 15 << 20
+	maxVideoBytes = 512 << 20
+	maxAltText    = 1000
+
+	// The size of each APPEND segment of a chunked upload.
+	uploadChunkSize = 1 << 20
+
+	// Bounds on waiting for uploaded media to be processed.
+	minProcessingPoll = 1 * time.Second
+	maxProcessingWait = 10 * time.Minute
+)
+
+// A mediaFile is a file to upload and attach to a tweet.
+type mediaFile struct {
+	path     string
+	alt      string // alt text, or ""
+	size     int64
+	mimeType string
+	category string // tweet_image, tweet_gif, or tweet_video
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string     { return strings.Join(*s, ", ") }
+func (s *stringList) Set(v string) error { *s = append(*s, v); return nil }
+
+// checkMedia checks the files to be attached to a tweet, pairs them with alt
+// text in order, and reports an error if the combination is not allowed.
+func checkMedia(paths, alts []string) ([]*mediaFile, error) {
+	if len(alts) > len(paths) {
+		return nil, fmt.Errorf("got %d -alt texts for %d -media files", len(alts), len(paths))
+	}
+	var mfs []*mediaFile
+	var numImages, numOther int
+	for i, path := range paths {
+		mf, err := statMedia(path)
+		if err != nil {
+			return nil, err
+		}
+		if i < len(alts) {
+			if n := len([]rune(alts[i])); n > maxAltText {
+				return nil, fmt.Errorf("alt text for %q is too long (%d > %d characters)", path, n, maxAltText)
+			}
+			mf.alt = alts[i]
+		}
+		if mf.category == "tweet_image" {
+			numImages++
+		} else {
+			numOther++
+		}
+		mfs = append(mfs, mf)
+	}
+	if numOther > 0 && len(mfs) > 1 {
+		return nil, errors.New("a GIF or video must be the only media in a tweet")
+	} else if numImages > maxImages {
+		return nil, fmt.Errorf("at most %d images may be attached to a tweet", maxImages)
+	}
+	return mfs, nil
+}
+
+// statMedia reports the size and type of the media file at path.
+func statMedia(path string) (*mediaFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	} else if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("media %q is not a regular file", path)
+	}
+	var head [512]byte
+	n, err := io.ReadFull(f, head[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("reading media: %w", err)
+	}
+	mimeType := http.DetectContentType(head[:n])
+	if mimeType == "application/octet-stream" {
+		mimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+
+	mf := &mediaFile{path: path, size: fi.Size(), mimeType: mimeType}
+	var limit int64
+	switch {
+	case mimeType == "image/gif":
+		mf.category, limit = "tweet_gif", maxGIFBytes
+	case mimeType == "image/jpeg" || mimeType == "image/png" || mimeType == "image/webp":
+		mf.category, limit = "tweet_image", maxImageBytes
+	case mimeType == "video/mp4" || mimeType == "video/quicktime":
+		mf.category, limit = "tweet_video", maxVideoBytes
+	default:
+		return nil, fmt.Errorf("media %q has unsupported type %q", path, mimeType)
+	}
+	if mf.size == 0 {
+		return nil, fmt.Errorf("media %q is empty", path)
+	} else if mf.size > limit {
+		return nil, fmt.Errorf("media %q is too large (%d > %d bytes)", path, mf.size, limit)
+	}
+	return mf, nil
+}
+
+// An uploader uploads media files with the chunked media upload API.
+// See: https://developer.twitter.com/en/docs/twitter-api/v1/media/upload-media/uploading-media/chunked-media-upload
+type uploader struct {
+	cli *twitter.Client // with the base URL of the upload API
+	log io.Writer       // progress messages
+}
+
+// mediaInfo is the response from the upload API.
+type mediaInfo struct {
+	MediaID        string `json:"media_id_string"`
+	ProcessingInfo *struct {
+		State          string `json:"state"` // pending, in_progress, failed, succeeded
+		CheckAfterSecs int    `json:"check_after_secs"`
+		Progress       int    `json:"progress_percent"`
+		Error          *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"processing_info"`
+}
+
+// upload uploads mf and returns its media ID. When upload returns, the media
+// is ready to be attached to a tweet.
+func (u uploader) upload(ctx context.Context, mf *mediaFile) (string, error) {
+	f, err := os.Open(mf.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	name := filepath.Base(mf.path)
+
+	info, err := u.call(ctx, &jape.Request{
+		Method:     "1.1/media/upload.json",
+		HTTPMethod: "POST",
+		Params: jape.Params{
+			"command":        []string{"INIT"},
+			"total_bytes":    []string{strconv.FormatInt(mf.size, 10)},
+			"media_type":     []string{mf.mimeType},
+			"media_category": []string{mf.category},
+		},
+	}, true)
+	if err != nil {
+		return "", fmt.Errorf("upload %s: init: %w", name, err)
+	}
+	mediaID := info.MediaID
+
+	buf := make([]byte, uploadChunkSize)
+	var sent int64
+	for seg := 0; ; seg++ {
+		n, err := io.ReadFull(f, buf)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return "", fmt.Errorf("upload %s: reading: %w", name, err)
+		}
+		if err := u.append(ctx, mediaID, seg, buf[:n]); err != nil {
+			return "", fmt.Errorf("upload %s: append segment %d: %w", name, seg, err)
+		}
+		sent += int64(n)
+		fmt.Fprintf(u.log, "upload %s: %d%% (%d of %d bytes)\n", name, sent*100/mf.size, sent, mf.size)
+	}
+
+	info, err = u.call(ctx, &jape.Request{
+		Method:     "1.1/media/upload.json",
+		HTTPMethod: "POST",
+		Params: jape.Params{
+			"command":  []string{"FINALIZE"},
+			"media_id": []string{mediaID},
+		},
+	}, true)
+	if err != nil {
+		return "", fmt.Errorf("upload %s: finalize: %w", name, err)
+	}
+
+	// Videos and GIFs are processed asynchronously after upload, and cannot be
+	// attached until processing is complete.
+	deadline := time.Now().Add(maxProcessingWait)
+	for info.ProcessingInfo != nil {
+		pi := info.ProcessingInfo
+		switch pi.State {
+		case "succeeded":
+			info.ProcessingInfo = nil
+			continue
+		case "failed":
+			msg := "unknown error"
+			if pi.Error != nil {
+				msg = pi.Error.Message
+			}
+			return "", fmt.Errorf("upload %s: processing failed: %s", name, msg)
+		}
+		wait := time.Duration(pi.CheckAfterSecs) * time.Second
+		if wait < minProcessingPoll {
+			wait = minProcessingPoll
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return "", fmt.Errorf("upload %s: processing did not finish within %v", name, maxProcessingWait)
+		}
+		fmt.Fprintf(u.log, "upload %s: processing %d%%, checking again in %v\n", name, pi.Progress, wait)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+		info, err = u.call(ctx, &jape.Request{
+			Method: "1.1/media/upload.json",
+			Params: jape.Params{
+				"command":  []string{"STATUS"},
+				"media_id": []string{mediaID},
+			},
+		}, false)
+		if err != nil {
+			return "", fmt.Errorf("upload %s: status: %w", name, err)
+		}
+	}
+
+	if mf.alt != "" {
+		if err := u.setAltText(ctx, mediaID, mf.alt); err != nil {
+			return "", fmt.Errorf("upload %s: alt text: %w", name, err)
+		}
+	}
+	return mediaID, nil
+}
+
+// call issues req and decodes the media info from its response. If form is
+// true, the parameters are sent in the request body.
+func (u uploader) call(ctx context.Context, req *jape.Request, form bool) (*mediaInfo, error) {
+	if form {
+		req.SetBodyToParams()
+	}
+	data, err := u.cli.CallRaw(ctx, req)
+	if err != nil {
+		if !isSuccess(err) {
+			return nil, err
+		}
+		data = err.(*jape.Error).Data
+	}
+	info := new(mediaInfo)
+	if len(data) != 0 {
+		if err := json.Unmarshal(data, info); err != nil {
+			return nil, &jape.Error{Data: data, Message: "decoding response body", Err: err}
+		}
+	}
+	return info, nil
+}
+
+// append uploads a segment of media data.
+func (u uploader) append(ctx context.Context, mediaID string, seg int, data []byte) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("media", "blob")
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	// The command parameters are sent in the query so that they are included
+	// in the request signature, which does not cover a multipart body.
+	_, err = u.cli.CallRaw(ctx, &jape.Request{
+		Method:     "1.1/media/upload.json",
+		HTTPMethod: "POST",
+		Params: jape.Params{
+			"command":       []string{"APPEND"},
+			"media_id":      []string{mediaID},
+			"segment_index": []string{strconv.Itoa(seg)},
+		},
+		Data:        body.Bytes(),
+		ContentType: w.FormDataContentType(),
+	})
+	if err != nil && !isSuccess(err) {
+		return err
+	}
+	return nil
+}
+
+// setAltText sets the alt text of an uploaded media object.
+func (u uploader) setAltText(ctx context.Context, mediaID, alt string) error {
+	var req struct {
+		MediaID string `json:"media_id"`
+		AltText struct {
+			Text string `json:"text"`
+		} `json:"alt_text"`
+	}
+	req.MediaID = mediaID
+	req.AltText.Text = alt
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	_, err = u.cli.CallRaw(ctx, &jape.Request{
+		Method:     "1.1/media/metadata/create.json",
+		HTTPMethod: "POST",
+		Data:       data,
+	})
+	if err != nil && !isSuccess(err) {
+		return err
+	}
+	return nil
+}
+
+// isSuccess reports whether err is from an API response with a successful
+// HTTP status other than 200 and 201, which the client treats as errors.
+// The upload API replies 202 Accepted or 204 No Content to some commands.
+func isSuccess(err error) bool {
+	jerr, ok := err.(*jape.Error)
+	return ok && jerr.Status >= 200 && jerr.Status < 300
+}
+
+// addFormParam adds a parameter to the form-encoded body of req. The ostatus
+// package does not have options for all the parameters of a status update.
+func addFormParam(req *jape.Request, name, value string) error {
+	form, err := url.ParseQuery(string(req.Data))
+	if err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	form.Set(name, value)
+	req.Data = []byte(form.Encode())
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/edit"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+var cmdHide = &command.C{
+	Name:  "hide",
+	Usage: "id|-|@file ...",
+	Help: `Hide the specified replies to the authorized user's tweets.
+
+Only replies in conversations started by the authorized user can be hidden.
+` + mutateHelp,
+	SetFlags: setMutateFlags,
+	Run: runWithID(nil, func(tweetID string) edit.Query {
+		return edit.SetRepliesHidden(tweetID, true)
+	}),
+}
+
+var cmdUnhide = &command.C{
+	Name:     "unhide",
+	Usage:    "id|-|@file ...",
+	Help:     "Unhide the specified replies to the authorized user's tweets.\n" + mutateHelp,
+	SetFlags: setMutateFlags,
+	Run: runWithID(nil, func(tweetID string) edit.Query {
+		return edit.SetRepliesHidden(tweetID, false)
+	}),
+}
+
+var moderateOpts struct {
+	match    string
+	author   string
+	list     bool
+	pace     time.Duration
+	rateWait time.Duration
+}
+
+var cmdModerate = &command.C{
+	Name:  "moderate",
+	Usage: "[-match regexp] [-author regexp] [-list] conversation-id",
+	Help: `Hide replies in a conversation that match the given rules.
+
+The replies in the conversation are found by searching recent tweets, so
+only replies from the last week are considered. A reply is selected if its
+text matches -match, or the username of its author matches -author; at
+least one of these must be set. Use "(?i)" for case-insensitive matching.
+Replies by the authorized user are never selected.
+
+The selected replies are shown, and you are asked to confirm before they
+are hidden; set -yes to skip confirmation. Set -list to print the selected
+replies without hiding them, or -dry-run to preview the replies that would
+be hidden.
+
+Replies are hidden one at a time, waiting -pace between them to stay within
+the rate limit. If the rate limit is exceeded anyway, hiding waits -rate-wait
+and tries again.`,
+
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+		fs.StringVar(&moderateOpts.match, "match", "", "Select replies whose text matches this regexp")
+		fs.StringVar(&moderateOpts.author, "author", "", "Select replies whose author's username matches this regexp")
+		fs.BoolVar(&moderateOpts.list, "list", false, "Print the selected replies without hiding them")
+		fs.DurationVar(&moderateOpts.pace, "pace", 18*time.Second, "Wait this long between replies hidden")
+		fs.DurationVar(&moderateOpts.rateWait, "rate-wait", 15*time.Minute, "Wait this long when rate limited")
+	},
+
+	Run: runModerate,
+}
+
+// A moderateRule selects replies by their text or the username of their
+// author. A nil pattern matches nothing.
+type moderateRule struct {
+	text, author *regexp.Regexp
+}
+
+func newModerateRule() (*moderateRule, error) {
+	var r moderateRule
+	var err error
+	if moderateOpts.match != "" {
+		if r.text, err = regexp.Compile(moderateOpts.match); err != nil {
+			return nil, fmt.Errorf("invalid -match: %w", err)
+		}
+	}
+	if moderateOpts.author != "" {
+		if r.author, err = regexp.Compile(moderateOpts.author); err != nil {
+			return nil, fmt.Errorf("invalid -author: %w", err)
+		}
+	}
+	if r.text == nil && r.author == nil {
+		return nil, errors.New("at least one of -match or -author must be set")
+	}
+	return &r, nil
+}
+
+func (r *moderateRule) selects(t *types.Tweet, username string) bool {
+	return (r.text != nil && r.text.MatchString(t.Text)) ||
+		(r.author != nil && username != "" && r.author.MatchString(username))
+}
+
+func runModerate(env *command.Env, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		return command.FailWithUsage(env, args)
+	}
+	convID := args[0]
+	if key, ok := config.KeyFromURL(convID); ok {
+		convID = key
+	}
+	rule, err := newModerateRule()
+	if err != nil {
+		return err
+	}
+
+	cfg := env.Config.(*config.Config)
+	cli, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+	ctx := cfg.Context()
+	var uid string
+	if ids, err := cfg.ResolveID(ctx, cli, []string{"@" + cfg.AuthUser}); err != nil {
+		return fmt.Errorf("resolving user: %w", err)
+	} else if len(ids) == 0 {
+		return fmt.Errorf("resolving user: %q not found", cfg.AuthUser)
+	} else {
+		uid = ids[0]
+	}
+
+	replies, names, err := conversationReplies(cli, cfg, convID)
+	if err != nil {
+		return err
+	}
+	var selected []*types.Tweet
+	for _, t := range replies {
+		if t.AuthorID != uid && rule.selects(t, names[t.AuthorID]) {
+			selected = append(selected, t)
+		}
+	}
+	fmt.Fprintf(env, "%d of %d replies in conversation %s match\n", len(selected), len(replies), convID)
+
+	if moderateOpts.list {
+		return config.PrintJSON(selected)
+	} else if len(selected) == 0 {
+		return nil
+	}
+	for i, t := range selected {
+		if i == maxShown {
+			fmt.Fprintf(env, "  ... and %d more\n", len(selected)-i)
+			break
+		}
+		fmt.Fprintf(env, "  %s @%s: %s\n", t.ID, names[t.AuthorID], strings.Join(strings.Fields(t.Text), " "))
+	}
+	if err := cfg.Confirm(env, fmt.Sprintf("Hide %d replies?", len(selected))); err != nil {
+		return err
+	}
+
+	var nfail int
+	for i, t := range selected {
+		if i > 0 && !cfg.DryRun {
+			if err := sleepContext(ctx, moderateOpts.pace); err != nil {
+				return err
+			}
+		}
+		ok, err := invokeRetry(ctx, env, cli, edit.SetRepliesHidden(t.ID, true), moderateOpts.rateWait)
+		if errors.Is(err, config.ErrDryRun) {
+			continue
+		} else if config.Interrupted(err) {
+			return err
+		} else if err != nil {
+			nfail++
+			fmt.Fprintf(env, "Hiding reply %s: %v\n", t.ID, err)
+			continue
+		}
+		fmt.Printf("%s: %v\n", t.ID, ok)
+	}
+	if nfail != 0 {
+		return fmt.Errorf("failed to hide %d replies", nfail)
+	}
+	return nil
+}
+
+// conversationReplies searches for the replies in the conversation with the
+// given ID. It returns the replies, newest first, and a map from the user ID
+// of each author to their username.
+func conversationReplies(cli *twitter.Client, cfg *config.Config, convID string) ([]*types.Tweet, map[string]string, error) {
+	ctx := cfg.Context()
+	q := tweets.SearchRecent("conversation_id:"+convID, &tweets.SearchOpts{
+		MaxResults: 100,
+		Optional: []types.Fields{
+			types.TweetFields{AuthorID: true, ConversationID: true},
+			types.Expansions{AuthorID: true},
+		},
+	})
+	var out []*types.Tweet
+	names := make(map[string]string)
+	for q.HasMorePages() {
+		rsp, err := q.Invoke(ctx, cli)
+		if err != nil {
+			return nil, nil, fmt.Errorf("searching conversation %s: %w", convID, err)
+		}
+		users, err := rsp.IncludedUsers()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, u := range users {
+			names[u.ID] = u.Username
+		}
+		cfg.RecordSeen(rsp.Tweets, users)
+		for _, t := range rsp.Tweets {
+			if t.ID != convID {
+				out = append(out, t)
+			}
+		}
+	}
+	return out, names, nil
+}
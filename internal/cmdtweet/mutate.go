@@ -0,0 +1,268 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/edit"
+	"github.com/creachadair/twitter/jape"
+)
+
+var mutateOpts struct {
+	workers  int
+	pace     time.Duration
+	rateWait time.Duration
+}
+
+// setMutateFlags sets the flags of the commands that apply a change to each
+// of a list of tweets.
+func setMutateFlags(_ *command.Env, fs *flag.FlagSet) {
+	fs.IntVar(&mutateOpts.workers, "workers", 4, "Maximum number of requests to send concurrently")
+	fs.DurationVar(&mutateOpts.pace, "pace", 0, "Wait at least this long between requests")
+	fs.DurationVar(&mutateOpts.rateWait, "rate-wait", 15*time.Minute, "Wait this long when rate limited")
+}
+
+// mutateHelp describes the behavior common to the commands using runWithID and runAsUser.
+const mutateHelp = `
+Any number of tweet IDs may be given, along with "-" to read IDs from stdin
+or "@file" to read them from the named file. Up to -workers requests are
+sent at once, at most one every -pace. If the rate limit is exceeded, the
+request waits -rate-wait and tries again.
+
+The status of each tweet is printed as "id: status", in the order given.
+The status is the result reported by the API, "already" if the change had
+already been made (for example, a tweet already retweeted), or "failed".
+A tweet that does not exist has status "failed". The command fails only if
+some tweet has status "failed".`
+
+// A mutateResult is the outcome of the change to one tweet.
+type mutateResult struct {
+	ok      bool  // the result reported by the API
+	already bool  // the change had already been made
+	err     error // the change failed
+}
+
+// runWithID returns a command that applies the query constructed by newQuery
+// to each tweet ID given as an argument. If check != nil, it is called with
+// the IDs before any change is made.
+func runWithID(check checkFunc, newQuery func(tid string) edit.Query) func(*command.Env, []string) error {
+	return runMutate(check, false, func(_, tid string) edit.Query { return newQuery(tid) })
+}
+
+// runAsUser is like runWithID, but for changes made on behalf of the
+// authorized user, whose ID is passed to newQuery.
+func runAsUser(newQuery func(uid, tid string) edit.Query) func(*command.Env, []string) error {
+	return runMutate(nil, true, newQuery)
+}
+
+func runMutate(check checkFunc, needUser bool, newQuery func(uid, tid string) edit.Query) func(*command.Env, []string) error {
+	return func(env *command.Env, args []string) error {
+		if len(args) == 0 {
+			return command.FailWithUsage(env, args)
+		} else if mutateOpts.workers <= 0 {
+			return fmt.Errorf("invalid -workers %d", mutateOpts.workers)
+		}
+		tweetIDs, err := config.ReadKeys(args)
+		if err != nil {
+			return err
+		} else if len(tweetIDs) == 0 {
+			return errors.New("no tweet IDs were given")
+		}
+		cfg := env.Config.(*config.Config)
+		if needUser && cfg.AuthUser == "" {
+			return errors.New("this command requires -auth-user")
+		}
+		cli, err := cfg.NewClient()
+		if err != nil {
+			return fmt.Errorf("creating client: %w", err)
+		}
+
+		if check != nil {
+			if err := check(env, cli, tweetIDs); err != nil {
+				return err
+			}
+		}
+
+		ctx := cfg.Context()
+		var uid string
+		if needUser {
+			ids, err := cfg.ResolveID(ctx, cli, []string{"@" + cfg.AuthUser})
+			if err != nil {
+				return fmt.Errorf("resolving user: %w", err)
+			} else if len(ids) == 0 {
+				return fmt.Errorf("resolving user: %q not found", cfg.AuthUser)
+			}
+			uid = ids[0]
+		}
+
+		results := mutateAll(ctx, env, cli, tweetIDs, func(tweetID string) edit.Query {
+			return newQuery(uid, tweetID)
+		})
+		var nok, nalready, nfail, nleft int
+		var failErr error
+		for i, tweetID := range tweetIDs {
+			r := <-results[i]
+			switch {
+			case errors.Is(r.err, config.ErrDryRun):
+				if len(tweetIDs) == 1 {
+					return r.err
+				}
+			case config.Interrupted(r.err):
+				nleft++
+			case r.err != nil:
+				nfail++
+				failErr = r.err
+				fmt.Printf("%s: failed\n", tweetID)
+				fmt.Fprintf(env, "Tweet %s: %v\n", tweetID, r.err)
+			case r.already:
+				nalready++
+				fmt.Printf("%s: already\n", tweetID)
+			default:
+				nok++
+				fmt.Printf("%s: %v\n", tweetID, r.ok)
+			}
+		}
+		if len(tweetIDs) > 1 {
+			fmt.Fprintf(env, "succeeded: %d, already done: %d, failed: %d, remaining: %d\n", nok, nalready, nfail, nleft)
+		}
+		if nleft != 0 {
+			return ctx.Err()
+		} else if nfail == 1 {
+			return failErr
+		} else if nfail != 0 {
+			return fmt.Errorf("%d of %d changes failed", nfail, len(tweetIDs))
+		}
+		return nil
+	}
+}
+
+// mutateAll applies the query constructed by newQuery to each of the given
+// tweet IDs, with at most -workers requests active at once. It returns a
+// channel for each ID, in the same order, that delivers the outcome for that
+// ID when it is complete.
+func mutateAll(ctx context.Context, env *command.Env, cli *twitter.Client, tweetIDs []string, newQuery func(string) edit.Query) []chan mutateResult {
+	out := make([]chan mutateResult, len(tweetIDs))
+	for i := range out {
+		out[i] = make(chan mutateResult, 1)
+	}
+
+	// In a dry run, the requests are printed rather than sent, so send them
+	// one at a time and without pacing to keep the output in order.
+	cfg := env.Config.(*config.Config)
+	workers, pace := mutateOpts.workers, &pacer{interval: mutateOpts.pace}
+	if cfg.DryRun {
+		workers, pace = 1, &pacer{}
+	}
+
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range tweetIDs {
+			next <- i
+		}
+	}()
+	for w := 0; w < workers && w < len(tweetIDs); w++ {
+		go func() {
+			for i := range next {
+				if err := pace.wait(ctx); err != nil {
+					out[i] <- mutateResult{err: err}
+					continue
+				}
+				q := newQuery(tweetIDs[i])
+				ok, err := invokeRetry(ctx, env, cli, q, mutateOpts.rateWait)
+				if alreadyDone(q, err) {
+					out[i] <- mutateResult{already: true}
+				} else {
+					out[i] <- mutateResult{ok: ok, err: err}
+				}
+			}
+		}()
+	}
+	return out
+}
+
+// invokeRetry invokes q, waiting rateWait and trying again while the rate
+// limit is exceeded.
+func invokeRetry(ctx context.Context, env *command.Env, cli *twitter.Client, q edit.Query, rateWait time.Duration) (bool, error) {
+	for {
+		ok, err := q.Invoke(ctx, cli)
+		var jerr *jape.Error
+		if !errors.As(err, &jerr) || jerr.Status != http.StatusTooManyRequests {
+			return ok, err
+		}
+		fmt.Fprintf(env, "Rate limit exceeded, waiting %v to retry\n", rateWait)
+		if err := sleepContext(ctx, rateWait); err != nil {
+			return false, err
+		}
+	}
+}
+
+// alreadyDone reports whether err shows that the change requested by q had
+// already been made. The API reports a tweet already retweeted as forbidden.
+// Removing a like or retweet that is already gone may be reported as not
+// found, but so is a tweet or user that does not exist, so a not-found error
+// counts only if it names some other resource, showing that the tweet and
+// user exist.
+func alreadyDone(q edit.Query, err error) bool {
+	var jerr *jape.Error
+	if !errors.As(err, &jerr) {
+		return false
+	}
+	switch jerr.Status {
+	case http.StatusNotFound:
+		if q.HTTPMethod != http.MethodDelete {
+			return false
+		}
+		var problem struct {
+			ResourceType string `json:"resource_type"`
+		}
+		if json.Unmarshal(jerr.Data, &problem) != nil {
+			return false
+		}
+		switch problem.ResourceType {
+		case "", "tweet", "user":
+			return false
+		}
+		return true
+	case http.StatusForbidden:
+		return bytes.Contains(bytes.ToLower(jerr.Data), []byte("already"))
+	}
+	return false
+}
+
+// A pacer spaces out the requests of concurrent workers so that successive
+// requests start at least interval apart.
+type pacer struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // when the next request may start
+}
+
+// wait blocks until the next request may start, or ctx ends.
+func (p *pacer) wait(ctx context.Context) error {
+	if p.interval <= 0 {
+		return ctx.Err()
+	}
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next
+	if at.Before(now) {
+		at = now
+	}
+	p.next = at.Add(p.interval)
+	p.mu.Unlock()
+	return sleepContext(ctx, time.Until(at))
+}
@@ -0,0 +1,42 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/creachadair/twitter/edit"
+	"github.com/creachadair/twitter/jape"
+)
+
+func TestAlreadyDone(t *testing.T) {
+	del := edit.Query{Request: &jape.Request{HTTPMethod: http.MethodDelete}}
+	post := edit.Query{Request: &jape.Request{HTTPMethod: http.MethodPost}}
+	apiError := func(status int, data string) error {
+		return &jape.Error{Status: status, Data: []byte(data)}
+	}
+	tests := []struct {
+		name string
+		q    edit.Query
+		err  error
+		want bool
+	}{
+		{"Success", del, nil, false},
+		{"OtherError", del, errors.New("bad"), false},
+		{"Retweeted", post, apiError(http.StatusForbidden, `{"detail":"You have already retweeted this Tweet."}`), true},
+		{"Forbidden", post, apiError(http.StatusForbidden, `{"detail":"Not allowed."}`), false},
+		{"NoTweet", del, apiError(http.StatusNotFound, `{"resource_type":"tweet","value":"999"}`), false},
+		{"NoUser", del, apiError(http.StatusNotFound, `{"resource_type":"user","value":"1"}`), false},
+		{"NoDetail", del, apiError(http.StatusNotFound, `{"title":"Not Found"}`), false},
+		{"NotJSON", del, apiError(http.StatusNotFound, `not found`), false},
+		{"Gone", del, apiError(http.StatusNotFound, `{"resource_type":"like","value":"101"}`), true},
+		{"NotDelete", post, apiError(http.StatusNotFound, `{"resource_type":"like","value":"101"}`), false},
+	}
+	for _, tc := range tests {
+		if got := alreadyDone(tc.q, tc.err); got != tc.want {
+			t.Errorf("alreadyDone %s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
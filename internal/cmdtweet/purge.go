@@ -0,0 +1,340 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/archive"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/edit"
+	"github.com/creachadair/twitter/jape"
+)
+
+var purgeOpts struct {
+	archive     string
+	since       string
+	until       string
+	match       string
+	retweets    string
+	replies     string
+	maxLikes    int
+	maxRetweets int
+	list        bool
+	pace        time.Duration
+	rateWait    time.Duration
+	progress    string
+}
+
+// Results recorded in the purge progress log.
+const (
+	purgeDeleted = "deleted" // the tweet was deleted
+	purgeMissing = "missing" // the tweet was already gone
+)
+
+var cmdPurge = &command.C{
+	Name:  "purge",
+	Usage: "-archive path [options]",
+	Help: `Delete tweets listed in a Twitter data archive.
+
+The -archive is the zip file of an account archive, the directory where it
+has been unpacked, or the tweets.js file from its data directory. The tweets
+it lists are selected by the filters below, and the number selected is
+shown. You are asked to confirm before any are deleted; set -yes to skip
+confirmation, or -list to print the selected tweets without deleting them.
+
+Filters:
+  -since, -until   only tweets posted on or after -since, or before -until
+                   (a date "2006-01-02" in local time, or an RFC 3339 time)
+  -match           only tweets whose text matches this regular expression
+                   (use "(?i)" for case-insensitive matching)
+  -retweets        include, exclude, or only retweets
+  -replies         include, exclude, or only replies
+  -max-likes       only tweets with at most this many likes
+  -max-retweets    only tweets retweeted at most this many times
+
+Tweets are deleted one at a time, waiting -pace between deletions to stay
+within the rate limit. If the rate limit is exceeded anyway, deletion waits
+-rate-wait and tries again.
+
+Each tweet deleted (or found to be already gone) is recorded in a progress
+log, and tweets recorded there are skipped. If a purge is interrupted, run
+the same command again to continue where it stopped.`,
+
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+		fs.StringVar(&purgeOpts.archive, "archive", "", "Path of the data archive (required)")
+		fs.StringVar(&purgeOpts.since, "since", "", "Only tweets posted on or after this date")
+		fs.StringVar(&purgeOpts.until, "until", "", "Only tweets posted before this date")
+		fs.StringVar(&purgeOpts.match, "match", "", "Only tweets whose text matches this regexp")
+		fs.StringVar(&purgeOpts.retweets, "retweets", "include", "Retweets to select (include, exclude, only)")
+		fs.StringVar(&purgeOpts.replies, "replies", "include", "Replies to select (include, exclude, only)")
+		fs.IntVar(&purgeOpts.maxLikes, "max-likes", -1, "Only tweets with at most this many likes (-1 for any)")
+		fs.IntVar(&purgeOpts.maxRetweets, "max-retweets", -1, "Only tweets with at most this many retweets (-1 for any)")
+		fs.BoolVar(&purgeOpts.list, "list", false, "Print the selected tweets without deleting them")
+		fs.DurationVar(&purgeOpts.pace, "pace", 18*time.Second, "Wait this long between deletions")
+		fs.DurationVar(&purgeOpts.rateWait, "rate-wait", 15*time.Minute, "Wait this long when rate limited")
+		fs.StringVar(&purgeOpts.progress, "progress", "", "Progress log path (default purge.log in the config directory)")
+	},
+
+	Run: runPurge,
+}
+
+// A purgeItem is the summary of a selected tweet printed by -list. Its "id"
+// field allows the output to be piped to other tweet commands.
+type purgeItem struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Text      string    `json:"text"`
+	Likes     int64     `json:"likes"`
+	Retweets  int64     `json:"retweets"`
+	InReplyTo string    `json:"in_reply_to,omitempty"`
+}
+
+// A purgeFilter selects tweets from an archive.
+type purgeFilter struct {
+	since, until time.Time
+	match        *regexp.Regexp
+	retweets     string
+	replies      string
+	maxLikes     int
+	maxRetweets  int
+}
+
+func newPurgeFilter() (*purgeFilter, error) {
+	f := &purgeFilter{
+		retweets:    purgeOpts.retweets,
+		replies:     purgeOpts.replies,
+		maxLikes:    purgeOpts.maxLikes,
+		maxRetweets: purgeOpts.maxRetweets,
+	}
+	var err error
+	if f.since, err = config.ParseDate(purgeOpts.since); err != nil {
+		return nil, fmt.Errorf("invalid -since: %w", err)
+	}
+	if f.until, err = config.ParseDate(purgeOpts.until); err != nil {
+		return nil, fmt.Errorf("invalid -until: %w", err)
+	}
+	if purgeOpts.match != "" {
+		if f.match, err = regexp.Compile(purgeOpts.match); err != nil {
+			return nil, fmt.Errorf("invalid -match: %w", err)
+		}
+	}
+	for _, v := range []string{f.retweets, f.replies} {
+		switch v {
+		case "include", "exclude", "only":
+		default:
+			return nil, fmt.Errorf("invalid selection %q (want include, exclude, or only)", v)
+		}
+	}
+	return f, nil
+}
+
+// selectKind reports whether a tweet that is (or is not) of some kind is
+// selected by sel, which is "include", "exclude", or "only".
+func selectKind(sel string, is bool) bool {
+	return sel == "include" || (sel == "only") == is
+}
+
+func (f *purgeFilter) selects(t *archive.Tweet) bool {
+	at := t.CreatedAt.Time
+	return (f.since.IsZero() || !at.Before(f.since)) &&
+		(f.until.IsZero() || at.Before(f.until)) &&
+		(f.match == nil || f.match.MatchString(t.Text)) &&
+		selectKind(f.retweets, t.IsRetweet()) &&
+		selectKind(f.replies, t.IsReply()) &&
+		(f.maxLikes < 0 || int(t.FavoriteCount) <= f.maxLikes) &&
+		(f.maxRetweets < 0 || int(t.RetweetCount) <= f.maxRetweets)
+}
+
+func runPurge(env *command.Env, args []string) error {
+	if len(args) != 0 {
+		return command.FailWithUsage(env, args)
+	} else if purgeOpts.archive == "" {
+		return errors.New("missing required -archive path")
+	}
+	filter, err := newPurgeFilter()
+	if err != nil {
+		return err
+	}
+	a, err := archive.Open(purgeOpts.archive)
+	if err != nil {
+		return err
+	}
+	all, err := a.Tweets()
+	a.Close()
+	if err != nil {
+		return err
+	}
+
+	logPath, err := config.DataPath(purgeOpts.progress, "purge.log")
+	if err != nil {
+		return err
+	}
+	done, err := readPurgeLog(logPath)
+	if err != nil {
+		return err
+	}
+
+	var todo []*archive.Tweet
+	var nsel int
+	for _, t := range all {
+		if filter.selects(t) {
+			nsel++
+			if done[t.ID] == "" {
+				todo = append(todo, t)
+			}
+		}
+	}
+	fmt.Fprintf(env, "%d of %d tweets in the archive match", nsel, len(all))
+	if n := nsel - len(todo); n != 0 {
+		fmt.Fprintf(env, "; %d already done (see %s)", n, logPath)
+	}
+	fmt.Fprintln(env)
+
+	if purgeOpts.list {
+		for _, t := range todo {
+			if err := config.PrintJSON(purgeItem{
+				ID:        t.ID,
+				CreatedAt: t.CreatedAt.Time,
+				Text:      t.Text,
+				Likes:     int64(t.FavoriteCount),
+				Retweets:  int64(t.RetweetCount),
+				InReplyTo: t.InReplyToStatusID,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else if len(todo) == 0 {
+		return nil
+	}
+	cfg := env.Config.(*config.Config)
+	if err := cfg.Confirm(env, fmt.Sprintf("Delete %d tweets?", len(todo))); err != nil {
+		return err
+	}
+	cli, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+
+	log, err := openPurgeLog(logPath)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	ctx := cfg.Context()
+	var ndel, nmiss, nfail int
+	for i, t := range todo {
+		if i > 0 && !cfg.DryRun {
+			if err := sleepContext(ctx, purgeOpts.pace); err != nil {
+				break
+			}
+		}
+		ok, err := deleteTweet(ctx, env, cli, t.ID)
+		if errors.Is(err, config.ErrDryRun) {
+			continue
+		} else if config.Interrupted(err) {
+			break
+		}
+		var jerr *jape.Error
+		if errors.As(err, &jerr) && jerr.Status == http.StatusNotFound {
+			ok, err = false, nil
+		}
+		if err != nil {
+			nfail++
+			fmt.Fprintf(env, "Deleting tweet %s: %v\n", t.ID, err)
+			continue
+		}
+		result := purgeDeleted
+		if ok {
+			ndel++
+		} else {
+			nmiss++
+			result = purgeMissing
+		}
+		if _, err := fmt.Fprintf(log, "%s\t%s\n", t.ID, result); err != nil {
+			return fmt.Errorf("writing progress log: %w", err)
+		}
+	}
+	fmt.Printf("deleted: %d, already gone: %d, failed: %d, remaining: %d\n",
+		ndel, nmiss, nfail, len(todo)-ndel-nmiss)
+	if ctx.Err() != nil || nfail != 0 {
+		fmt.Fprintln(env, "To continue, run the same command again.")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	} else if nfail != 0 {
+		return fmt.Errorf("failed to delete %d tweets", nfail)
+	}
+	return nil
+}
+
+// deleteTweet deletes the tweet with the given ID, waiting and trying again
+// while the rate limit is exceeded.
+func deleteTweet(ctx context.Context, env *command.Env, cli *twitter.Client, id string) (bool, error) {
+	return invokeRetry(ctx, env, cli, edit.DeleteTweet(id), purgeOpts.rateWait)
+}
+
+// sleepContext waits for d to elapse or ctx to end, and reports an error in
+// the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// readPurgeLog reads the results recorded in the progress log at path, as a
+// map from tweet ID to result. If the file does not exist, the map is empty.
+func readPurgeLog(path string) (map[string]string, error) {
+	done := make(map[string]string)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading progress log: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if id, result, ok := strings.Cut(strings.TrimSpace(sc.Text()), "\t"); ok {
+			done[id] = result
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading progress log: %w", err)
+	}
+	return done, nil
+}
+
+// openPurgeLog opens the progress log at path for appending.
+func openPurgeLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening progress log: %w", err)
+	}
+	return f, nil
+}
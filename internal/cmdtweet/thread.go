@@ -0,0 +1,298 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmdtweet
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/tweettext"
+	"github.com/creachadair/twitter/types"
+	"golang.org/x/text/unicode/norm"
+)
+
+var threadOpts struct {
+	number    bool
+	resume    int
+	inReplyTo string
+	preview   bool
+}
+
+var cmdThread = &command.C{
+	Name:  "thread",
+	Usage: "[file | -]",
+	Help: `Post a thread of tweets from the text of a file or stdin.
+
+The text is split into tweets, and each tweet is posted as a reply to the
+one before it. If the text contains lines consisting only of "---", it is
+split at those lines, and each part must fit in a single tweet. Otherwise,
+paragraphs (separated by blank lines) are packed into as few tweets as
+possible, and paragraphs too long for one tweet are split between sentences,
+or between words if a sentence is too long.
+
+Set -number to append the position of each tweet in the thread ("1/5").
+Set -preview to print the tweets without posting them. Set -reply-to to
+post the first tweet as a reply to an existing tweet.
+
+If posting fails partway through, the number of tweets posted is reported,
+along with the flags needed to post the rest: -resume N starts the thread
+from tweet N, as a reply to the -reply-to tweet. Splitting does not depend
+on anything but the text and flags, so resuming with the same text and
+flags continues where the thread left off.`,
+
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) {
+		fs.BoolVar(&threadOpts.number, "number", false, "Number the tweets of the thread (1/n)")
+		fs.IntVar(&threadOpts.resume, "resume", 1, "Start posting from this tweet of the thread")
+		fs.StringVar(&threadOpts.inReplyTo, "reply-to", "", "Post the first tweet as a reply to this tweet ID or URL")
+		fs.BoolVar(&threadOpts.preview, "preview", false, "Print the tweets without posting them")
+	},
+
+	Run: func(env *command.Env, args []string) error {
+		if len(args) > 1 {
+			return command.FailWithUsage(env, args)
+		}
+		text, err := readText(args)
+		if err != nil {
+			return err
+		}
+		parts, err := splitThread(text, maxTweetLength, threadOpts.number)
+		if err != nil {
+			return err
+		} else if len(parts) == 0 {
+			return errors.New("no text to post")
+		}
+		for i, part := range parts {
+			if err := CheckText(part); err != nil {
+				return fmt.Errorf("tweet %d: %w", i+1, err)
+			}
+		}
+		if threadOpts.preview {
+			for i, part := range parts {
+				ti := parseText(part, maxTweetLength)
+				fmt.Printf("--- %d/%d (%d characters", i+1, len(parts), ti.Length)
+				if len(ti.Mentions) != 0 {
+					fmt.Printf("; mentions %s", tweettext.Join(ti.Mentions))
+				}
+				if len(ti.Hashtags) != 0 {
+					fmt.Printf("; hashtags %s", tweettext.Join(ti.Hashtags))
+				}
+				fmt.Printf(")\n%s\n", part)
+			}
+			return nil
+		}
+
+		start := threadOpts.resume
+		prev := config.ParseKey(threadOpts.inReplyTo)
+		if start < 1 || start > len(parts) {
+			return fmt.Errorf("-resume %d is out of range (the thread has %d tweets)", start, len(parts))
+		} else if start > 1 && prev == "" {
+			return errors.New("-resume requires -reply-to with the ID of the last tweet posted")
+		}
+
+		cfg := env.Config.(*config.Config)
+		ctx := cfg.Context()
+		cli, err := cfg.NewClient()
+		if err != nil {
+			return fmt.Errorf("creating client: %w", err)
+		}
+		for i := start; i <= len(parts); i++ {
+			p := &Post{text: parts[i-1], inReplyTo: prev}
+			tw, err := p.Send(ctx, env, cli, types.TweetFields{})
+			if errors.Is(err, config.ErrDryRun) {
+				prev = "dry-run-" + strconv.Itoa(i) // stand-in for the ID of the tweet
+				continue
+			} else if err != nil {
+				fmt.Fprintf(env, "Posted %d of %d tweets.\n", i-1, len(parts))
+				if prev != "" {
+					fmt.Fprintf(env, "To post the rest, re-run with -resume %d -reply-to %s\n", i, prev)
+				}
+				return fmt.Errorf("posting tweet %d: %w", i, err)
+			}
+			if err := config.PrintJSON(tw); err != nil {
+				return err
+			} else if len(tw) == 0 {
+				return fmt.Errorf("posting tweet %d: no tweet was returned", i)
+			}
+			prev = tw[0].ID
+		}
+		return nil
+	},
+}
+
+// readText reads the text named by args, which is either a single filename,
+// "-" for stdin, or empty for stdin.
+func readText(args []string) (string, error) {
+	var data []byte
+	var err error
+	if len(args) == 0 || args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading text: %w", err)
+	}
+	return norm.NFC.String(strings.ReplaceAll(string(data), "\r\n", "\n")), nil
+}
+
+var (
+	threadSeparator = regexp.MustCompile(`(?m)^[ \t]*---[ \t]*$`)
+	paraBreak       = regexp.MustCompile(`\n[ \t]*\n`)
+)
+
+// splitThread splits text into tweets of at most limit characters. If number
+// is true, each tweet ends with its position in the thread, within the limit.
+func splitThread(text string, limit int, number bool) ([]string, error) {
+	if !number {
+		return splitText(text, limit)
+	}
+
+	// The space needed for numbering depends on the number of tweets, which
+	// depends on the space left for the text. Start with one digit, and add
+	// more until the count fits.
+	for digits := 1; ; digits++ {
+		reserve := len(" /") + 2*digits
+		parts, err := splitText(text, limit-reserve)
+		if err != nil {
+			return nil, err
+		} else if len(strconv.Itoa(len(parts))) > digits {
+			continue
+		}
+		for i, part := range parts {
+			parts[i] = fmt.Sprintf("%s %d/%d", part, i+1, len(parts))
+		}
+		return parts, nil
+	}
+}
+
+// splitText splits text into chunks of at most limit characters, at explicit
+// separators if text has any, or else at paragraph, sentence, or word
+// boundaries.
+func splitText(text string, limit int) ([]string, error) {
+	if threadSeparator.MatchString(text) {
+		var parts []string
+		for _, part := range threadSeparator.Split(text, -1) {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			} else if ti := parseText(part, limit); ti.Overflow >= 0 {
+				return nil, fmt.Errorf("part %d is too long (%d > %d characters); the excess begins at %q",
+					len(parts)+1, ti.Length, limit, snippet([]rune(part)[ti.Overflow:], 20))
+			}
+			parts = append(parts, part)
+		}
+		return parts, nil
+	}
+
+	// Break the text into units that fit, each with the separator that joins
+	// it to the unit before it, then pack the units greedily.
+	type unit struct{ sep, text string }
+	var units []unit
+	for _, para := range paraBreak.Split(text, -1) {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		} else if tweetLength(para) <= limit {
+			units = append(units, unit{"\n\n", para})
+			continue
+		}
+		sep := "\n\n"
+		for _, sent := range splitSentences(para) {
+			if tweetLength(sent) <= limit {
+				units = append(units, unit{sep, sent})
+			} else {
+				for _, word := range splitWords(sent, limit) {
+					units = append(units, unit{sep, word})
+					sep = " "
+				}
+			}
+			sep = " "
+		}
+	}
+
+	var parts []string
+	var cur string
+	for _, u := range units {
+		if cur == "" {
+			cur = u.text
+		} else if next := cur + u.sep + u.text; tweetLength(next) <= limit {
+			cur = next
+		} else {
+			parts = append(parts, cur)
+			cur = u.text
+		}
+	}
+	if cur != "" {
+		parts = append(parts, cur)
+	}
+	return parts, nil
+}
+
+// splitSentences splits s after each sentence-ending punctuation mark that is
+// followed by whitespace. Closing quotes and brackets stay with the sentence.
+func splitSentences(s string) []string {
+	var out []string
+	rs := []rune(s)
+	start := 0
+	for i := 0; i < len(rs); i++ {
+		if !strings.ContainsRune(".!?…", rs[i]) {
+			continue
+		}
+		end := i + 1
+		for end < len(rs) && strings.ContainsRune(`"')]”’`, rs[end]) {
+			end++
+		}
+		if end < len(rs) && unicode.IsSpace(rs[end]) {
+			out = append(out, strings.TrimSpace(string(rs[start:end])))
+			start = end
+			i = end
+		}
+	}
+	if rest := strings.TrimSpace(string(rs[start:])); rest != "" {
+		out = append(out, rest)
+	}
+	return out
+}
+
+// splitWords splits s into chunks of at most limit characters between words.
+// Words longer than limit are split between characters.
+func splitWords(s string, limit int) []string {
+	var out []string
+	var cur string
+	for _, word := range strings.Fields(s) {
+		for tweetLength(word) > limit {
+			rs := []rune(word)
+			n := fitPrefix(word, limit)
+			if n == 0 {
+				n = 1 // a single character longer than the limit
+			}
+			if cur != "" {
+				out = append(out, cur)
+				cur = ""
+			}
+			out = append(out, string(rs[:n]))
+			word = string(rs[n:])
+		}
+		if cur == "" {
+			cur = word
+		} else if next := cur + " " + word; tweetLength(next) <= limit {
+			cur = next
+		} else {
+			out = append(out, cur)
+			cur = word
+		}
+	}
+	if cur != "" {
+		out = append(out, cur)
+	}
+	return out
+}
@@ -4,11 +4,14 @@ package cmduser
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter"
+	"github.com/creachadair/twitter/types"
 	"github.com/creachadair/twitter/users"
 )
 
@@ -21,10 +24,27 @@ Look up the specified user IDs or usernames.
 Each argument is either a username (@name), user ID (12345), or an optional
 field specifier.  A field specifier has the form type:field, e.g., user:entities
 As a special case, :field is shorthand for "user:field".
+
+An argument "-" reads usernames or IDs from stdin, one per line, and
+"@file" reads them from the named file. Lines containing JSON objects
+contribute their "id" field.
+
+Any number of keys may be given. Keys beyond the API limit of 100 per
+request are looked up in multiple batches, and the results are printed
+in the order of the keys.
+
+Use "user liked-tweets" to list the tweets a user has liked.
 `,
 
+	Commands: []*command.C{cmdLikedTweets},
+
 	Run: func(env *command.Env, args []string) error {
 		parsed := config.ParseArgs(args, "user")
+		keys, err := config.ReadKeys(parsed.Keys)
+		if err != nil {
+			return err
+		}
+		parsed.Keys = keys
 		if len(parsed.Keys) == 0 {
 			fmt.Fprintln(env, "Error: no usernames or IDs were specified")
 			return command.FailWithUsage(env, args)
@@ -38,33 +58,77 @@ As a special case, :field is shorthand for "user:field".
 			}
 		}
 
-		ctx := context.Background()
-		cli, err := env.Config.(*config.Config).NewClient()
+		cfg := env.Config.(*config.Config)
+		ctx := cfg.Context()
+		cli, err := cfg.NewClient()
 		if err != nil {
 			return fmt.Errorf("creating client: %w", err)
 		}
-		if len(ids) != 0 {
-			rsp, err := users.Lookup(ids[0], &users.LookupOpts{
-				More:     ids[1:],
-				Optional: parsed.Fields,
-			}).Invoke(ctx, cli)
-			if err != nil {
-				return err
-			} else if err := config.PrintJSON(rsp.Users); err != nil {
-				return err
-			}
+		cache, err := cfg.UserCache()
+		if err != nil {
+			return err
 		}
-		if len(names) != 0 {
-			rsp, err := users.LookupByName(names[0], &users.LookupOpts{
-				More:     names[1:],
-				Optional: parsed.Fields,
-			}).Invoke(ctx, cli)
-			if err != nil {
-				return err
-			} else if err := config.PrintJSON(rsp.Users); err != nil {
-				return err
-			}
+
+		byID, idErr := lookupUsers(ctx, cli, users.Lookup, ids, parsed.Fields)
+		byName, nameErr := lookupUsers(ctx, cli, users.LookupByName, names, parsed.Fields)
+		err = errors.Join(idErr, nameErr)
+		if perr := printUsers(cfg, cache, inOrder(parsed.Keys, byID, byName)); perr != nil {
+			return perr
+		}
+		if serr := cache.Save(); serr != nil {
+			return errors.Join(err, fmt.Errorf("saving user cache: %w", serr))
 		}
-		return nil
+		return err
 	},
 }
+
+// inOrder returns the users found by ID and by name in the order of the keys
+// that requested them. Keys that were not found are omitted.
+func inOrder(keys []string, byID, byName types.Users) types.Users {
+	ids := make(map[string]*types.User)
+	for _, u := range byID {
+		ids[u.ID] = u
+	}
+	names := make(map[string]*types.User)
+	for _, u := range byName {
+		names[strings.ToLower(u.Username)] = u
+	}
+	var out types.Users
+	for _, key := range keys {
+		var u *types.User
+		if name, ok := strings.CutPrefix(key, "@"); ok {
+			u = names[strings.ToLower(name)]
+		} else {
+			u = ids[key]
+		}
+		if u != nil {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// printUsers prints us and records their usernames in the cache, and the
+// users in the local archive if that is enabled.
+func printUsers(cfg *config.Config, cache *config.UserCache, us types.Users) error {
+	for _, u := range us {
+		cache.Add(u.ID, u.Username)
+	}
+	cfg.RecordSeen(nil, us)
+	return config.PrintJSON(us)
+}
+
+// lookupUsers looks up the given user keys in batches using lookup.
+func lookupUsers(ctx context.Context, cli *twitter.Client, lookup func(string, *users.LookupOpts) users.Query,
+	keys []string, fields []types.Fields) (types.Users, error) {
+	return config.Batch(ctx, keys, func(ctx context.Context, keys []string) (types.Users, error) {
+		rsp, err := lookup(keys[0], &users.LookupOpts{
+			More:     keys[1:],
+			Optional: fields,
+		}).Invoke(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		return rsp.Users, config.ItemErrors(rsp.Errors)
+	})
+}
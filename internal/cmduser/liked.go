@@ -0,0 +1,66 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package cmduser
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twitter/tweets"
+	"github.com/creachadair/twitter/types"
+)
+
+var likedOpts config.PageOpts
+
+var cmdLikedTweets = &command.C{
+	Name:  "liked-tweets",
+	Usage: "[-max n] [-page token] username/id [tweet.fields...]",
+	Help: `List the tweets liked by the specified user, most recently liked first.
+
+` + config.PageHelp,
+
+	SetFlags: func(_ *command.Env, fs *flag.FlagSet) { likedOpts.SetFlags(fs) },
+
+	Run: runLikedTweets,
+}
+
+func runLikedTweets(env *command.Env, args []string) error {
+	parsed := config.ParseArgs(args, "tweet")
+	if len(parsed.Keys) != 1 {
+		fmt.Fprintln(env, "Error: exactly one username or ID is required")
+		return command.FailWithUsage(env, args)
+	}
+	cfg := env.Config.(*config.Config)
+	cli, err := cfg.NewClient()
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+
+	ctx := cfg.Context()
+	ids, err := cfg.ResolveID(ctx, cli, parsed.Keys)
+	if err != nil {
+		return fmt.Errorf("resolving user: %w", err)
+	} else if len(ids) == 0 {
+		return fmt.Errorf("resolving user: %q not found", parsed.Keys[0])
+	}
+
+	q := tweets.LikedBy(ids[0], &tweets.ListOpts{
+		PageToken:  likedOpts.PageToken,
+		MaxResults: config.PageSize(likedOpts.MaxResults, 10),
+		Optional:   parsed.Fields,
+	})
+	return config.Paginate(env, q.Request, likedOpts.MaxResults, q.HasMorePages, func() ([]*types.Tweet, error) {
+		rsp, err := q.Invoke(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		users, err := rsp.IncludedUsers()
+		if err != nil {
+			return nil, err
+		}
+		cfg.RecordSeen(rsp.Tweets, users)
+		return rsp.Tweets, nil
+	})
+}
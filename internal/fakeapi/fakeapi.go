@@ -0,0 +1,1287 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+// Package fakeapi implements an in-process fake of the parts of the Twitter
+// API used by twig, for testing.
+//
+// A Server is an http.Handler, and is typically run with httptest:
+//
+//	s := fakeapi.New()
+//	s.AddUser(&types.User{ID: "1", Username: "alice"})
+//	s.AddTweet(&types.Tweet{ID: "100", Text: "hello", AuthorID: "1"})
+//	hs := httptest.NewServer(s)
+//	defer hs.Close()
+//
+// The server keeps its state in memory, and mutations (likes, list edits,
+// new tweets, and so on) are reflected in subsequent queries. Listing
+// endpoints are paginated with PageSize results per page unless the client
+// requests fewer. Failures can be injected with the Fail method.
+package fakeapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creachadair/twitter/types"
+)
+
+// DefaultPageSize is the default number of results per page.
+const DefaultPageSize = 10
+
+// A Server is a fake Twitter API server. It is safe for concurrent use.
+type Server struct {
+	// The number of results per page for paginated endpoints.
+	PageSize int
+
+	mu        sync.Mutex
+	tweets    map[string]*types.Tweet
+	users     map[string]*types.User
+	lists     map[string]*list
+	follows   map[string][]string        // user ID → followed user IDs
+	likes     map[string]map[string]bool // user ID → liked tweet IDs
+	retweets  map[string]map[string]bool // user ID → retweeted tweet IDs
+	bookmarks map[string]map[string]bool // user ID → bookmarked tweet IDs
+	hidden    map[string]bool            // IDs of hidden replies
+	onRequest func(method, path string)
+	ruleSet   []*rule
+	stream    [][]string // tweet IDs for successive stream connections
+	numStream int        // number of stream connections so far
+	failures  []*failure
+	requests  []string
+	media     map[string]*Media
+	created   map[string][]byte // tweet ID → v2 create request body
+	nextID    int
+}
+
+// Media records the state of an uploaded media object.
+type Media struct {
+	ID       string
+	Type     string // MIME type
+	Category string
+	Size     int64 // declared size
+	Data     []byte
+	AltText  string
+
+	finalized bool
+	polls     int // STATUS requests remaining before processing succeeds
+}
+
+func (m *Media) ready() bool { return m.finalized && m.polls == 0 }
+
+func mediaKey(id string) string { return "3_" + id }
+
+type list struct {
+	types.List
+	members   []string
+	followers []string
+}
+
+type rule struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+type failure struct {
+	method, path string
+	status       int
+	skip         int // matching requests to allow before failing
+	count        int
+}
+
+// New constructs a new empty Server.
+func New() *Server {
+	return &Server{
+		PageSize:  DefaultPageSize,
+		tweets:    make(map[string]*types.Tweet),
+		users:     make(map[string]*types.User),
+		lists:     make(map[string]*list),
+		follows:   make(map[string][]string),
+		likes:     make(map[string]map[string]bool),
+		retweets:  make(map[string]map[string]bool),
+		bookmarks: make(map[string]map[string]bool),
+		hidden:    make(map[string]bool),
+		media:     make(map[string]*Media),
+		created:   make(map[string][]byte),
+		nextID:    9000,
+	}
+}
+
+// AddTweet adds or replaces a tweet. If the tweet has no creation time, the
+// current time is used.
+func (s *Server) AddTweet(t *types.Tweet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.CreatedAt == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		t.CreatedAt = &now
+	}
+	s.tweets[t.ID] = t
+}
+
+// Tweet returns the tweet with the given ID, or nil if it does not exist.
+func (s *Server) Tweet(id string) *types.Tweet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tweets[id]
+}
+
+// AddUser adds or replaces a user.
+func (s *Server) AddUser(u *types.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.ID] = u
+}
+
+// AddFollow records that user ID a follows user ID b.
+func (s *Server) AddFollow(a, b string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.follows[a] = append(s.follows[a], b)
+}
+
+// AddList adds or replaces a list with the given member user IDs.
+func (s *Server) AddList(l *types.List, members ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists[l.ID] = &list{List: *l, members: members}
+}
+
+// ListMembers returns the member IDs of the specified list.
+func (s *Server) ListMembers(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.lists[id]; ok {
+		return append([]string(nil), l.members...)
+	}
+	return nil
+}
+
+// AddLike records that user ID uid likes tweet ID tid.
+func (s *Server) AddLike(uid, tid string) { s.addMark(s.likes, uid, tid) }
+
+// AddRetweet records that user ID uid has retweeted tweet ID tid.
+func (s *Server) AddRetweet(uid, tid string) { s.addMark(s.retweets, uid, tid) }
+
+func (s *Server) addMark(marks map[string]map[string]bool, uid, tid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if marks[uid] == nil {
+		marks[uid] = make(map[string]bool)
+	}
+	marks[uid][tid] = true
+}
+
+// Liked reports whether user ID uid likes tweet ID tid.
+func (s *Server) Liked(uid, tid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.likes[uid][tid]
+}
+
+// Retweeted reports whether user ID uid has retweeted tweet ID tid.
+func (s *Server) Retweeted(uid, tid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retweets[uid][tid]
+}
+
+// Bookmarked reports whether user ID uid has bookmarked tweet ID tid.
+func (s *Server) Bookmarked(uid, tid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bookmarks[uid][tid]
+}
+
+// Hidden reports whether the reply with tweet ID tid is hidden.
+func (s *Server) Hidden(tid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hidden[tid]
+}
+
+// SetStream sets the tweet IDs delivered by the search stream. The nth
+// connection to the stream receives the nth batch of IDs, after which the
+// server closes the stream. Connections after the last batch receive the last
+// batch again.
+func (s *Server) SetStream(batches ...[]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = batches
+	s.numStream = 0
+}
+
+// Fail causes the next count requests matching method and path to fail with
+// the given HTTP status. The path is matched as a prefix of the request path,
+// for example "/2/tweets". If method == "", any method matches.
+func (s *Server) Fail(method, path string, status, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: path, status: status, count: count})
+}
+
+// FailAfter is like Fail, but allows skip matching requests to succeed before
+// the failures begin.
+func (s *Server) FailAfter(skip int, method, path string, status, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: path, status: status, skip: skip, count: count})
+}
+
+// OnRequest causes f to be called with the method and path of each request,
+// before the request is handled. If f == nil, the hook is removed.
+func (s *Server) OnRequest(f func(method, path string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRequest = f
+}
+
+// CreateRequest returns the body of the v2 request that created the tweet
+// with the given ID, or nil if it was not created that way.
+func (s *Server) CreateRequest(id string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created[id]
+}
+
+// Media returns the uploaded media with the given ID, or nil.
+func (s *Server) Media(id string) *Media {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.media[id]
+}
+
+// Requests returns a log of the requests received by the server, each in the
+// form "METHOD /path?query".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	for _, f := range s.failures {
+		if f.count > 0 && (f.method == "" || f.method == r.Method) && strings.HasPrefix(r.URL.Path, f.path) {
+			if f.skip > 0 {
+				f.skip--
+				continue
+			}
+			f.count--
+			s.mu.Unlock()
+			writeError(w, f.status, "injected failure")
+			return
+		}
+	}
+	onRequest := s.onRequest
+	s.mu.Unlock()
+
+	if onRequest != nil {
+		onRequest(r.Method, r.URL.Path)
+	}
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "missing authorization")
+		return
+	}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) < 2 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if path[0] == "2" && r.URL.Path == "/2/tweets/search/stream" {
+		s.serveStream(w, r)
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req := &request{Request: r, path: path[1:], body: body}
+	var v any
+	var err error
+	switch path[0] {
+	case "2":
+		v, err = s.serveV2(req)
+	case "1.1":
+		v, err = s.serveV1(req)
+	default:
+		err = errNotFound
+	}
+	if e, ok := err.(*httpError); ok {
+		writeError(w, e.status, e.msg)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if st, ok := v.(withStatus); ok {
+		if st.v == nil {
+			w.WriteHeader(st.code)
+			return
+		}
+		writeJSON(w, st.code, st.v)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// withStatus is a reply with an HTTP status other than 200 OK.
+// If v == nil, the reply has no body.
+type withStatus struct {
+	code int
+	v    any
+}
+
+type request struct {
+	*http.Request
+	path []string // without the version prefix
+	body []byte
+}
+
+// userContext reports whether the request has user-context (OAuth 1.0a)
+// authorization, rather than a bearer token.
+func (r *request) userContext() bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), "OAuth ")
+}
+
+// match reports whether the request has the given method and path, where a
+// path element "*" matches any value. Matched wildcard values are returned.
+func (r *request) match(method, pattern string) ([]string, bool) {
+	if r.Method != method {
+		return nil, false
+	}
+	want := strings.Split(pattern, "/")
+	if len(want) != len(r.path) {
+		return nil, false
+	}
+	var args []string
+	for i, w := range want {
+		if w == "*" {
+			args = append(args, r.path[i])
+		} else if w != r.path[i] {
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+func (r *request) param(name string) string { return r.URL.Query().Get(name) }
+
+func (r *request) list(name string) []string {
+	v := r.param(name)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func (r *request) decode(v any) error {
+	if err := json.Unmarshal(r.body, v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func (r *request) form() (url.Values, error) { return url.ParseQuery(string(r.body)) }
+
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+var errNotFound = &httpError{status: http.StatusNotFound, msg: "not found"}
+
+// errForbidden is reported for requests that require user-context
+// authorization but were made with a bearer token.
+var errForbidden = &httpError{status: http.StatusForbidden, msg: "user context required"}
+
+// reply is the general shape of an API v2 reply.
+type reply struct {
+	Data     any              `json:"data,omitempty"`
+	Includes map[string]any   `json:"includes,omitempty"`
+	Meta     any              `json:"meta,omitempty"`
+	Errors   []map[string]any `json:"errors,omitempty"`
+}
+
+type pageMeta struct {
+	ResultCount int    `json:"result_count"`
+	NextToken   string `json:"next_token,omitempty"`
+}
+
+func (s *Server) serveV2(r *request) (any, error) {
+	if _, ok := r.match("GET", "tweets"); ok {
+		return s.withAuthors(r, s.lookupTweets(r.list("ids"))), nil
+	}
+	if _, ok := r.match("POST", "tweets"); ok {
+		return s.createTweet(r)
+	}
+	if args, ok := r.match("DELETE", "tweets/*"); ok {
+		_, ok := s.tweets[args[0]]
+		delete(s.tweets, args[0])
+		return reply{Data: map[string]bool{"deleted": ok}}, nil
+	}
+	if args, ok := r.match("PUT", "tweets/*/hidden"); ok {
+		if !r.userContext() {
+			return nil, errForbidden
+		}
+		var req struct {
+			Hidden bool `json:"hidden"`
+		}
+		if err := r.decode(&req); err != nil {
+			return nil, err
+		}
+		if _, ok := s.tweets[args[0]]; !ok {
+			return nil, errNotFound
+		}
+		s.hidden[args[0]] = req.Hidden
+		return reply{Data: map[string]bool{"hidden": req.Hidden}}, nil
+	}
+	if args, ok := r.match("GET", "tweets/*/liking_users"); ok {
+		// The service does not paginate this listing, and rejects requests
+		// that try to.
+		if r.param("max_results") != "" || r.param("pagination_token") != "" {
+			return nil, &httpError{status: http.StatusBadRequest, msg: "pagination is not supported"}
+		}
+		return s.markedBy(r, s.likes, args[0])
+	}
+	if args, ok := r.match("GET", "tweets/*/retweeted_by"); ok {
+		return s.markedBy(r, s.retweets, args[0])
+	}
+	if args, ok := r.match("GET", "tweets/*/quote_tweets"); ok {
+		if err := checkPageSize(r, 10); err != nil {
+			return nil, err
+		}
+		if _, ok := s.tweets[args[0]]; !ok {
+			return nil, errNotFound
+		}
+		var out []*types.Tweet
+		for _, t := range s.sortedTweets() {
+			for _, ref := range t.Referenced {
+				if ref.Type == "quoted" && ref.ID == args[0] {
+					out = append(out, t)
+					break
+				}
+			}
+		}
+		return s.withAuthors(r, s.paginate(r, "pagination_token", out)), nil
+	}
+	if _, ok := r.match("GET", "tweets/search/recent"); ok {
+		var found []*types.Tweet
+		for _, t := range s.sortedTweets() {
+			if matchQuery(r.param("query"), t) {
+				found = append(found, t)
+			}
+		}
+		return s.withAuthors(r, s.paginate(r, "next_token", found)), nil
+	}
+	if _, ok := r.match("GET", "tweets/search/stream/rules"); ok {
+		want := r.list("ids")
+		var out []*rule
+		for _, rule := range s.ruleSet {
+			if len(want) == 0 || contains(want, rule.ID) {
+				out = append(out, rule)
+			}
+		}
+		return reply{Data: out, Meta: map[string]any{
+			"sent": time.Now().UTC().Format(time.RFC3339), "result_count": len(out),
+		}}, nil
+	}
+	if _, ok := r.match("POST", "tweets/search/stream/rules"); ok {
+		return s.updateRules(r)
+	}
+	if _, ok := r.match("GET", "users"); ok {
+		return s.lookupUsers(r.list("ids"), func(u *types.User, key string) bool { return u.ID == key }), nil
+	}
+	if _, ok := r.match("GET", "users/by"); ok {
+		return s.lookupUsers(r.list("usernames"), func(u *types.User, key string) bool {
+			return strings.EqualFold(u.Username, key)
+		}), nil
+	}
+	if args, ok := r.match("GET", "users/*/followers"); ok {
+		var out []*types.User
+		for _, id := range s.sortedUserIDs() {
+			if contains(s.follows[id], args[0]) {
+				out = append(out, s.users[id])
+			}
+		}
+		return s.paginate(r, "pagination_token", out), nil
+	}
+	if args, ok := r.match("GET", "users/*/following"); ok {
+		return s.paginate(r, "pagination_token", s.usersByID(s.follows[args[0]])), nil
+	}
+	if args, ok := r.match("GET", "users/*/owned_lists"); ok {
+		var out []*types.List
+		for _, id := range sortedKeys(s.lists) {
+			if l := s.lists[id]; l.OwnerID == args[0] {
+				out = append(out, s.listInfo(l))
+			}
+		}
+		return s.paginate(r, "pagination_token", out), nil
+	}
+	if args, ok := r.match("GET", "users/*/liked_tweets"); ok {
+		if err := checkPageSize(r, 10); err != nil {
+			return nil, err
+		}
+		if _, ok := s.users[args[0]]; !ok {
+			return nil, errNotFound
+		}
+		var out []*types.Tweet
+		for _, t := range s.sortedTweets() {
+			if s.likes[args[0]][t.ID] {
+				out = append(out, t)
+			}
+		}
+		return s.withAuthors(r, s.paginate(r, "pagination_token", out)), nil
+	}
+	if args, ok := r.match("POST", "users/*/likes"); ok {
+		return s.setMark(r, s.likes, args[0], "", "liked", true)
+	}
+	if args, ok := r.match("DELETE", "users/*/likes/*"); ok {
+		return s.setMark(r, s.likes, args[0], args[1], "liked", false)
+	}
+	if args, ok := r.match("GET", "users/*/bookmarks"); ok {
+		if !r.userContext() {
+			return nil, errForbidden
+		}
+		var out []*types.Tweet
+		for _, t := range s.sortedTweets() {
+			if s.bookmarks[args[0]][t.ID] {
+				out = append(out, t)
+			}
+		}
+		return s.paginate(r, "pagination_token", out), nil
+	}
+	if args, ok := r.match("POST", "users/*/bookmarks"); ok {
+		if !r.userContext() {
+			return nil, errForbidden
+		}
+		return s.setMark(r, s.bookmarks, args[0], "", "bookmarked", true)
+	}
+	if args, ok := r.match("DELETE", "users/*/bookmarks/*"); ok {
+		if !r.userContext() {
+			return nil, errForbidden
+		}
+		return s.setMark(r, s.bookmarks, args[0], args[1], "bookmarked", false)
+	}
+	if args, ok := r.match("POST", "users/*/retweets"); ok {
+		var req struct {
+			TweetID string `json:"tweet_id"`
+		}
+		if err := r.decode(&req); err == nil && s.retweets[args[0]][req.TweetID] {
+			return nil, &httpError{status: http.StatusForbidden, msg: "You cannot retweet a Tweet that you have already retweeted."}
+		}
+		return s.setMark(r, s.retweets, args[0], "", "retweeted", true)
+	}
+	if args, ok := r.match("DELETE", "users/*/retweets/*"); ok {
+		return s.setMark(r, s.retweets, args[0], args[1], "retweeted", false)
+	}
+	if _, ok := r.match("POST", "lists"); ok {
+		var req struct {
+			Name    string `json:"name"`
+			Desc    string `json:"description"`
+			Private bool   `json:"private"`
+		}
+		if err := r.decode(&req); err != nil {
+			return nil, err
+		}
+		id := s.newID()
+		s.lists[id] = &list{List: types.List{ID: id, Name: req.Name, Description: req.Desc, Private: req.Private}}
+		return reply{Data: map[string]string{"id": id, "name": req.Name}}, nil
+	}
+	if args, ok := r.match("GET", "lists/*"); ok {
+		l, ok := s.lists[args[0]]
+		if !ok {
+			return reply{Errors: []map[string]any{notFound("list", args[0])}}, nil
+		}
+		return reply{Data: s.listInfo(l)}, nil
+	}
+	if args, ok := r.match("DELETE", "lists/*"); ok {
+		_, ok := s.lists[args[0]]
+		delete(s.lists, args[0])
+		return reply{Data: map[string]bool{"deleted": ok}}, nil
+	}
+	if args, ok := r.match("PUT", "lists/*"); ok {
+		l, ok := s.lists[args[0]]
+		if !ok {
+			return nil, errNotFound
+		}
+		var req struct {
+			Name    *string `json:"name"`
+			Desc    *string `json:"description"`
+			Private *bool   `json:"private"`
+		}
+		if err := r.decode(&req); err != nil {
+			return nil, err
+		}
+		if req.Name != nil {
+			l.Name = *req.Name
+		}
+		if req.Desc != nil {
+			l.Description = *req.Desc
+		}
+		if req.Private != nil {
+			l.Private = *req.Private
+		}
+		return reply{Data: map[string]bool{"updated": true}}, nil
+	}
+	if args, ok := r.match("GET", "lists/*/members"); ok {
+		l, ok := s.lists[args[0]]
+		if !ok {
+			return nil, errNotFound
+		}
+		return s.paginate(r, "pagination_token", s.usersByID(l.members)), nil
+	}
+	if args, ok := r.match("GET", "lists/*/followers"); ok {
+		l, ok := s.lists[args[0]]
+		if !ok {
+			return nil, errNotFound
+		}
+		return s.paginate(r, "pagination_token", s.usersByID(l.followers)), nil
+	}
+	if args, ok := r.match("POST", "lists/*/members"); ok {
+		l, ok := s.lists[args[0]]
+		if !ok {
+			return nil, errNotFound
+		}
+		var req struct {
+			UserID string `json:"user_id"`
+		}
+		if err := r.decode(&req); err != nil {
+			return nil, err
+		}
+		if !contains(l.members, req.UserID) {
+			l.members = append(l.members, req.UserID)
+		}
+		return reply{Data: map[string]bool{"is_member": true}}, nil
+	}
+	if args, ok := r.match("DELETE", "lists/*/members/*"); ok {
+		l, ok := s.lists[args[0]]
+		if !ok {
+			return nil, errNotFound
+		}
+		l.members = remove(l.members, args[1])
+		return reply{Data: map[string]bool{"is_member": false}}, nil
+	}
+	return nil, errNotFound
+}
+
+func (s *Server) serveV1(r *request) (any, error) {
+	if _, ok := r.match("POST", "statuses/update.json"); ok {
+		form, err := r.form()
+		if err != nil {
+			return nil, err
+		}
+		text := form.Get("status")
+		if text == "" {
+			return nil, &httpError{status: http.StatusForbidden, msg: "missing status"}
+		}
+		t := &types.Tweet{ID: s.newID(), Text: text}
+		if id := form.Get("in_reply_to_status_id"); id != "" {
+			t.Referenced = []*types.Ref{{Type: "replied_to", ID: id}}
+		}
+		if ids := form.Get("media_ids"); ids != "" {
+			var keys []string
+			for _, id := range strings.Split(ids, ",") {
+				m, ok := s.media[id]
+				if !ok || !m.ready() {
+					return nil, &httpError{status: http.StatusBadRequest, msg: "media " + id + " is not ready"}
+				}
+				keys = append(keys, mediaKey(id))
+			}
+			t.Attachments = types.Attachments{"media_keys": keys}
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		t.CreatedAt = &now
+		s.tweets[t.ID] = t
+		return v1Tweet(t), nil
+	}
+	if _, ok := r.match("POST", "media/upload.json"); ok {
+		return s.uploadMedia(r)
+	}
+	if _, ok := r.match("GET", "media/upload.json"); ok {
+		return s.uploadMedia(r)
+	}
+	if _, ok := r.match("POST", "media/metadata/create.json"); ok {
+		var req struct {
+			MediaID string `json:"media_id"`
+			AltText struct {
+				Text string `json:"text"`
+			} `json:"alt_text"`
+		}
+		if err := r.decode(&req); err != nil {
+			return nil, err
+		}
+		m, ok := s.media[req.MediaID]
+		if !ok {
+			return nil, errNotFound
+		}
+		m.AltText = req.AltText.Text
+		return withStatus{code: http.StatusOK}, nil
+	}
+	for _, kind := range []string{"user", "home", "mentions"} {
+		if _, ok := r.match("GET", "statuses/"+kind+"_timeline.json"); !ok {
+			continue
+		}
+		var uid string
+		if id := r.param("user_id"); id != "" {
+			uid = id
+		} else if u := s.userByName(r.param("screen_name")); u != nil {
+			uid = u.ID
+		} else {
+			return nil, errNotFound
+		}
+		out := []map[string]any{}
+		for _, t := range s.sortedTweets() {
+			switch kind {
+			case "user":
+				if t.AuthorID != uid {
+					continue
+				}
+			case "home":
+				if t.AuthorID != uid && !contains(s.follows[uid], t.AuthorID) {
+					continue
+				}
+			case "mentions":
+				if u := s.users[uid]; u == nil || !strings.Contains(t.Text, "@"+u.Username) {
+					continue
+				}
+			}
+			out = append(out, v1Tweet(t))
+		}
+		return out, nil
+	}
+	return nil, errNotFound
+}
+
+func (s *Server) serveStream(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var ids []string
+	if n := len(s.stream); n != 0 {
+		ids = s.stream[min(s.numStream, n-1)]
+	}
+	s.numStream++
+	var msgs [][]byte
+	for _, id := range ids {
+		if t, ok := s.tweets[id]; ok {
+			msg, _ := json.Marshal(reply{Data: t})
+			msgs = append(msgs, msg)
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	for _, msg := range msgs {
+		w.Write(append(msg, '\r', '\n'))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// createTweet implements tweet creation with the v2 API.
+func (s *Server) createTweet(r *request) (any, error) {
+	var req struct {
+		Text  string `json:"text"`
+		Quote string `json:"quote_tweet_id"`
+		Poll  *struct {
+			Options  []string `json:"options"`
+			Duration int      `json:"duration_minutes"`
+		} `json:"poll"`
+		Reply *struct {
+			InReplyTo string `json:"in_reply_to_tweet_id"`
+		} `json:"reply"`
+		Media *struct {
+			IDs []string `json:"media_ids"`
+		} `json:"media"`
+	}
+	if err := r.decode(&req); err != nil {
+		return nil, err
+	}
+	if req.Text == "" && req.Media == nil {
+		return nil, &httpError{status: http.StatusBadRequest, msg: "missing text"}
+	}
+	var replyTo string
+	if req.Reply != nil {
+		replyTo = req.Reply.InReplyTo
+	}
+	t := &types.Tweet{ID: s.newID(), Text: req.Text}
+	for _, ref := range []struct{ kind, id string }{
+		{"replied_to", replyTo},
+		{"quoted", req.Quote},
+	} {
+		if ref.id == "" {
+			continue
+		} else if _, ok := s.tweets[ref.id]; !ok {
+			return nil, &httpError{status: http.StatusBadRequest, msg: "no such tweet: " + ref.id}
+		}
+		t.Referenced = append(t.Referenced, &types.Ref{Type: ref.kind, ID: ref.id})
+	}
+	if req.Poll != nil {
+		t.Attachments = types.Attachments{"poll_ids": {"1" + t.ID}}
+	}
+	if req.Media != nil {
+		var keys []string
+		for _, id := range req.Media.IDs {
+			if m, ok := s.media[id]; !ok || !m.ready() {
+				return nil, &httpError{status: http.StatusBadRequest, msg: "media " + id + " is not ready"}
+			}
+			keys = append(keys, mediaKey(id))
+		}
+		t.Attachments = types.Attachments{"media_keys": keys}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	t.CreatedAt = &now
+	s.tweets[t.ID] = t
+	s.created[t.ID] = r.body
+	return withStatus{code: http.StatusCreated, v: reply{Data: map[string]string{"id": t.ID, "text": t.Text}}}, nil
+}
+
+// withAuthors adds the authors of the tweets in out to its includes, if r
+// requests the author_id expansion.
+func (s *Server) withAuthors(r *request, out reply) reply {
+	tweets, ok := out.Data.([]*types.Tweet)
+	if !ok || !contains(r.list("expansions"), "author_id") {
+		return out
+	}
+	var authors []string
+	for _, t := range tweets {
+		authors = append(authors, t.AuthorID)
+	}
+	out.Includes = map[string]any{"users": s.usersByID(authors)}
+	return out
+}
+
+func (s *Server) lookupTweets(ids []string) reply {
+	var out reply
+	var found []*types.Tweet
+	for _, id := range ids {
+		if t, ok := s.tweets[id]; ok {
+			found = append(found, t)
+		} else {
+			out.Errors = append(out.Errors, notFound("tweet", id))
+		}
+	}
+	if len(found) != 0 {
+		out.Data = found
+	}
+	return out
+}
+
+func (s *Server) lookupUsers(keys []string, match func(*types.User, string) bool) reply {
+	var out reply
+	var found []*types.User
+	for _, key := range keys {
+		var hit *types.User
+		for _, id := range s.sortedUserIDs() {
+			if match(s.users[id], key) {
+				hit = s.users[id]
+				break
+			}
+		}
+		if hit != nil {
+			found = append(found, hit)
+		} else {
+			out.Errors = append(out.Errors, notFound("user", key))
+		}
+	}
+	if len(found) != 0 {
+		out.Data = found
+	}
+	return out
+}
+
+func (s *Server) updateRules(r *request) (any, error) {
+	var req struct {
+		Add []struct {
+			Value string `json:"value"`
+			Tag   string `json:"tag"`
+		} `json:"add"`
+		Delete struct {
+			IDs []string `json:"ids"`
+		} `json:"delete"`
+	}
+	if err := r.decode(&req); err != nil {
+		return nil, err
+	}
+	dryRun := r.param("dry_run") == "true"
+	summary := make(map[string]int)
+	var added []*rule
+	for _, a := range req.Add {
+		nr := &rule{ID: s.newID(), Value: a.Value, Tag: a.Tag}
+		added = append(added, nr)
+		summary["created"]++
+		summary["valid"]++
+	}
+	var kept []*rule
+	for _, old := range s.ruleSet {
+		if contains(req.Delete.IDs, old.ID) {
+			summary["deleted"]++
+		} else {
+			kept = append(kept, old)
+		}
+	}
+	summary["not_deleted"] = len(req.Delete.IDs) - summary["deleted"]
+	if !dryRun {
+		s.ruleSet = append(kept, added...)
+	}
+	out := reply{Meta: map[string]any{
+		"sent":    time.Now().UTC().Format(time.RFC3339),
+		"summary": summary,
+	}}
+	if len(added) != 0 {
+		out.Data = added
+	}
+	return out, nil
+}
+
+func (s *Server) setMark(r *request, marks map[string]map[string]bool, uid, tid, tag string, on bool) (any, error) {
+	if _, ok := s.users[uid]; !ok {
+		return withStatus{code: http.StatusNotFound, v: notFound("user", uid)}, nil
+	}
+	if on {
+		var req struct {
+			TweetID string `json:"tweet_id"`
+		}
+		if err := r.decode(&req); err != nil {
+			return nil, err
+		}
+		tid = req.TweetID
+	}
+	if _, ok := s.tweets[tid]; !ok {
+		return withStatus{code: http.StatusNotFound, v: notFound("tweet", tid)}, nil
+	}
+	if marks[uid] == nil {
+		marks[uid] = make(map[string]bool)
+	}
+	marks[uid][tid] = on
+	return reply{Data: map[string]bool{tag: on}}, nil
+}
+
+// markedBy returns a page of the users who have marked tweet ID tid, in order
+// of user ID.
+func (s *Server) markedBy(r *request, marks map[string]map[string]bool, tid string) (any, error) {
+	if _, ok := s.tweets[tid]; !ok {
+		return nil, errNotFound
+	}
+	var out []*types.User
+	for _, id := range s.sortedUserIDs() {
+		if marks[id][tid] {
+			out = append(out, s.users[id])
+		}
+	}
+	return s.paginate(r, "pagination_token", out), nil
+}
+
+// checkPageSize reports an error if r sets a max_results parameter outside
+// the range from min to 100 accepted by the service.
+func checkPageSize(r *request, min int) error {
+	v := r.param("max_results")
+	if v == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(v); err != nil || n < min || n > 100 {
+		return &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf("max_results must be between %d and 100", min)}
+	}
+	return nil
+}
+
+// paginate returns a reply containing a page of items, using the page token
+// parameter named by param and the max_results parameter of r.
+func paginate[T any](s *Server, r *request, param string, items []T) reply {
+	size := s.PageSize
+	if n, err := strconv.Atoi(r.param("max_results")); err == nil && n > 0 && (size <= 0 || n < size) {
+		size = n
+	}
+	start, _ := strconv.Atoi(r.param(param))
+	if start > len(items) {
+		start = len(items)
+	}
+	end := len(items)
+	if size > 0 && start+size < end {
+		end = start + size
+	}
+	meta := pageMeta{ResultCount: end - start}
+	if end < len(items) {
+		meta.NextToken = strconv.Itoa(end)
+	}
+	out := reply{Meta: meta}
+	if end > start {
+		out.Data = items[start:end]
+	}
+	return out
+}
+
+func (s *Server) paginate(r *request, param string, items any) reply {
+	switch v := items.(type) {
+	case []*types.Tweet:
+		return paginate(s, r, param, v)
+	case []*types.User:
+		return paginate(s, r, param, v)
+	case []*types.List:
+		return paginate(s, r, param, v)
+	}
+	panic(fmt.Sprintf("cannot paginate %T", items))
+}
+
+func (s *Server) listInfo(l *list) *types.List {
+	info := l.List
+	info.Members = len(l.members)
+	info.Followers = len(l.followers)
+	return &info
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+	return strconv.Itoa(s.nextID)
+}
+
+// sortedTweets returns all tweets, newest (largest ID) first.
+func (s *Server) sortedTweets() []*types.Tweet {
+	out := make([]*types.Tweet, 0, len(s.tweets))
+	for _, t := range s.tweets {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return idLess(out[j].ID, out[i].ID) })
+	return out
+}
+
+func (s *Server) sortedUserIDs() []string { return sortedKeys(s.users) }
+
+func (s *Server) usersByID(ids []string) []*types.User {
+	var out []*types.User
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+func (s *Server) userByName(name string) *types.User {
+	for _, id := range s.sortedUserIDs() {
+		if u := s.users[id]; strings.EqualFold(u.Username, name) {
+			return u
+		}
+	}
+	return nil
+}
+
+// matchQuery reports whether the text of t contains all the words of query,
+// ignoring case. A word "conversation_id:X" matches tweets in conversation X.
+func matchQuery(query string, t *types.Tweet) bool {
+	text := strings.ToLower(t.Text)
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if id, ok := strings.CutPrefix(word, "conversation_id:"); ok {
+			if t.ConversationID != id {
+				return false
+			}
+		} else if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// v1Tweet renders t in the format of the v1.1 API.
+func v1Tweet(t *types.Tweet) map[string]any {
+	out := map[string]any{
+		"id_str":    t.ID,
+		"full_text": t.Text,
+		"lang":      t.Language,
+		"user":      map[string]string{"id_str": t.AuthorID},
+	}
+	if t.CreatedAt != nil {
+		out["created_at"] = t.CreatedAt.Format("Mon Jan _2 15:04:05 -0700 2006")
+	}
+	for _, ref := range t.Referenced {
+		if ref.Type == "replied_to" {
+			out["in_reply_to_status_id_str"] = ref.ID
+		}
+	}
+	return out
+}
+
+func notFound(kind, value string) map[string]any {
+	return map[string]any{
+		"title":         "Not Found Error",
+		"detail":        fmt.Sprintf("Could not find %s with id: [%s].", kind, value),
+		"resource_type": kind,
+		"value":         value,
+		"type":          "https://api.twitter.com/2/problems/resource-not-found",
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data = []byte(`{"title":"encoding error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]any{
+		"title":  http.StatusText(status),
+		"detail": msg,
+		"status": status,
+	})
+}
+
+func idLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return idLess(keys[i], keys[j]) })
+	return keys
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(ss []string, s string) []string {
+	var out []string
+	for _, v := range ss {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// uploadMedia implements the commands of the chunked media upload API.
+// Media in the tweet_video and tweet_gif categories require processing after
+// they are finalized, which completes after two STATUS requests.
+func (s *Server) uploadMedia(r *request) (any, error) {
+	params := r.URL.Query()
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := r.form()
+		if err != nil {
+			return nil, err
+		}
+		for key, vals := range form {
+			params[key] = vals
+		}
+	}
+	var m *Media
+	if cmd := params.Get("command"); cmd != "INIT" {
+		var ok bool
+		if m, ok = s.media[params.Get("media_id")]; !ok {
+			return nil, &httpError{status: http.StatusBadRequest, msg: "unknown media ID"}
+		}
+	}
+	switch params.Get("command") {
+	case "INIT":
+		size, err := strconv.ParseInt(params.Get("total_bytes"), 10, 64)
+		if err != nil || size <= 0 {
+			return nil, &httpError{status: http.StatusBadRequest, msg: "invalid total_bytes"}
+		}
+		m := &Media{
+			ID:       s.newID(),
+			Type:     params.Get("media_type"),
+			Category: params.Get("media_category"),
+			Size:     size,
+		}
+		s.media[m.ID] = m
+		return withStatus{code: http.StatusAccepted, v: mediaReply(m)}, nil
+
+	case "APPEND":
+		_, ps, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, err
+		}
+		mr := multipart.NewReader(bytes.NewReader(r.body), ps["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			if part.FormName() == "media" {
+				data, err := io.ReadAll(part)
+				if err != nil {
+					return nil, err
+				}
+				m.Data = append(m.Data, data...)
+			}
+		}
+		return withStatus{code: http.StatusNoContent}, nil
+
+	case "FINALIZE":
+		if int64(len(m.Data)) != m.Size {
+			return nil, &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf(
+				"got %d bytes, want %d", len(m.Data), m.Size)}
+		}
+		m.finalized = true
+		if m.Category == "tweet_video" || m.Category == "tweet_gif" {
+			m.polls = 2
+		}
+		return mediaReply(m), nil
+
+	case "STATUS":
+		if m.polls > 0 {
+			m.polls--
+		}
+		return mediaReply(m), nil
+	}
+	return nil, &httpError{status: http.StatusBadRequest, msg: "invalid command"}
+}
+
+func mediaReply(m *Media) map[string]any {
+	out := map[string]any{
+		"media_id":        m.ID,
+		"media_id_string": m.ID,
+		"media_key":       mediaKey(m.ID),
+		"size":            m.Size,
+	}
+	if m.finalized && m.Category != "tweet_image" {
+		info := map[string]any{"state": "succeeded", "progress_percent": 100}
+		if m.polls > 0 {
+			info = map[string]any{"state": "in_progress", "check_after_secs": 0, "progress_percent": 50}
+		}
+		out["processing_info"] = info
+	}
+	return out
+}
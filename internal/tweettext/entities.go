@@ -0,0 +1,161 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package tweettext
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An Entity is a URL, mention, or hashtag in the text of a tweet. The offsets
+// are in runes of the text.
+type Entity struct {
+	Text       string
+	Start, End int
+}
+
+// Entities are the entities found in the text of a tweet, in order of their
+// offsets.
+type Entities struct {
+	URLs, Mentions, Hashtags []Entity
+}
+
+// Extract returns the entities in text, which should be NFC normalized. A
+// mention or hashtag that is part of a URL is not reported.
+func Extract(text string) Entities {
+	urls := extractURLs(text)
+	return Entities{
+		URLs:     urls,
+		Mentions: dropOverlaps(extract(text, mentionExpr, isMentionEnd), urls),
+		Hashtags: dropOverlaps(extract(text, hashtagExpr, isHashtagEnd), urls),
+	}
+}
+
+// Join returns a comma-separated list of the text of es.
+func Join(es []Entity) string {
+	ss := make([]string, len(es))
+	for i, e := range es {
+		ss[i] = e.Text
+	}
+	return strings.Join(ss, ", ")
+}
+
+var (
+	// A URL with or without a scheme. The match is checked by extractURLs.
+	urlExpr = regexp.MustCompile(`(?i)(https?://)?((?:[\p{L}\p{N}](?:[\p{L}\p{N}_-]*[\p{L}\p{N}])?\.)+(\p{L}{2,63}))(?::\d{1,5})?(/\S*)?`)
+
+	// Top-level domains recognized in URLs without a scheme, in addition to
+	// the two-letter country codes.
+	genericTLDs = strings.Fields(`aero app art asia biz blog cat club com coop design
+		dev edu gov info int jobs live mil mobi museum name net news online org page
+		pro shop site store tech tel travel xyz`)
+
+	mentionExpr = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_!#$%&*@＠])([@＠][A-Za-z0-9_]{1,15})`)
+	hashtagExpr = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{Nd}_&])([#＃][\p{L}\p{M}\p{Nd}_]*\p{L}[\p{L}\p{M}\p{Nd}_]*)`)
+)
+
+// extractURLs returns the URLs in text.
+func extractURLs(text string) []Entity {
+	var out []Entity
+	for _, m := range urlExpr.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		if prev, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 &&
+			(unicode.IsLetter(prev) || unicode.IsDigit(prev) || strings.ContainsRune("@＠$#＃/.", prev)) {
+			continue
+		}
+		hasScheme, hasPath := m[2] >= 0, m[8] >= 0
+		if !hasScheme {
+			tld := strings.ToLower(text[m[6]:m[7]])
+			host := text[m[4]:m[5]]
+			if len(tld) == 2 {
+				// A bare domain with a country-code TLD and no subdomain or path,
+				// like "node.js", is more likely not meant as a link.
+				if strings.Count(host, ".") < 2 && !hasPath {
+					continue
+				}
+			} else if !isGenericTLD(tld) {
+				continue
+			}
+		}
+		end = start + len(trimURL(text[start:end]))
+		out = append(out, Entity{
+			Text:  text[start:end],
+			Start: utf8.RuneCountInString(text[:start]),
+			End:   utf8.RuneCountInString(text[:end]),
+		})
+	}
+	return out
+}
+
+func isGenericTLD(tld string) bool {
+	for _, g := range genericTLDs {
+		if g == tld {
+			return true
+		}
+	}
+	return false
+}
+
+// trimURL removes trailing punctuation from a URL, including a closing
+// parenthesis that does not match an opening one in the URL.
+func trimURL(s string) string {
+	for {
+		t := strings.TrimRight(s, `.,:;!?'"`)
+		if strings.HasSuffix(t, ")") && strings.Count(t, "(") < strings.Count(t, ")") {
+			t = t[:len(t)-1]
+		}
+		if t == s {
+			return s
+		}
+		s = t
+	}
+}
+
+// extract returns the matches of the first subexpression of expr in text,
+// except those for which isEnd reports false for the text that follows.
+func extract(text string, expr *regexp.Regexp, isEnd func(rest string) bool) []Entity {
+	var out []Entity
+	for _, m := range expr.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[2], m[3]
+		if !isEnd(text[end:]) {
+			continue
+		}
+		out = append(out, Entity{
+			Text:  text[start:end],
+			Start: utf8.RuneCountInString(text[:start]),
+			End:   utf8.RuneCountInString(text[:end]),
+		})
+	}
+	return out
+}
+
+// isMentionEnd reports whether a username can end before rest. A username
+// followed by more username characters is too long, and one followed by
+// "://" is part of a URL.
+func isMentionEnd(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return !(r == '_' || r == '@' || r == '＠' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) ||
+		strings.HasPrefix(rest, "://"))
+}
+
+func isHashtagEnd(rest string) bool {
+	r, _ := utf8.DecodeRuneInString(rest)
+	return !(r == '#' || r == '＃' || strings.HasPrefix(rest, "://"))
+}
+
+// dropOverlaps returns the entities of es that do not overlap any of urls.
+func dropOverlaps(es, urls []Entity) []Entity {
+	out := es[:0]
+next:
+	for _, e := range es {
+		for _, u := range urls {
+			if e.Start < u.End && u.Start < e.End {
+				continue next
+			}
+		}
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package tweettext
+
+import "testing"
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		text                     string
+		urls, mentions, hashtags string
+	}{
+		{"", "", "", ""},
+		{"Hi @bob and @carol, see #golang", "", "@bob, @carol", "#golang"},
+		{"see https://example.com/#notatag.", "https://example.com/#notatag", "", ""},
+		{"https://example.com/@notme and @me", "https://example.com/@notme", "@me", ""},
+		{"mail a@b.com or @this_name_is_too_long", "", "", ""},
+		{"#123 is not a tag but #go1 is", "", "", "#go1"},
+		{"＠wide and ＃ｔａｇ", "", "＠wide", "＃ｔａｇ"},
+		{"node.js and example.co.uk/x", "example.co.uk/x", "", ""},
+	}
+	for _, tc := range tests {
+		e := Extract(tc.text)
+		if got := Join(e.URLs); got != tc.urls {
+			t.Errorf("Extract(%q) URLs: got %q, want %q", tc.text, got, tc.urls)
+		}
+		if got := Join(e.Mentions); got != tc.mentions {
+			t.Errorf("Extract(%q) mentions: got %q, want %q", tc.text, got, tc.mentions)
+		}
+		if got := Join(e.Hashtags); got != tc.hashtags {
+			t.Errorf("Extract(%q) hashtags: got %q, want %q", tc.text, got, tc.hashtags)
+		}
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	e := Extract("日本 @bob")
+	if len(e.Mentions) != 1 || e.Mentions[0].Start != 3 || e.Mentions[0].End != 7 {
+		t.Errorf("Mentions: got %+v, want @bob at runes [3, 7)", e.Mentions)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openTerminal opens a pseudo-terminal in raw mode, and returns the file
+// descriptors for its controlling (master) and terminal (slave) sides. The
+// test is skipped if pseudo-terminals are not available.
+func openTerminal(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("Pseudo-terminals are not available: %v", err)
+	}
+	var n uint32
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		t.Skipf("Pseudo-terminals are not available: %v", err)
+	} else if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		t.Skipf("Pseudo-terminals are not available: %v", err)
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Skipf("Pseudo-terminals are not available: %v", err)
+	}
+
+	// Pass output through unchanged, and do not echo input.
+	var tio syscall.Termios
+	if err := ioctl(slave, syscall.TCGETS, unsafe.Pointer(&tio)); err != nil {
+		t.Fatalf("Getting terminal attributes: %v", err)
+	}
+	tio.Oflag &^= syscall.OPOST
+	tio.Lflag &^= syscall.ECHO | syscall.ICANON
+	if err := ioctl(slave, syscall.TCSETS, unsafe.Pointer(&tio)); err != nil {
+		t.Fatalf("Setting terminal attributes: %v", err)
+	}
+	return master, slave
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// openTerminal skips the test, since pseudo-terminals are only supported by
+// the tests on Linux.
+func openTerminal(t *testing.T) (master, slave *os.File) {
+	t.Helper()
+	t.Skip("Pseudo-terminals are not supported on this platform")
+	return nil, nil
+}
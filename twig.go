@@ -3,19 +3,28 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/creachadair/command"
 	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/cmdarchive"
+	"github.com/creachadair/twig/internal/cmdbookmark"
+	"github.com/creachadair/twig/internal/cmdcache"
+	"github.com/creachadair/twig/internal/cmddraft"
 	"github.com/creachadair/twig/internal/cmdhelp"
 	"github.com/creachadair/twig/internal/cmdlist"
 	"github.com/creachadair/twig/internal/cmdlookup"
 	"github.com/creachadair/twig/internal/cmdrules"
+	"github.com/creachadair/twig/internal/cmdschedule"
 	"github.com/creachadair/twig/internal/cmdsearch"
 	"github.com/creachadair/twig/internal/cmdstream"
 	"github.com/creachadair/twig/internal/cmdtimeline"
@@ -28,6 +37,24 @@ var (
 	configFile = "$HOME/.config/twig/config.yml"
 	logLevel   int
 	authUser   string
+	timeout    time.Duration
+	noCache    bool
+	saveSeen   bool
+	dryRun     bool
+	assumeYes  bool
+	recordDir  string
+	replayDir  string
+
+	// Transport settings, which override the config file if set.
+	apiURL         string
+	proxy          string
+	caBundle       string
+	userAgent      string
+	connectTimeout time.Duration
+
+	// Called on exit to release the signal handler and timer, and to save
+	// the records kept while the command ran.
+	stop = func() error { return nil }
 
 	root = &command.C{
 		Name:  filepath.Base(os.Args[0]),
@@ -38,9 +65,24 @@ var (
 			fs.StringVar(&configFile, "config", configFile, "Configuration file path")
 			fs.IntVar(&logLevel, "log-level", 0, "Verbose client logging level (log tag mask)")
 			fs.StringVar(&authUser, "auth-user", authUser, "Authenticate with user context")
+			fs.DurationVar(&timeout, "timeout", 0, "Time limit for the whole command (0 means none)")
+			fs.BoolVar(&noCache, "no-cache", false, "Do not use the username cache")
+			fs.BoolVar(&saveSeen, "archive-seen", false, "Save tweets and users seen in the local archive (overrides config)")
+			fs.BoolVar(&dryRun, "dry-run", false, "Print mutating requests instead of sending them")
+			fs.BoolVar(&assumeYes, "yes", false, "Do not ask for confirmation of destructive operations")
+			fs.StringVar(&recordDir, "record", "", "Record API requests and responses to this directory")
+			fs.StringVar(&replayDir, "replay", "", "Replay API responses recorded in this directory")
+			fs.StringVar(&apiURL, "api-url", "", "Base URL of the API (overrides config)")
+			fs.StringVar(&proxy, "proxy", "", "HTTP or SOCKS5 proxy URL (overrides config)")
+			fs.StringVar(&caBundle, "ca-bundle", "", "Extra trusted CA certificates file (overrides config)")
+			fs.StringVar(&userAgent, "user-agent", "", "User-Agent header for API requests (overrides config)")
+			fs.DurationVar(&connectTimeout, "connect-timeout", 0, "Time limit for connecting to the API (overrides config)")
 		},
 
 		Init: func(env *command.Env) error {
+			if recordDir != "" && replayDir != "" {
+				return errors.New("-record and -replay cannot be used together")
+			}
 			path := os.ExpandEnv(configFile)
 			cfg, err := config.Load(path)
 			if err != nil {
@@ -53,6 +95,41 @@ var (
 				cfg.LogMask = jape.LogTag(logLevel)
 			}
 			cfg.AuthUser = authUser
+			cfg.NoCache = noCache
+			if saveSeen {
+				cfg.ArchiveSeen = true
+			}
+			cfg.DryRun = dryRun
+			cfg.AssumeYes = assumeYes
+			cfg.RecordDir = recordDir
+			cfg.ReplayDir = replayDir
+			if apiURL != "" {
+				cfg.APIBaseURL = apiURL
+			}
+			if proxy != "" {
+				cfg.Proxy = proxy
+			}
+			if caBundle != "" {
+				cfg.CABundle = caBundle
+			}
+			if userAgent != "" {
+				cfg.UserAgent = userAgent
+			}
+			if connectTimeout > 0 {
+				cfg.ConnectTimeout = connectTimeout
+			}
+
+			// Interrupting the program (e.g., Ctrl-C) cancels any API calls in
+			// flight, so that commands can stop cleanly between writes.
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			release := cancel
+			if timeout > 0 {
+				tctx, tcancel := context.WithTimeout(ctx, timeout)
+				ctx, release = tctx, func() { tcancel(); cancel() }
+			}
+			cfg.SetContext(ctx)
+			flushSeen := cmdarchive.RecordSeen(cfg)
+			stop = func() error { release(); return flushSeen() }
 			env.Config = cfg
 			return nil
 		},
@@ -64,17 +141,31 @@ var (
 			cmdrules.Command,
 			cmdstream.Command,
 			cmdtweet.Command,
+			cmddraft.Command,
+			cmdschedule.Command,
 			cmdtimeline.Command,
+			cmdbookmark.Command,
 			cmdlist.Command,
+			cmdcache.Command,
+			cmdarchive.Command,
 			command.HelpCommand(cmdhelp.Topics),
 		},
 	}
 )
 
 func main() {
-	if err := command.Run(root.NewEnv(nil), os.Args[1:]); err != nil {
+	err := command.Run(root.NewEnv(nil), os.Args[1:])
+	if serr := stop(); err == nil {
+		err = serr
+	}
+	if err != nil {
 		if errors.Is(err, command.ErrUsage) {
 			os.Exit(2)
+		} else if errors.Is(err, config.ErrDryRun) {
+			return // the request was printed; nothing more to do
+		} else if errors.Is(err, context.Canceled) {
+			log.Print("Interrupted")
+			os.Exit(130)
 		}
 		log.Printf("Error: %v", err)
 		var jerr *jape.Error
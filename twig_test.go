@@ -0,0 +1,2162 @@
+// Copyright (C) 2023 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creachadair/command"
+	"github.com/creachadair/twig/config"
+	"github.com/creachadair/twig/internal/fakeapi"
+	"github.com/creachadair/twitter/jape"
+	"github.com/creachadair/twitter/types"
+)
+
+// A harness runs twig commands against a fake API server.
+type harness struct {
+	t      *testing.T
+	srv    *fakeapi.Server
+	dir    string
+	config string
+	term   *terminal // if set, stdout is this terminal
+}
+
+// A terminal is the terminal side of a pseudo-terminal, and the data written
+// to it.
+type terminal struct {
+	*os.File
+	data <-chan []byte
+}
+
+// endOfOutput is written to the terminal after a command, to mark the end of
+// its output.
+const endOfOutput = "\x1e"
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	srv := fakeapi.New()
+	srv.AddUser(&types.User{ID: "1", Username: "alice", Name: "Alice"})
+	srv.AddUser(&types.User{ID: "2", Username: "bob", Name: "Bob"})
+	srv.AddUser(&types.User{ID: "3", Username: "carol", Name: "Carol"})
+	srv.AddTweet(&types.Tweet{ID: "100", Text: "hello from alice", AuthorID: "1"})
+	srv.AddTweet(&types.Tweet{ID: "101", Text: "hello from bob", AuthorID: "2"})
+	srv.AddTweet(&types.Tweet{ID: "102", Text: "hey @alice, it's carol", AuthorID: "3"})
+
+	hs := httptest.NewServer(srv)
+	t.Cleanup(hs.Close)
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.yml")
+	if err := config.Save(&config.Config{
+		APIKey:      "api-key",
+		APISecret:   "api-secret",
+		BearerToken: "bearer-token",
+		Users: []*config.User{
+			{Username: "alice", Token: "alice-token", Secret: "alice-secret"},
+		},
+		CacheFile:    filepath.Join(dir, "users.json"),
+		ScheduleFile: filepath.Join(dir, "schedule.json"),
+		DraftDir:     filepath.Join(dir, "drafts"),
+		ArchiveDir:   filepath.Join(dir, "archive"),
+		APIBaseURL:   hs.URL,
+	}, cfgPath); err != nil {
+		t.Fatalf("Saving config: %v", err)
+	}
+	return &harness{t: t, srv: srv, dir: dir, config: cfgPath}
+}
+
+// run runs twig with the given arguments, and returns the text written to
+// stdout and to the log, along with the error reported by the command.
+func (h *harness) run(args ...string) (stdout, log string, err error) {
+	h.t.Helper()
+	resetFlags(root)
+
+	saved := os.Stdout
+	done := make(chan string)
+	var w *os.File
+	if h.term != nil {
+		w = h.term.File
+		go func() {
+			var buf bytes.Buffer
+			for data := range h.term.data {
+				buf.Write(data)
+				if out, ok := strings.CutSuffix(buf.String(), endOfOutput); ok {
+					done <- out
+					return
+				}
+			}
+			done <- buf.String()
+		}()
+	} else {
+		r, pw, perr := os.Pipe()
+		if perr != nil {
+			h.t.Fatalf("Pipe: %v", perr)
+		}
+		w = pw
+		go func() {
+			var buf bytes.Buffer
+			io.Copy(&buf, r)
+			done <- buf.String()
+		}()
+	}
+	os.Stdout = w
+
+	var logBuf bytes.Buffer
+	env := root.NewEnv(nil)
+	env.Log = &logBuf
+	err = command.Run(env, append([]string{"-config", h.config}, args...))
+	if serr := stop(); err == nil {
+		err = serr
+	}
+
+	if h.term != nil {
+		io.WriteString(w, endOfOutput)
+	} else {
+		w.Close()
+	}
+	os.Stdout = saved
+	stdout = <-done
+	h.t.Logf("twig %s\nstdout:\n%s\nlog:\n%s\nerr: %v", strings.Join(args, " "), stdout, logBuf.String(), err)
+	return stdout, logBuf.String(), err
+}
+
+// mustRun runs twig with the given arguments and fails if it reports an error.
+func (h *harness) mustRun(args ...string) string {
+	h.t.Helper()
+	out, _, err := h.run(args...)
+	if err != nil {
+		h.t.Fatalf("twig %s: unexpected error: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+// withStdin runs f with os.Stdin reading from the given text.
+func (h *harness) withStdin(text string, f func()) {
+	h.t.Helper()
+	path := filepath.Join(h.dir, "stdin")
+	if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+		h.t.Fatalf("Writing stdin: %v", err)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		h.t.Fatalf("Opening stdin: %v", err)
+	}
+	defer in.Close()
+	saved := os.Stdin
+	os.Stdin = in
+	defer func() { os.Stdin = saved }()
+	f()
+}
+
+// withTerminal runs f with os.Stdin and os.Stdout connected to a terminal.
+// The test is skipped if no terminal can be opened.
+func (h *harness) withTerminal(f func()) {
+	h.t.Helper()
+	master, slave := openTerminal(h.t)
+	data := make(chan []byte)
+	go func() {
+		defer close(data)
+		for {
+			buf := make([]byte, 4096)
+			n, err := master.Read(buf)
+			if n > 0 {
+				data <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	saved := os.Stdin
+	os.Stdin = slave
+	h.term = &terminal{File: slave, data: data}
+	defer func() {
+		os.Stdin = saved
+		h.term = nil
+		slave.Close()
+		for range data {
+		}
+		master.Close()
+	}()
+	f()
+}
+
+// countRequests reports how many requests to the server begin with prefix.
+func (h *harness) countRequests(prefix string) int {
+	var n int
+	for _, req := range h.srv.Requests() {
+		if strings.HasPrefix(req, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// resetFlags restores the flags of c and its subcommands to their defaults.
+// Flag values and the record of which flags were set persist across runs of a
+// command, so each test run must start fresh.
+func resetFlags(c *command.C) {
+	var flags []*flag.Flag
+	c.Flags.VisitAll(func(f *flag.Flag) {
+		if v := reflect.ValueOf(f.Value); v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Slice {
+			v.Elem().Set(reflect.Zero(v.Elem().Type())) // repeatable flags
+		} else if f.Value.String() != f.DefValue {
+			f.Value.Set(f.DefValue)
+		}
+		flags = append(flags, f)
+	})
+	c.Flags = flag.FlagSet{}
+	for _, f := range flags {
+		c.Flags.Var(f.Value, f.Name, f.Usage)
+	}
+	for _, sub := range c.Commands {
+		resetFlags(sub)
+	}
+}
+
+// lines returns the non-empty lines of s.
+func lines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// checkIDs verifies that each line of out is a JSON object with the given
+// ID, in order.
+func checkIDs(t *testing.T, out string, ids ...string) {
+	t.Helper()
+	got := lines(out)
+	if len(got) != len(ids) {
+		t.Fatalf("Got %d results, want %d:\n%s", len(got), len(ids), out)
+	}
+	for i, line := range got {
+		if want := fmt.Sprintf(`"id":%q`, ids[i]); !strings.Contains(line, want) {
+			t.Errorf("Result %d: got %s, want %s", i+1, line, want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	h := newHarness(t)
+	out := h.mustRun("lookup", "101", "https://twitter.com/alice/status/100")
+	checkIDs(t, out, "101", "100")
+
+	t.Run("Stdin", func(t *testing.T) {
+		h.withStdin("# tweets\n102\n{\"id\":\"100\"}\n", func() {
+			checkIDs(t, h.mustRun("lookup", "-"), "102", "100")
+		})
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(h.dir, "ids.txt")
+		if err := os.WriteFile(path, []byte("100\n101\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		checkIDs(t, h.mustRun("lookup", "@"+path), "100", "101")
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		out, _, err := h.run("lookup", "100", "999")
+		checkIDs(t, out, "100")
+		if err == nil || !strings.Contains(err.Error(), `tweet "999"`) {
+			t.Errorf("lookup: got %v, want not found error for 999", err)
+		}
+	})
+
+	t.Run("NoKeys", func(t *testing.T) {
+		if _, _, err := h.run("lookup"); !errors.Is(err, command.ErrUsage) {
+			t.Errorf("lookup: got %v, want usage error", err)
+		}
+	})
+}
+
+func TestLookupBatches(t *testing.T) {
+	h := newHarness(t)
+	var ids []string
+	for i := 0; i < 150; i++ {
+		id := strconv.Itoa(1000 + i)
+		h.srv.AddTweet(&types.Tweet{ID: id, Text: "tweet " + id})
+		ids = append(ids, id)
+	}
+	checkIDs(t, h.mustRun(append([]string{"lookup"}, ids...)...), ids...)
+	if n := h.countRequests("GET /2/tweets?"); n != 2 {
+		t.Errorf("Got %d lookup requests, want 2", n)
+	}
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		h.srv.AddList(&types.List{ID: "500", Name: "many", OwnerID: "1"})
+		args := []string{"-auth-user", "alice", "list", "add-member", "500"}
+		for i := 0; i < 150; i++ {
+			id := strconv.Itoa(2000 + i)
+			h.srv.AddUser(&types.User{ID: id, Username: "user" + id})
+			args = append(args, "@user"+id)
+		}
+
+		// One of the two batches fails. The error is reported, and the users
+		// found by the other batch are cached.
+		h.srv.FailAfter(1, "GET", "/2/users/by", http.StatusServiceUnavailable, 1)
+		if _, _, err := h.run(args...); err == nil || !strings.Contains(err.Error(), "503") {
+			t.Errorf("add-member: got %v, want 503 error", err)
+		}
+		before := h.countRequests("GET /2/users/by?")
+		h.mustRun(args...)
+		if n := h.countRequests("GET /2/users/by?") - before; n != 1 {
+			t.Errorf("Got %d username lookups after partial failure, want 1", n)
+		}
+		if n := len(h.srv.ListMembers("500")); n != 150 {
+			t.Errorf("List has %d members, want 150", n)
+		}
+
+		// A username that is not found is reported, not skipped.
+		_, _, err := h.run("-auth-user", "alice", "list", "add-member", "500", "@nobody")
+		if err == nil || !strings.Contains(err.Error(), `user "nobody"`) {
+			t.Errorf("add-member: got %v, want not found error", err)
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	h := newHarness(t)
+	var want []string
+	for i := 0; i < 25; i++ {
+		id := strconv.Itoa(2000 + i)
+		h.srv.AddTweet(&types.Tweet{ID: id, Text: "a gopher tweet"})
+		want = append([]string{id}, want...) // newest first
+	}
+
+	t.Run("All", func(t *testing.T) {
+		checkIDs(t, h.mustRun("search", "-query", "gopher"), want...)
+		if n := h.countRequests("GET /2/tweets/search/recent"); n != 3 {
+			t.Errorf("Got %d search requests, want 3", n)
+		}
+	})
+
+	t.Run("Max", func(t *testing.T) {
+		checkIDs(t, h.mustRun("search", "-query", "gopher", "-max", "12"), want[:12]...)
+	})
+
+	t.Run("Page", func(t *testing.T) {
+		checkIDs(t, h.mustRun("search", "-query", "gopher", "-page", "20"), want[20:]...)
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		var n int
+		h.srv.OnRequest(func(_, path string) {
+			if path == "/2/tweets/search/recent" {
+				if n++; n == 2 {
+					time.Sleep(time.Second) // outlast the timeout
+				}
+			}
+		})
+		defer h.srv.OnRequest(nil)
+		out, log, err := h.run("-timeout", "300ms", "search", "-query", "gopher", "-max", "20")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("search: got %v, want %v", err, context.DeadlineExceeded)
+		}
+		checkIDs(t, out, want[:10]...)
+		if !strings.Contains(log, "re-run with -page 10\n") {
+			t.Errorf("Log does not say where to resume:\n%s", log)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		h.srv.Fail("GET", "/2/tweets/search/recent", http.StatusServiceUnavailable, 1)
+		_, _, err := h.run("search", "-query", "gopher")
+		var jerr *jape.Error
+		if !errors.As(err, &jerr) || jerr.Status != http.StatusServiceUnavailable {
+			t.Errorf("search: got %v, want HTTP 503", err)
+		}
+	})
+
+	t.Run("NoQuery", func(t *testing.T) {
+		if _, _, err := h.run("search"); !errors.Is(err, command.ErrUsage) {
+			t.Errorf("search: got %v, want usage error", err)
+		}
+	})
+}
+
+func TestUser(t *testing.T) {
+	h := newHarness(t)
+	out := h.mustRun("user", "2", "@carol", "https://x.com/alice")
+	checkIDs(t, out, "2", "3", "1")
+
+	// Users are printed in the order given, whether by ID or username.
+	checkIDs(t, h.mustRun("user", "@carol", "2", "@alice"), "3", "2", "1")
+
+	// Users that are not found are reported, after printing those found.
+	out, _, err := h.run("user", "@bob", "@nobody", "999")
+	checkIDs(t, out, "2")
+	if err == nil || !strings.Contains(err.Error(), `"nobody"`) || !strings.Contains(err.Error(), `"999"`) {
+		t.Errorf("user: got %v, want errors for nobody and 999", err)
+	}
+
+	// Usernames looked up are recorded in the cache.
+	out = h.mustRun("cache", "list")
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if !strings.Contains(out, `"`+name+`"`) {
+			t.Errorf("Cache does not contain %q:\n%s", name, out)
+		}
+	}
+	if out := h.mustRun("cache", "clear"); !strings.Contains(out, "cleared: 3 entries") {
+		t.Errorf("cache clear: got %q", out)
+	}
+	if out := h.mustRun("cache", "list"); strings.TrimSpace(out) != "" {
+		t.Errorf("Cache is not empty after clear:\n%s", out)
+	}
+
+	// A cache file that cannot be read is removed, even with -no-cache.
+	cachePath := filepath.Join(h.dir, "users.json")
+	for _, args := range [][]string{{"cache", "clear"}, {"-no-cache", "cache", "clear"}} {
+		if err := os.WriteFile(cachePath, []byte("{bogus"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if out := h.mustRun(args...); !strings.Contains(out, "cleared: unreadable cache") {
+			t.Errorf("%q: got %q", args, out)
+		}
+		if _, err := os.Stat(cachePath); !os.IsNotExist(err) {
+			t.Errorf("%q: cache file still exists (%v)", args, err)
+		}
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		h.srv.Fail("GET", "/2/users", http.StatusServiceUnavailable, 1)
+		_, _, err := h.run("user", "1")
+		var jerr *jape.Error
+		if !errors.As(err, &jerr) || jerr.Status != http.StatusServiceUnavailable {
+			t.Errorf("user: got %v, want HTTP 503", err)
+		}
+	})
+}
+
+func TestTimeline(t *testing.T) {
+	h := newHarness(t)
+	h.srv.AddFollow("1", "2")
+
+	checkIDs(t, h.mustRun("timeline", "user", "alice"), "100")
+	checkIDs(t, h.mustRun("timeline", "-id", "user", "2"), "101")
+	checkIDs(t, h.mustRun("timeline", "home", "@alice"), "101", "100")
+	checkIDs(t, h.mustRun("-auth-user", "alice", "timeline", "mentions"), "102")
+}
+
+func TestRules(t *testing.T) {
+	h := newHarness(t)
+	out := h.mustRun("rules", "add", "cats=cat has:images", "dogs")
+	if got := len(lines(out)); got != 2 {
+		t.Fatalf("rules add: got %d rules, want 2:\n%s", got, out)
+	}
+	checkIDs(t, h.mustRun("rules", "get"), "9001", "9002")
+	checkIDs(t, h.mustRun("rules", "get", "9002"), "9002")
+
+	out = h.mustRun("rules", "delete", "9001")
+	if !strings.Contains(out, `"deleted":1`) {
+		t.Errorf("rules delete: got %s", out)
+	}
+	checkIDs(t, h.mustRun("rules", "get"), "9002")
+}
+
+func TestStream(t *testing.T) {
+	h := newHarness(t)
+
+	// The first connection delivers two tweets and closes. The reconnect
+	// re-delivers one of them, which should be suppressed.
+	h.srv.SetStream([]string{"100", "101"}, []string{"101", "102"})
+	out, log, err := h.run("stream", "-max", "3")
+	if err != nil {
+		t.Fatalf("stream: unexpected error: %v", err)
+	}
+	checkIDs(t, out, "100", "101", "102")
+	if !strings.Contains(log, "1 duplicates suppressed") {
+		t.Errorf("stream log does not report duplicates:\n%s", log)
+	}
+
+	t.Run("ArchiveSeen", func(t *testing.T) {
+		// The tweets seen are saved once, when the stream ends.
+		h.srv.SetStream([]string{"100", "101", "102"})
+		checkIDs(t, h.mustRun("-archive-seen", "stream", "-max", "3"), "100", "101", "102")
+		data, err := os.ReadFile(filepath.Join(h.dir, "archive", "seen-tweets.json"))
+		if err != nil {
+			t.Fatalf("Reading seen tweets: %v", err)
+		}
+		for _, id := range []string{"100", "101", "102"} {
+			if !strings.Contains(string(data), `"id":"`+id+`"`) {
+				t.Errorf("Seen tweets do not include %s: %s", id, data)
+			}
+		}
+
+		// An error saving them does not interrupt the stream, and is reported
+		// when it ends.
+		dir := filepath.Join(h.dir, "archive")
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		} else if err := os.WriteFile(dir, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(dir)
+		h.srv.SetStream([]string{"100", "101", "102"})
+		out, _, err := h.run("-archive-seen", "stream", "-max", "3")
+		checkIDs(t, out, "100", "101", "102")
+		if err == nil || !strings.Contains(err.Error(), "saving seen") {
+			t.Errorf("stream: got %v, want error saving seen tweets", err)
+		}
+	})
+
+	t.Run("NoReconnect", func(t *testing.T) {
+		h.srv.SetStream([]string{"100"})
+		_, _, err := h.run("stream", "-reconnect=false")
+		if err == nil || !strings.Contains(err.Error(), "stream disconnected") {
+			t.Errorf("stream: got %v, want disconnect error", err)
+		}
+	})
+
+	t.Run("AuthError", func(t *testing.T) {
+		h.srv.Fail("GET", "/2/tweets/search/stream", http.StatusForbidden, 1)
+		_, _, err := h.run("stream")
+		var jerr *jape.Error
+		if !errors.As(err, &jerr) || jerr.Status != http.StatusForbidden {
+			t.Errorf("stream: got %v, want HTTP 403", err)
+		}
+	})
+}
+
+func TestTweet(t *testing.T) {
+	h := newHarness(t)
+
+	t.Run("Create", func(t *testing.T) {
+		out := h.mustRun("-auth-user", "alice", "tweet", "create", "-reply-to", "x.com/bob/status/101", "hi", "bob")
+		got := lines(out)
+		if len(got) != 1 || !strings.Contains(got[0], `"text":"hi bob"`) {
+			t.Fatalf("tweet create: got %q", out)
+		}
+		if n := h.countRequests("POST /1.1/statuses/update.json"); n != 1 {
+			t.Errorf("Got %d update requests, want 1", n)
+		}
+		if tw := h.srv.Tweet("9001"); tw == nil || len(tw.Referenced) != 1 || tw.Referenced[0].ID != "101" {
+			t.Errorf("Created tweet: got %+v, want reply to 101", tw)
+		}
+	})
+
+	t.Run("LikeRetweet", func(t *testing.T) {
+		h.mustRun("-auth-user", "alice", "tweet", "like", "101")
+		if !h.srv.Liked("1", "101") {
+			t.Error("Tweet 101 was not liked")
+		}
+		h.mustRun("-auth-user", "alice", "tweet", "unlike", "101")
+		if h.srv.Liked("1", "101") {
+			t.Error("Tweet 101 is still liked")
+		}
+		h.withStdin("101\n102\n", func() {
+			out := h.mustRun("-auth-user", "alice", "tweet", "retweet", "-")
+			if got := lines(out); len(got) != 2 || got[0] != "101: true" || got[1] != "102: true" {
+				t.Errorf("tweet retweet: got %q", out)
+			}
+		})
+		if !h.srv.Retweeted("1", "101") || !h.srv.Retweeted("1", "102") {
+			t.Error("Tweets were not retweeted")
+		}
+		h.mustRun("-auth-user", "alice", "tweet", "unretweet", "102")
+		if h.srv.Retweeted("1", "102") {
+			t.Error("Tweet 102 is still retweeted")
+		}
+
+		// Changes made on behalf of a user require an authorized user.
+		if _, _, err := h.run("tweet", "like", "102"); err == nil || !strings.Contains(err.Error(), "requires -auth-user") {
+			t.Errorf("tweet like without -auth-user: got %v, want missing -auth-user", err)
+		}
+		if h.srv.Liked("1", "102") {
+			t.Error("Tweet 102 was liked without an authorized user")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		// Confirmation is required, but stdin is not a terminal.
+		var err error
+		h.withStdin("y\n", func() {
+			_, _, err = h.run("-auth-user", "alice", "tweet", "delete", "100")
+		})
+		if !errors.Is(err, config.ErrNotConfirmed) || !strings.Contains(err.Error(), "-yes") {
+			t.Errorf("tweet delete: got %v, want confirmation error", err)
+		}
+		if h.srv.Tweet("100") == nil {
+			t.Fatal("Tweet 100 was deleted without confirmation")
+		}
+
+		// With -yes, the tweets are deleted without fetching them to show.
+		nlookup := h.countRequests("GET /2/tweets?")
+		h.mustRun("-auth-user", "alice", "-yes", "tweet", "delete", "100")
+		if h.srv.Tweet("100") != nil {
+			t.Error("Tweet 100 was not deleted")
+		}
+		if n := h.countRequests("GET /2/tweets?") - nlookup; n != 0 {
+			t.Errorf("Got %d tweet lookups, want 0", n)
+		}
+
+		// The IDs to delete may be read from stdin.
+		h.withStdin("101\n", func() { h.mustRun("-auth-user", "alice", "-yes", "tweet", "delete", "-") })
+		if h.srv.Tweet("101") != nil {
+			t.Error("Tweet 101 was not deleted")
+		}
+
+		// Deleting a tweet does not need the authorized user's ID.
+		before := h.countRequests("GET /2/users/by?")
+		h.mustRun("-auth-user", "alice", "-yes", "tweet", "delete", "102")
+		if h.srv.Tweet("102") != nil {
+			t.Error("Tweet 102 was not deleted")
+		}
+		if n := h.countRequests("GET /2/users/by?") - before; n != 0 {
+			t.Errorf("Got %d user lookups, want 0", n)
+		}
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		out, _, err := h.run("-auth-user", "alice", "-dry-run", "tweet", "like", "102")
+		if !errors.Is(err, config.ErrDryRun) {
+			t.Errorf("tweet like: got %v, want %v", err, config.ErrDryRun)
+		}
+		if !strings.Contains(out, "POST ") || !strings.Contains(out, "/2/users/1/likes") {
+			t.Errorf("Dry run output does not show the request:\n%s", out)
+		}
+		if h.srv.Liked("1", "102") {
+			t.Error("Tweet 102 was liked during a dry run")
+		}
+	})
+}
+
+func TestList(t *testing.T) {
+	h := newHarness(t)
+	h.srv.AddList(&types.List{ID: "500", Name: "friends", OwnerID: "1"}, "2")
+
+	checkIDs(t, h.mustRun("list", "lookup", "https://twitter.com/i/lists/500"), "500")
+	checkIDs(t, h.mustRun("list", "owned-by", "1"), "500")
+	checkIDs(t, h.mustRun("list", "members", "500"), "2")
+
+	t.Run("Create", func(t *testing.T) {
+		out := h.mustRun("-auth-user", "alice", "list", "create", "-private", "new", "a", "new", "list")
+		checkIDs(t, out, "9001")
+		out = h.mustRun("-auth-user", "alice", "list", "update", "-name", "renamed", "9001")
+		if strings.TrimSpace(out) != "updated: true" {
+			t.Errorf("list update: got %q", out)
+		}
+		if out := h.mustRun("list", "lookup", "9001"); !strings.Contains(out, `"renamed"`) {
+			t.Errorf("list lookup after update: got %s", out)
+		}
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		h.mustRun("-auth-user", "alice", "list", "add-member", "500", "@carol", "1")
+		if got := h.srv.ListMembers("500"); strings.Join(got, ",") != "2,3,1" {
+			t.Errorf("List members: got %q, want 2,3,1", got)
+		}
+		out := h.mustRun("-auth-user", "alice", "list", "remove-member", "500", "@bob")
+		if strings.TrimSpace(out) != "2: true" {
+			t.Errorf("list remove-member: got %q", out)
+		}
+		checkIDs(t, h.mustRun("list", "members", "500"), "3", "1")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		h.withStdin("y\n", func() {
+			if _, _, err := h.run("-auth-user", "alice", "list", "delete", "9001"); !errors.Is(err, config.ErrNotConfirmed) {
+				t.Errorf("list delete: got %v, want confirmation error", err)
+			}
+		})
+		nlookup := h.countRequests("GET /2/lists/9001")
+		out := h.mustRun("-auth-user", "alice", "-yes", "list", "delete", "9001")
+		if strings.TrimSpace(out) != "deleted: true" {
+			t.Errorf("list delete: got %q", out)
+		}
+		if n := h.countRequests("GET /2/lists/9001") - nlookup; n != 0 {
+			t.Errorf("Got %d list lookups, want 0", n)
+		}
+	})
+}
+
+func TestFollowers(t *testing.T) {
+	h := newHarness(t)
+	h.srv.PageSize = 1
+	h.srv.AddFollow("2", "1")
+	h.srv.AddFollow("3", "1")
+	h.srv.AddFollow("1", "3")
+
+	checkIDs(t, h.mustRun("list", "followers-of", "1"), "2", "3")
+	checkIDs(t, h.mustRun("list", "followed-by", "1"), "3")
+	checkIDs(t, h.mustRun("list", "-max", "1", "followers-of", "1"), "2")
+}
+
+func TestHelp(t *testing.T) {
+	h := newHarness(t)
+	for _, topic := range []string{"dry-run", "config"} {
+		_, log, err := h.run("help", topic)
+		if !errors.Is(err, command.ErrUsage) {
+			t.Errorf("help %s: got %v, want %v", topic, err, command.ErrUsage)
+		}
+		if !strings.Contains(log, "-"+topic) && !strings.Contains(log, topic+" file") {
+			t.Errorf("help %s: unexpected output:\n%s", topic, log)
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	h := newHarness(t)
+	dir := filepath.Join(h.dir, "cassette")
+	want := h.mustRun("-record", dir, "lookup", "100", "101")
+	h.mustRun("-record", dir, "-auth-user", "alice", "user", "@bob")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Got %d recorded files, want 2: %q", len(files), files)
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("bearer-token")) || bytes.Contains(data, []byte("alice-token")) {
+			t.Errorf("Recording %s contains credentials:\n%s", path, data)
+		}
+	}
+
+	// Replay against a server that is not listening; nothing should be sent.
+	before := len(h.srv.Requests())
+	got := h.mustRun("-replay", dir, "-api-url", "http://127.0.0.1:1", "lookup", "100", "101")
+	if got != want {
+		t.Errorf("Replayed output differs:\ngot:  %s\nwant: %s", got, want)
+	}
+	checkIDs(t, h.mustRun("-replay", dir, "-auth-user", "alice", "user", "@bob"), "2")
+	if n := len(h.srv.Requests()); n != before {
+		t.Errorf("Server got %d requests during replay, want 0", n-before)
+	}
+
+	if _, _, err := h.run("-replay", dir, "lookup", "102"); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Errorf("lookup: got %v, want missing recording error", err)
+	}
+	if _, _, err := h.run("-replay", dir, "-record", dir, "lookup", "100"); err == nil {
+		t.Error("Using -record and -replay together: got nil error")
+	}
+
+	// Numbering continues after the last recording, even if some earlier
+	// recordings were removed, so that none of them is overwritten.
+	if err := os.Remove(filepath.Join(dir, "0001.json")); err != nil {
+		t.Fatal(err)
+	}
+	h.mustRun("-record", dir, "lookup", "102")
+	for _, name := range []string{"0002.json", "0003.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Recording %s: %v", name, err)
+		}
+	}
+}
+
+func TestTweetMedia(t *testing.T) {
+	h := newHarness(t)
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(h.dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	img1 := writeFile("one.png", png)
+	img2 := writeFile("two.png", png)
+
+	// An MP4 header followed by enough data to require several chunks.
+	mp4 := append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), make([]byte, 3<<19)...)
+	video := writeFile("clip.mp4", mp4)
+
+	t.Run("Images", func(t *testing.T) {
+		out, log, err := h.run("-auth-user", "alice", "tweet", "create",
+			"-media", img1, "-alt", "a picture", "-media", img2, "two pictures")
+		if err != nil {
+			t.Fatalf("tweet create: %v", err)
+		}
+		if !strings.Contains(log, "upload one.png: 100%") || !strings.Contains(log, "upload two.png: 100%") {
+			t.Errorf("Upload progress not reported:\n%s", log)
+		}
+		checkIDs(t, out, "9003")
+		tw := h.srv.Tweet("9003")
+		if tw == nil || len(tw.Attachments["media_keys"]) != 2 {
+			t.Fatalf("Created tweet: got %+v, want 2 media attachments", tw)
+		}
+		if m := h.srv.Media("9001"); m == nil || m.AltText != "a picture" || m.Category != "tweet_image" {
+			t.Errorf("Media 9001: got %+v, want image with alt text", m)
+		}
+		if m := h.srv.Media("9002"); m == nil || m.AltText != "" {
+			t.Errorf("Media 9002: got %+v, want no alt text", m)
+		}
+	})
+
+	t.Run("Video", func(t *testing.T) {
+		_, log, err := h.run("-auth-user", "alice", "tweet", "create", "-media", video, "a video")
+		if err != nil {
+			t.Fatalf("tweet create: %v", err)
+		}
+		if n := h.countRequests("POST /1.1/media/upload.json?command=APPEND&media_id=9004&"); n != 2 {
+			t.Errorf("Got %d APPEND requests, want 2", n)
+		}
+		if !strings.Contains(log, "processing 50%") {
+			t.Errorf("Processing status not reported:\n%s", log)
+		}
+		m := h.srv.Media("9004")
+		if m == nil || m.Category != "tweet_video" || !bytes.Equal(m.Data, mp4) {
+			t.Errorf("Media 9004 was not uploaded correctly")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		text := writeFile("notes.txt", []byte("just some text"))
+		for _, args := range [][]string{
+			{"-media", text},
+			{"-media", img1, "-media", video},
+			{"-media", img1, "-media", img1, "-media", img1, "-media", img1, "-media", img1},
+			{"-media", img1, "-alt", "one", "-alt", "two"},
+		} {
+			before := h.countRequests("POST")
+			cmd := append([]string{"-auth-user", "alice", "tweet", "create"}, args...)
+			if _, _, err := h.run(append(cmd, "text")...); err == nil {
+				t.Errorf("tweet create %q: got nil error", args)
+			}
+			if h.countRequests("POST") != before {
+				t.Errorf("tweet create %q: requests sent for invalid media", args)
+			}
+		}
+	})
+}
+
+func TestTweetCreateV2(t *testing.T) {
+	h := newHarness(t)
+	create := func(args ...string) (string, error) {
+		out, _, err := h.run(append([]string{"-auth-user", "alice", "tweet", "create"}, args...)...)
+		return out, err
+	}
+
+	t.Run("Poll", func(t *testing.T) {
+		out, err := create("-poll", "cats, dogs,fish", "-poll-minutes", "60", "-reply-settings", "following", "best", "pet?")
+		if err != nil {
+			t.Fatalf("tweet create: %v", err)
+		}
+		checkIDs(t, out, "9001")
+		got := string(h.srv.CreateRequest("9001"))
+		for _, want := range []string{
+			`"text":"best pet?"`,
+			`"options":["cats","dogs","fish"]`,
+			`"duration_minutes":60`,
+			`"reply_settings":"following"`,
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Create request %s does not contain %s", got, want)
+			}
+		}
+	})
+
+	t.Run("QuoteReply", func(t *testing.T) {
+		out, err := create("-quote", "https://twitter.com/bob/status/101",
+			"-reply-to", "102", "-exclude-reply-user", "@carol", "look")
+		if err != nil {
+			t.Fatalf("tweet create: %v", err)
+		}
+		checkIDs(t, out, "9002")
+		got := string(h.srv.CreateRequest("9002"))
+		for _, want := range []string{
+			`"quote_tweet_id":"101"`,
+			`"in_reply_to_tweet_id":"102"`,
+			`"exclude_reply_user_ids":["3"]`,
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Create request %s does not contain %s", got, want)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		img := filepath.Join(h.dir, "img.png")
+		if err := os.WriteFile(img, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 10)...), 0600); err != nil {
+			t.Fatal(err)
+		}
+		for _, args := range [][]string{
+			{"-poll", "only one"},
+			{"-poll", "a,b,c,d,e"},
+			{"-poll", "a,,b"},
+			{"-poll", "a,this option is much too long to use"},
+			{"-poll", "a,b", "-poll-minutes", "1"},
+			{"-poll-minutes", "10"},
+			{"-poll", "a,b", "-quote", "101"},
+			{"-poll", "a,b", "-media", img},
+			{"-reply-settings", "everybody"},
+			{"-exclude-reply-user", "@bob"},
+			{"-auto-reply", "-quote", "101"},
+		} {
+			before := len(h.srv.Requests())
+			if _, err := create(append(args, "text")...); err == nil {
+				t.Errorf("tweet create %q: got nil error", args)
+			}
+			if len(h.srv.Requests()) != before {
+				t.Errorf("tweet create %q: requests sent for invalid options", args)
+			}
+		}
+	})
+}
+
+func TestTweetThread(t *testing.T) {
+	h := newHarness(t)
+	writeText := func(name, text string) string {
+		path := filepath.Join(h.dir, name)
+		if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	checkReply := func(id, parent string) {
+		t.Helper()
+		tw := h.srv.Tweet(id)
+		if tw == nil {
+			t.Fatalf("Tweet %s was not created", id)
+		}
+		if len(tw.Referenced) != 1 || tw.Referenced[0].ID != parent {
+			t.Errorf("Tweet %s: got references %+v, want reply to %s", id, tw.Referenced, parent)
+		}
+	}
+
+	t.Run("Separators", func(t *testing.T) {
+		path := writeText("sep.txt", "First part.\n---\nSecond part.\n\n---\nThird part.\n")
+		out := h.mustRun("-auth-user", "alice", "tweet", "thread", "-number", "-reply-to", "100", path)
+		checkIDs(t, out, "9001", "9002", "9003")
+		checkReply("9001", "100")
+		checkReply("9002", "9001")
+		checkReply("9003", "9002")
+		if got, want := h.srv.Tweet("9002").Text, "Second part. 2/3"; got != want {
+			t.Errorf("Tweet 2: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Split", func(t *testing.T) {
+		sentence := strings.Repeat("word ", 19) + "end."
+		para := strings.Repeat(sentence+" ", 5)
+		text := "A short opening.\n\n" + para + "\n\nA short closing."
+		var out string
+		h.withStdin(text, func() {
+			out = h.mustRun("tweet", "thread", "-preview", "-number")
+		})
+		var parts []string
+		for _, part := range strings.Split(out, "--- ")[1:] {
+			_, body, _ := strings.Cut(strings.TrimSuffix(part, "\n"), "\n")
+			if n := len([]rune(body)); n > 280 {
+				t.Errorf("Part is too long (%d characters): %q", n, body)
+			}
+			parts = append(parts, body)
+		}
+		if len(parts) != 3 {
+			t.Fatalf("Got %d parts, want 3:\n%s", len(parts), out)
+		}
+		if !strings.HasPrefix(parts[0], "A short opening.\n\nword") || !strings.HasSuffix(parts[0], "end. 1/3") {
+			t.Errorf("Part 1 is not split at a sentence: %q", parts[0])
+		}
+		if !strings.HasSuffix(parts[2], "end.\n\nA short closing. 3/3") {
+			t.Errorf("Part 3 does not end with the closing paragraph: %q", parts[2])
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		path := writeText("resume.txt", "One.\n---\nTwo.\n---\nThree.\n")
+		h.srv.FailAfter(1, "POST", "/1.1/statuses/update.json", http.StatusForbidden, 1)
+		out, log, err := h.run("-auth-user", "alice", "tweet", "thread", path)
+		if err == nil {
+			t.Fatal("tweet thread: got nil error, want failure")
+		}
+		checkIDs(t, out, "9004")
+		if want := "-resume 2 -reply-to 9004"; !strings.Contains(log, want) {
+			t.Errorf("Log does not contain %q:\n%s", want, log)
+		}
+
+		out = h.mustRun("-auth-user", "alice", "tweet", "thread", "-resume", "2", "-reply-to", "9004", path)
+		checkIDs(t, out, "9005", "9006")
+		checkReply("9005", "9004")
+		checkReply("9006", "9005")
+		if got := h.srv.Tweet("9005").Text; got != "Two." {
+			t.Errorf("Resumed tweet: got %q, want %q", got, "Two.")
+		}
+
+		if _, _, err := h.run("tweet", "thread", "-resume", "2", path); err == nil {
+			t.Error("tweet thread -resume without -reply-to: got nil error")
+		}
+	})
+}
+
+func TestTweetLength(t *testing.T) {
+	h := newHarness(t)
+	long := "example.com/" + strings.Repeat("x", 300)
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{strings.Repeat("a", 280), true},
+		{strings.Repeat("a", 281), false},
+		{strings.Repeat("字", 140), true},
+		{strings.Repeat("字", 141), false},
+		{strings.Repeat("👍🏽", 140), true},
+		{strings.Repeat("👩‍👩‍👧", 141), false},
+		{strings.Repeat("a", 256) + " " + long, true},        // URLs count as 23
+		{strings.Repeat("a", 257) + " example.com/x", false}, // also without a scheme
+		{strings.Repeat("a", 257) + " node.js", true},
+		{strings.Repeat("é", 280), true}, // composed
+		{strings.Repeat("é", 280), true},
+		{"bad ‮ text", false},
+	}
+	for _, test := range tests {
+		before := len(h.srv.Requests())
+		_, _, err := h.run("-auth-user", "alice", "tweet", "create", test.text)
+		if test.ok && err != nil {
+			t.Errorf("tweet create %q: unexpected error: %v", snip(test.text), err)
+		} else if !test.ok {
+			if err == nil {
+				t.Errorf("tweet create %q: got nil error", snip(test.text))
+			} else if len(h.srv.Requests()) != before {
+				t.Errorf("tweet create %q: request sent for invalid text", snip(test.text))
+			}
+		}
+	}
+
+	_, _, err := h.run("tweet", "create", strings.Repeat("a", 270)+" "+strings.Repeat("字", 10))
+	if want := "begins at position 276"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("tweet create: got error %v, want %q", err, want)
+	}
+
+	var out string
+	h.withStdin("Hi @bob and @carol, see #golang and https://example.com/#notatag.", func() {
+		out = h.mustRun("tweet", "thread", "-preview")
+	})
+	if want := "(60 characters; mentions @bob, @carol; hashtags #golang)"; !strings.Contains(out, want) {
+		t.Errorf("Preview: got %q, want %q", out, want)
+	}
+}
+
+func snip(s string) string {
+	if rs := []rune(s); len(rs) > 20 {
+		return string(rs[:20]) + "…"
+	}
+	return s
+}
+
+func TestTweetCompose(t *testing.T) {
+	h := newHarness(t)
+	template := filepath.Join(h.dir, "template")
+
+	// The editor saves a copy of the template it was given, then replaces the
+	// text with the contents of the next numbered file in h.dir.
+	editor := filepath.Join(h.dir, "editor.sh")
+	if err := os.WriteFile(editor, []byte(`#!/bin/sh
+dir=$(dirname "$0")
+n=$(cat "$dir/count" 2>/dev/null || echo 0)
+n=$((n+1)); echo $n > "$dir/count"
+cp "$1" "$dir/template"
+cat "$dir/text.$n" > "$1"
+`), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+	setTexts := func(texts ...string) {
+		t.Helper()
+		os.Remove(filepath.Join(h.dir, "count"))
+		for i, text := range texts {
+			if err := os.WriteFile(filepath.Join(h.dir, fmt.Sprintf("text.%d", i+1)), []byte(text), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	readTemplate := func() string {
+		t.Helper()
+		data, err := os.ReadFile(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	t.Run("NoTerminal", func(t *testing.T) {
+		setTexts("not used")
+		_, log, err := h.run("-auth-user", "alice", "tweet", "create")
+		if !errors.Is(err, command.ErrUsage) {
+			t.Errorf("tweet create: got %v, want usage error", err)
+		}
+		if want := "requires a terminal"; !strings.Contains(log, want) {
+			t.Errorf("Log does not contain %q:\n%s", want, log)
+		}
+		if _, err := os.Stat(filepath.Join(h.dir, "count")); err == nil {
+			t.Error("The editor was run without a terminal")
+		}
+	})
+
+	// The remaining tests that use the editor need a terminal.
+	h.withTerminal(func() {
+		t.Run("Reply", func(t *testing.T) {
+			setTexts("#golang is \"fun\"\nsecond line\n# ------------------------ >8 ------------------------\nignored\n")
+			out := h.mustRun("-auth-user", "alice", "tweet", "create", "-reply-to", "101")
+			checkIDs(t, out, "9001")
+			if got, want := h.srv.Tweet("9001").Text, "#golang is \"fun\"\nsecond line"; got != want {
+				t.Errorf("Tweet text: got %q, want %q", got, want)
+			}
+			got := readTemplate()
+			for _, want := range []string{
+				"# Replying to @bob (Bob), tweet 101:\n#   hello from bob\n",
+				"# Length: 0 of 280 characters, 280 remaining",
+			} {
+				if !strings.Contains(got, want) {
+					t.Errorf("Template does not contain %q:\n%s", want, got)
+				}
+			}
+		})
+
+		t.Run("TooLong", func(t *testing.T) {
+			setTexts(strings.Repeat("a", 290), "short enough")
+			out := h.mustRun("-auth-user", "alice", "tweet", "create", "-e", "draft")
+			checkIDs(t, out, "9002")
+			if got, want := h.srv.Tweet("9002").Text, "short enough"; got != want {
+				t.Errorf("Tweet text: got %q, want %q", got, want)
+			}
+			got := readTemplate()
+			if want := "# Length: 290 of 280 characters, 10 too many"; !strings.Contains(got, want) {
+				t.Errorf("Template does not contain %q:\n%s", want, got)
+			}
+		})
+
+		t.Run("Cancel", func(t *testing.T) {
+			setTexts("\n\n")
+			before := h.countRequests("POST")
+			if _, _, err := h.run("-auth-user", "alice", "tweet", "create"); err == nil {
+				t.Error("tweet create: got nil error for empty text")
+			}
+			if n := h.countRequests("POST"); n != before {
+				t.Errorf("Got %d POST requests for a cancelled tweet", n-before)
+			}
+		})
+
+		t.Run("Unchanged", func(t *testing.T) {
+			// The editor leaves the text too long, so there is no point in
+			// running it again.
+			long := strings.Repeat("a", 290)
+			setTexts(long, long, "short enough")
+			before := h.countRequests("POST")
+			_, _, err := h.run("-auth-user", "alice", "tweet", "create", "-e", "draft")
+			if err == nil || !strings.Contains(err.Error(), "too long") {
+				t.Errorf("tweet create: got %v, want too long error", err)
+			}
+			if n := h.countRequests("POST"); n != before {
+				t.Errorf("Got %d POST requests for invalid text", n-before)
+			}
+			if data, _ := os.ReadFile(filepath.Join(h.dir, "count")); strings.TrimSpace(string(data)) != "2" {
+				t.Errorf("Editor ran %q times, want 2", data)
+			}
+		})
+	})
+
+	t.Run("Stdin", func(t *testing.T) {
+		var out string
+		h.withStdin("it's \"quoted\"\n👍 see https://example.com\n", func() {
+			out = h.mustRun("-auth-user", "alice", "tweet", "create", "-")
+		})
+		checkIDs(t, out, "9003")
+		if got, want := h.srv.Tweet("9003").Text, "it's \"quoted\"\n👍 see https://example.com"; got != want {
+			t.Errorf("Tweet text: got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	h := newHarness(t)
+	schedule := func(args ...string) (string, string, error) {
+		return h.run(append([]string{"-auth-user", "alice", "schedule"}, args...)...)
+	}
+	mustSchedule := func(args ...string) string {
+		t.Helper()
+		out, _, err := schedule(args...)
+		if err != nil {
+			t.Fatalf("schedule %q: unexpected error: %v", args, err)
+		}
+		return out
+	}
+	checkStates := func(out string, states ...string) {
+		t.Helper()
+		got := lines(out)
+		if len(got) != len(states) {
+			t.Fatalf("Got %d entries, want %d:\n%s", len(got), len(states), out)
+		}
+		for i, line := range got {
+			if want := fmt.Sprintf(`"state":%q`, states[i]); !strings.Contains(line, want) {
+				t.Errorf("Entry %d: got %s, want %s", i+1, line, want)
+			}
+		}
+	}
+
+	mustSchedule("add", "-at", "+1h", "a later tweet")
+	mustSchedule("add", "-at", "+0s", "-reply-to", "101", "a tweet due now")
+	checkStates(mustSchedule("list"), "pending", "pending")
+
+	for _, args := range [][]string{
+		{"add", "no time given"},
+		{"add", "-at", "tomorrowish", "bad time"},
+		{"add", "-at", "+1h", strings.Repeat("x", 281)},
+	} {
+		if _, _, err := schedule(args...); err == nil {
+			t.Errorf("schedule %q: got nil error", args)
+		}
+	}
+	if _, _, err := h.run("schedule", "add", "-at", "+1h", "no user"); err == nil {
+		t.Error("schedule add without -auth-user: got nil error")
+	}
+
+	t.Run("Run", func(t *testing.T) {
+		out := mustSchedule("run", "-once")
+		checkStates(out, "posted")
+		if !strings.Contains(out, `"tweet_id":"9001"`) {
+			t.Errorf("Run output does not record the tweet ID: %s", out)
+		}
+		tw := h.srv.Tweet("9001")
+		if tw == nil || tw.Text != "a tweet due now" {
+			t.Fatalf("Posted tweet: got %+v", tw)
+		} else if len(tw.Referenced) != 1 || tw.Referenced[0].ID != "101" {
+			t.Errorf("Posted tweet references: got %+v, want reply to 101", tw.Referenced)
+		}
+		checkStates(mustSchedule("list"), "pending")
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		mustSchedule("edit", "-at", "+0s", "1", "an edited tweet")
+		mustSchedule("add", "-at", "+0s", "a cancelled tweet")
+		if out := mustSchedule("cancel", "3"); !strings.Contains(out, "cancelled: 1") {
+			t.Errorf("Cancel: got %q", out)
+		}
+
+		h.srv.Fail("POST", "/1.1/statuses/update.json", http.StatusServiceUnavailable, 1)
+		out, log, err := schedule("run", "-once", "-retry-delay", "1ms")
+		if err != nil {
+			t.Fatalf("schedule run: %v", err)
+		} else if out != "" {
+			t.Errorf("schedule run: unexpected output %q", out)
+		}
+		if !strings.Contains(log, "Tweet 1 failed (attempt 1 of 5), retrying") {
+			t.Errorf("Log does not report the retry:\n%s", log)
+		}
+		if out := mustSchedule("list"); !strings.Contains(out, `"attempts":1`) {
+			t.Errorf("Entry does not record the attempt: %s", out)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		checkStates(mustSchedule("run", "-once"), "posted")
+		if tw := h.srv.Tweet("9002"); tw == nil || tw.Text != "an edited tweet" {
+			t.Errorf("Retried tweet: got %+v", tw)
+		}
+		if _, _, err := schedule("cancel", "1"); err == nil {
+			t.Error("Cancelling a posted tweet: got nil error")
+		}
+	})
+
+	t.Run("GiveUp", func(t *testing.T) {
+		mustSchedule("add", "-at", "+0s", "a doomed tweet")
+		h.srv.Fail("POST", "/1.1/statuses/update.json", http.StatusServiceUnavailable, 1)
+		_, log, err := schedule("run", "-once", "-max-attempts", "1")
+		if err != nil {
+			t.Fatalf("schedule run: %v", err)
+		} else if !strings.Contains(log, "giving up") {
+			t.Errorf("Log does not report giving up:\n%s", log)
+		}
+		checkStates(mustSchedule("list"))
+		checkStates(mustSchedule("list", "-all"), "posted", "posted", "cancelled", "failed")
+	})
+
+	// rewriteQueue calls f to modify the queue file directly, as another
+	// command sharing it would.
+	path := filepath.Join(h.dir, "schedule.json")
+	type rawQueue struct {
+		NextID  int              `json:"next_id"`
+		Entries []map[string]any `json:"entries"`
+	}
+	rewriteQueue := func(f func(q *rawQueue)) {
+		unlock, err := config.LockFile(path)
+		if err != nil {
+			t.Errorf("Locking schedule: %v", err)
+			return
+		}
+		defer unlock()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Reading schedule: %v", err)
+			return
+		}
+		var q rawQueue
+		if err := json.Unmarshal(data, &q); err != nil {
+			t.Errorf("Decoding schedule: %v", err)
+			return
+		}
+		f(&q)
+		data, _ = json.Marshal(q)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Errorf("Writing schedule: %v", err)
+		}
+	}
+
+	t.Run("Concurrent", func(t *testing.T) {
+		// While the runner is posting, another command adds a tweet to the
+		// queue. The runner must not overwrite it, and the tweet being posted
+		// must be claimed, so that another runner does not post it too.
+		mustSchedule("add", "-at", "+0s", "a tweet posted during an add")
+		h.srv.OnRequest(func(method, reqPath string) {
+			if method != "POST" || reqPath != "/1.1/statuses/update.json" {
+				return
+			}
+			rewriteQueue(func(q *rawQueue) {
+				var claimed bool
+				for _, e := range q.Entries {
+					if e["state"] == "posting" && e["runner"] != nil && e["runner"] != "" {
+						claimed = true
+					}
+				}
+				if !claimed {
+					t.Errorf("No entry is claimed while posting: %+v", q.Entries)
+				}
+				q.Entries = append(q.Entries, map[string]any{
+					"id": strconv.Itoa(q.NextID), "at": time.Now().Add(time.Hour), "user": "alice",
+					"text": "added concurrently", "state": "pending",
+				})
+				q.NextID++
+			})
+		})
+		out := mustSchedule("run", "-once")
+		h.srv.OnRequest(nil)
+		checkStates(out, "posted")
+		if strings.Contains(out, `"runner"`) {
+			t.Errorf("Posted entry still records a runner: %s", out)
+		}
+		out = mustSchedule("list")
+		if !strings.Contains(out, `"id":"6"`) || !strings.Contains(out, "added concurrently") {
+			t.Errorf("Concurrently added tweet is missing: %s", out)
+		}
+		if out := mustSchedule("add", "-at", "+1h", "the next tweet"); !strings.Contains(out, `"id":"7"`) {
+			t.Errorf("Add after run: got %s, want ID 7", out)
+		}
+	})
+
+	t.Run("Claimed", func(t *testing.T) {
+		// Tweet 8 is being posted by another runner, which must be left to it.
+		// Tweet 9 was claimed by a runner that stopped, so it may have been
+		// posted, and must not be posted again.
+		rewriteQueue(func(q *rawQueue) {
+			for i, claimed := range []time.Time{time.Now(), time.Now().Add(-time.Hour)} {
+				q.Entries = append(q.Entries, map[string]any{
+					"id": strconv.Itoa(q.NextID), "at": time.Now().Add(-time.Minute), "user": "alice",
+					"text": "claimed elsewhere", "state": "posting",
+					"runner": fmt.Sprintf("elsewhere:%d", i+1), "claimed": claimed,
+				})
+				q.NextID++
+			}
+		})
+		nposts := h.countRequests("POST /1.1/statuses/update.json")
+		out, log, err := schedule("run", "-once")
+		if err != nil {
+			t.Fatalf("schedule run: unexpected error: %v", err)
+		}
+		checkStates(out)
+		if n := h.countRequests("POST /1.1/statuses/update.json") - nposts; n != 0 {
+			t.Errorf("Got %d posts, want 0", n)
+		}
+		if !strings.Contains(log, "Tweet 9: runner elsewhere:2 stopped while posting") {
+			t.Errorf("Log does not report the abandoned tweet:\n%s", log)
+		}
+		states := make(map[string]string)
+		for _, line := range lines(mustSchedule("list", "-all")) {
+			var e struct{ ID, State string }
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				t.Fatalf("Decoding %q: %v", line, err)
+			}
+			states[e.ID] = e.State
+		}
+		if states["8"] != "posting" || states["9"] != "failed" {
+			t.Errorf("States: got 8=%q, 9=%q; want posting, failed", states["8"], states["9"])
+		}
+	})
+
+	t.Run("StaleLock", func(t *testing.T) {
+		// A lock left by a command that did not exit cleanly is removed.
+		lock := path + ".lock"
+		if err := os.WriteFile(lock, []byte("1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(lock, old, old); err != nil {
+			t.Fatal(err)
+		}
+		mustSchedule("add", "-at", "+1h", "after a stale lock")
+		if _, err := os.Stat(lock); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Lock file was not removed: %v", err)
+		}
+		if m, _ := filepath.Glob(lock + ".stale.*"); len(m) != 0 {
+			t.Errorf("Stale lock files were left behind: %q", m)
+		}
+	})
+}
+
+func TestDraft(t *testing.T) {
+	h := newHarness(t)
+	draft := func(args ...string) (string, error) {
+		out, _, err := h.run(append([]string{"-auth-user", "alice", "draft"}, args...)...)
+		return out, err
+	}
+	mustDraft := func(args ...string) string {
+		t.Helper()
+		out, err := draft(args...)
+		if err != nil {
+			t.Fatalf("draft %q: unexpected error: %v", args, err)
+		}
+		return out
+	}
+	img := filepath.Join(h.dir, "img.png")
+	if err := os.WriteFile(img, append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 10)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mustDraft("save", "-reply-to", "101", "-poll", "yes,no", "a", "poll")
+	mustDraft("save", "-name", "launch", "-media", img, "-alt", "a picture", "launch day")
+	for _, args := range [][]string{
+		{"save", "-name", "launch", "again"},
+		{"save", "-name", "../escape", "text"},
+		{"save", "-poll", "yes,no", "-media", img, "text"},
+		{"save", "-media", filepath.Join(h.dir, "missing.png"), "text"},
+		{"save", strings.Repeat("x", 281)},
+		{"edit", "nonesuch", "text"},
+	} {
+		if _, err := draft(args...); err == nil {
+			t.Errorf("draft %q: got nil error", args)
+		}
+	}
+	out := mustDraft("list")
+	if got := lines(out); len(got) != 2 || !strings.Contains(got[0], `"name":"1"`) || !strings.Contains(got[1], `"name":"launch"`) {
+		t.Errorf("List: got %s, want drafts 1 and launch", out)
+	}
+	if !strings.Contains(out, `"path":"`+img+`","alt":"a picture"`) {
+		t.Errorf("List does not record the media: %s", out)
+	}
+
+	t.Run("EditPost", func(t *testing.T) {
+		mustDraft("edit", "-poll-minutes", "60", "1")
+		mustDraft("edit", "1", "an", "edited", "poll")
+		out := mustDraft("show", "1")
+		for _, want := range []string{`"text":"an edited poll"`, `"in_reply_to":"101"`, `"poll":["yes","no"]`, `"poll_minutes":60`} {
+			if !strings.Contains(out, want) {
+				t.Errorf("Draft %s does not contain %s", out, want)
+			}
+		}
+
+		out = mustDraft("post", "1")
+		checkIDs(t, out, "9001")
+		got := string(h.srv.CreateRequest("9001"))
+		for _, want := range []string{`"text":"an edited poll"`, `"in_reply_to_tweet_id":"101"`, `"duration_minutes":60`} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Create request %s does not contain %s", got, want)
+			}
+		}
+		if _, err := draft("show", "1"); err == nil {
+			t.Error("Draft 1 was not deleted after posting")
+		}
+	})
+
+	t.Run("PostMedia", func(t *testing.T) {
+		out := mustDraft("post", "-keep", "launch")
+		if !strings.Contains(out, `"text":"launch day"`) {
+			t.Errorf("Post: got %s", out)
+		}
+		if h.countRequests("POST /1.1/media/upload.json") == 0 {
+			t.Error("Media was not uploaded")
+		}
+		mustDraft("show", "launch")
+		if out := mustDraft("delete", "launch"); !strings.Contains(out, "deleted: 1") {
+			t.Errorf("Delete: got %q", out)
+		}
+		if out := mustDraft("list"); out != "" {
+			t.Errorf("List after delete: got %q, want empty", out)
+		}
+	})
+}
+
+func TestTweetPurge(t *testing.T) {
+	h := newHarness(t)
+	h.srv.AddTweet(&types.Tweet{ID: "104", Text: "a reply to bob", AuthorID: "1"})
+	h.srv.AddTweet(&types.Tweet{ID: "105", Text: "a popular hello", AuthorID: "1"})
+
+	archive := filepath.Join(h.dir, "tweets.js")
+	if err := os.WriteFile(archive, []byte(`window.YTD.tweets.part0 = [ {
+  "tweet" : { "id_str" : "100", "full_text" : "hello from alice", "created_at" : "Wed Jan 05 10:00:00 +0000 2022",
+              "favorite_count" : "0", "retweet_count" : "0" }
+}, {
+  "tweet" : { "id_str" : "103", "full_text" : "RT @bob: hello again", "created_at" : "Tue Mar 01 10:00:00 +0000 2022",
+              "favorite_count" : "0", "retweet_count" : "0" }
+}, {
+  "tweet" : { "id_str" : "104", "full_text" : "a reply to bob", "created_at" : "Wed Jun 01 10:00:00 +0000 2022",
+              "favorite_count" : "5", "retweet_count" : "1", "in_reply_to_status_id_str" : "101" }
+}, {
+  "tweet" : { "id_str" : "105", "full_text" : "a popular hello", "created_at" : "Sun Jan 01 10:00:00 +0000 2023",
+              "favorite_count" : "100", "retweet_count" : "20" }
+} ]
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	progress := filepath.Join(h.dir, "purge.log")
+	purge := func(args ...string) (string, string, error) {
+		return h.run(append([]string{"-auth-user", "alice", "-yes", "tweet", "purge",
+			"-archive", archive, "-progress", progress, "-pace", "0", "-rate-wait", "1ms"}, args...)...)
+	}
+
+	t.Run("Filters", func(t *testing.T) {
+		tests := []struct {
+			args []string
+			want []string
+		}{
+			{nil, []string{"100", "103", "104", "105"}},
+			{[]string{"-match", "hello", "-max-likes", "10"}, []string{"100", "103"}},
+			{[]string{"-retweets", "only"}, []string{"103"}},
+			{[]string{"-retweets", "exclude", "-replies", "exclude"}, []string{"100", "105"}},
+			{[]string{"-replies", "only", "-max-retweets", "0"}, nil},
+			{[]string{"-since", "2022-02-01", "-until", "2023-01-01"}, []string{"103", "104"}},
+		}
+		for _, tc := range tests {
+			out, log, err := purge(append(tc.args, "-list")...)
+			if err != nil {
+				t.Fatalf("Purge %q: unexpected error: %v", tc.args, err)
+			}
+			checkIDs(t, out, tc.want...)
+			if want := fmt.Sprintf("%d of 4 tweets", len(tc.want)); !strings.Contains(log, want) {
+				t.Errorf("Purge %q: log %q does not contain %q", tc.args, log, want)
+			}
+		}
+		for _, args := range [][]string{
+			{"-retweets", "some"},
+			{"-match", "("},
+			{"-since", "yesterday"},
+		} {
+			if _, _, err := purge(append(args, "-list")...); err == nil {
+				t.Errorf("Purge %q: got nil error", args)
+			}
+		}
+		if h.countRequests("DELETE ") != 0 {
+			t.Error("Listing deleted tweets")
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		h.srv.Fail("DELETE", "/2/tweets/104", http.StatusTooManyRequests, 1)
+		h.srv.Fail("DELETE", "/2/tweets/105", http.StatusInternalServerError, 1)
+		out, log, err := purge("-retweets", "exclude")
+		if err == nil {
+			t.Error("Purge: got nil error, want failure")
+		}
+		if want := "deleted: 2, already gone: 0, failed: 1, remaining: 1"; !strings.Contains(out, want) {
+			t.Errorf("Purge: got %q, want %q", out, want)
+		}
+		if !strings.Contains(log, "Rate limit exceeded") {
+			t.Errorf("Purge log does not mention the rate limit: %q", log)
+		}
+		if n := h.countRequests("DELETE /2/tweets/104"); n != 2 {
+			t.Errorf("Got %d requests to delete 104, want 2", n)
+		}
+
+		out, log, err = purge()
+		if err != nil {
+			t.Fatalf("Resume: unexpected error: %v", err)
+		}
+		if want := "deleted: 1, already gone: 1, failed: 0, remaining: 0"; !strings.Contains(out, want) {
+			t.Errorf("Resume: got %q, want %q", out, want)
+		}
+		if !strings.Contains(log, "2 already done") {
+			t.Errorf("Resume log: got %q, want 2 already done", log)
+		}
+		for _, id := range []string{"100", "104"} {
+			if n := h.countRequests("DELETE /2/tweets/" + id); n > 2 {
+				t.Errorf("Tweet %s was deleted again (%d requests)", id, n)
+			}
+		}
+		if out, log, _ := purge(); out != "" || !strings.Contains(log, "4 already done") {
+			t.Errorf("Finished purge: got %q, %q", out, log)
+		}
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		out, log, err := h.run("-timeout", "300ms", "-auth-user", "alice", "-yes", "tweet", "purge",
+			"-archive", archive, "-progress", filepath.Join(h.dir, "interrupted.log"),
+			"-retweets", "exclude", "-pace", "1s")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Purge: got %v, want %v", err, context.DeadlineExceeded)
+		}
+		if want := "already gone: 1, failed: 0, remaining: 2"; !strings.Contains(out, want) {
+			t.Errorf("Purge: got %q, want %q", out, want)
+		}
+		if !strings.Contains(log, "To continue, run the same command again.") {
+			t.Errorf("Purge log does not say how to resume: %q", log)
+		}
+	})
+}
+
+// writeArchive writes a zip file of an account archive to path, with the
+// given data files.
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, text := range files {
+		w, err := zw.Create("data/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, text)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	h := newHarness(t)
+	path := filepath.Join(h.dir, "twitter-archive.zip")
+	writeArchive(t, path, map[string]string{
+		"account.js": `window.YTD.account.part0 = [ { "account" : { "accountId" : "1", "username" : "alice",
+  "accountDisplayName" : "Alice", "createdAt" : "2010-04-01T12:00:00.000Z" } } ]`,
+		"profile.js": `window.YTD.profile.part0 = [ { "profile" : { "description" : { "bio" : "just alice" } } } ]`,
+		"tweets.js": `window.YTD.tweets.part0 = [
+  { "tweet" : { "id_str" : "200", "full_text" : "first tweet", "created_at" : "Mon Jan 03 10:00:00 +0000 2022",
+    "favorite_count" : "2", "retweet_count" : "0", "source" : "<a href=\"https://x\">Twitter Web App</a>" } },
+  { "tweet" : { "id_str" : "202", "full_text" : "a reply", "created_at" : "Tue Mar 01 10:00:00 +0000 2022",
+    "favorite_count" : "0", "retweet_count" : "0", "in_reply_to_status_id_str" : "101", "in_reply_to_user_id_str" : "2" } }
+]`,
+		"tweets-part1.js": `window.YTD.tweets.part1 = [
+  { "tweet" : { "id_str" : "201", "full_text" : "Second tweet", "created_at" : "Tue Feb 01 10:00:00 +0000 2022",
+    "favorite_count" : "7", "retweet_count" : "1" } }
+]`,
+		"like.js": `window.YTD.like.part0 = [ { "like" : { "tweetId" : "101", "fullText" : "hello from bob" } },
+  { "like" : { "tweetId" : "102", "fullText" : "hey @alice, it's carol" } } ]`,
+		"follower.js":      `window.YTD.follower.part0 = [ { "follower" : { "accountId" : "2" } }, { "follower" : { "accountId" : "3" } } ]`,
+		"following.js":     `window.YTD.following.part0 = [ { "following" : { "accountId" : "3" } } ]`,
+		"lists-created.js": `window.YTD.lists_created.part0 = [ { "userListInfo" : { "url" : "https://twitter.com/i/lists/500" } } ]`,
+		"lists-member.js":  `window.YTD.lists_member.part0 = [ { "userListInfo" : { "url" : "https://twitter.com/i/lists/501" } } ]`,
+		"direct-messages.js": `window.YTD.direct_messages.part0 = [ { "dmConversation" : { "conversationId" : "1-2", "messages" : [
+  { "messageCreate" : { "id" : "801", "senderId" : "2", "recipientId" : "1", "text" : "reply from bob", "createdAt" : "2022-05-01T10:05:00.000Z" } },
+  { "messageCreate" : { "id" : "800", "senderId" : "1", "recipientId" : "2", "text" : "hi bob", "createdAt" : "2022-05-01T10:00:00.000Z" } }
+] } }, { "dmConversation" : { "conversationId" : "1-3", "messages" : [
+  { "messageCreate" : { "id" : "802", "senderId" : "3", "recipientId" : "1", "text" : "hi from carol", "createdAt" : "2022-06-01T10:00:00.000Z" } }
+] } } ]`,
+	})
+
+	out := h.mustRun("archive", "import", path)
+	for _, want := range []string{"account: 1", "tweets: 3", "likes: 2", "followers: 2", "following: 1",
+		"lists created: 1", "lists member: 1", "messages: 3"} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Import: output %q does not contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "subscribed") {
+		t.Errorf("Import: reported missing subscribed lists: %q", out)
+	}
+	if h.countRequests("") != 0 {
+		t.Error("Import made API requests")
+	}
+
+	query := func(args ...string) string { return h.mustRun(append([]string{"archive", "query"}, args...)...) }
+
+	out = query("account")
+	for _, want := range []string{`"id":"1"`, `"username":"alice"`, `"description":"just alice"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Account: %s does not contain %s", out, want)
+		}
+	}
+
+	checkIDs(t, query("tweets"), "202", "201", "200")
+	checkIDs(t, query("tweets", "-match", "(?i)^\\w+ tweet", "-max", "1"), "201")
+	checkIDs(t, query("tweets", "-since", "2022-01-15", "-until", "2022-03-01"), "201")
+	out = query("tweets", "-match", "first")
+	for _, want := range []string{`"author_id":"1"`, `"source":"Twitter Web App"`, `"like_count":2`, `"created_at":"2022-01-03T10:00:00Z"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Tweet: %s does not contain %s", out, want)
+		}
+	}
+	if out := query("tweets", "-match", "reply"); !strings.Contains(out, `"referenced_tweets":[{"type":"replied_to","id":"101"}]`) {
+		t.Errorf("Reply: got %s", out)
+	}
+
+	checkIDs(t, query("likes"), "101", "102")
+	checkIDs(t, query("likes", "-match", "carol"), "102")
+
+	// Usernames are filled in from the user cache, when they are known.
+	h.mustRun("user", "@bob")
+	out = query("followers")
+	checkIDs(t, out, "2", "3")
+	if !strings.Contains(out, `"username":"bob"`) {
+		t.Errorf("Followers: username not filled in: %s", out)
+	}
+	checkIDs(t, query("following"), "3")
+
+	checkIDs(t, query("lists"), "500", "501")
+	checkIDs(t, query("lists", "-kind", "member"), "501")
+	if out := query("lists", "-kind", "created"); !strings.Contains(out, `"owner_id":"1"`) {
+		t.Errorf("Created list: got %s, want owner 1", out)
+	}
+
+	checkIDs(t, query("messages"), "800", "801", "802")
+	checkIDs(t, query("messages", "-with", "3"), "802")
+	checkIDs(t, query("messages", "-match", "bob", "-since", "2022-05-01T10:01:00Z"), "801")
+
+	// Importing another archive replaces all the records of the first,
+	// including the kinds it has none of.
+	path = filepath.Join(h.dir, "twitter-archive-2.zip")
+	writeArchive(t, path, map[string]string{
+		"tweets.js": `window.YTD.tweets.part0 = [ { "tweet" : { "id_str" : "90", "full_text" : "an old hello",
+  "created_at" : "Mon Jan 03 10:00:00 +0000 2022" } } ]`,
+	})
+	if out := h.mustRun("archive", "import", path); out != "tweets: 1\n" {
+		t.Errorf("Import: got %q, want only tweets", out)
+	}
+	checkIDs(t, query("tweets"), "90")
+	for _, kind := range []string{"likes", "followers", "following", "lists", "messages"} {
+		checkIDs(t, query(kind))
+	}
+	if _, _, err := h.run("archive", "query", "account"); err == nil || !strings.Contains(err.Error(), "no account") {
+		t.Errorf("Account: got %v, want no account error", err)
+	}
+
+	// An archive that cannot be read leaves the earlier records in place,
+	// even those read before the failure.
+	path = filepath.Join(h.dir, "twitter-archive-bad.zip")
+	writeArchive(t, path, map[string]string{
+		"tweets.js": `window.YTD.tweets.part0 = [ { "tweet" : { "id_str" : "91", "full_text" : "a new hello",
+  "created_at" : "Tue Jan 04 10:00:00 +0000 2022" } } ]`,
+		"like.js": `window.YTD.like.part0 = [ { "like" : `,
+	})
+	if out, _, err := h.run("archive", "import", path); err == nil || out != "" {
+		t.Errorf("Import of bad archive: got %q, %v, want error", out, err)
+	}
+	checkIDs(t, query("tweets"), "90")
+
+	for _, args := range [][]string{
+		{"archive", "import"},
+		{"archive", "import", filepath.Join(h.dir, "nonesuch.zip")},
+		{"archive", "query", "lists", "-kind", "all"},
+		{"archive", "query", "tweets", "-match", "("},
+	} {
+		if _, _, err := h.run(args...); err == nil {
+			t.Errorf("Run %q: got nil error", args)
+		}
+	}
+}
+
+func TestArchiveSearch(t *testing.T) {
+	h := newHarness(t)
+	h.srv.AddTweet(&types.Tweet{ID: "103", Text: "Read https://t.co/xyz #golang", AuthorID: "2", Language: "en",
+		Entities: &types.Entities{URLs: []*types.URL{{URL: "https://t.co/xyz", Expanded: "https://example.com/go"}}}})
+	h.srv.AddTweet(&types.Tweet{ID: "104", Text: "@bob thanks for the link", AuthorID: "1", InReplyTo: "2", Language: "fr",
+		Referenced: []*types.Ref{{Type: "replied_to", ID: "103"}}})
+	h.srv.AddTweet(&types.Tweet{ID: "105", Text: "RT @carol: hey @alice, it's carol", AuthorID: "2",
+		Referenced: []*types.Ref{{Type: "retweeted", ID: "102"}}})
+	search := func(args ...string) string { return h.mustRun(append([]string{"archive", "search"}, args...)...) }
+
+	// Nothing is saved unless it is enabled.
+	h.mustRun("lookup", "100")
+	if out := search("hello"); out != "" {
+		t.Fatalf("Search before saving: got %q, want empty", out)
+	}
+
+	h.mustRun("-archive-seen", "lookup", "100", "101", "103", "104", "+author_id")
+	h.mustRun("-archive-seen", "search", "-query", "carol")
+	h.mustRun("-archive-seen", "lookup", "100")
+	h.mustRun("-archive-seen", "user", "@carol")
+
+	data, err := os.ReadFile(filepath.Join(h.dir, "archive", "seen-tweets.json"))
+	if err != nil {
+		t.Fatalf("Reading seen tweets: %v", err)
+	}
+	if n := strings.Count(string(data), `"id":"100"`); n != 1 {
+		t.Errorf("Tweet 100 is recorded %d times, want 1", n)
+	}
+	if !strings.Contains(string(data), `"first_seen"`) || !strings.Contains(string(data), `"last_seen"`) {
+		t.Errorf("Seen tweets do not record when they were seen: %s", data)
+	}
+
+	writeArchive(t, filepath.Join(h.dir, "archive.zip"), map[string]string{
+		"account.js": `window.YTD.account.part0 = [ { "account" : { "accountId" : "1", "username" : "alice" } } ]`,
+		"tweets.js": `window.YTD.tweets.part0 = [ { "tweet" : { "id_str" : "90", "full_text" : "an old hello",
+  "created_at" : "Mon Jan 03 10:00:00 +0000 2022" } } ]`,
+	})
+	h.mustRun("archive", "import", filepath.Join(h.dir, "archive.zip"))
+	nreq := len(h.srv.Requests())
+
+	tests := []struct {
+		query []string
+		want  []string
+	}{
+		{[]string{"hello"}, []string{"101", "100", "90"}},
+		{[]string{"-max", "1", "hello"}, []string{"101"}},
+		{[]string{"HELLO", "from:bob"}, []string{"101"}},
+		{[]string{"from:alice"}, []string{"104", "100", "90"}},
+		{[]string{"from:bob", "-has:links"}, []string{"105", "101"}},
+		{[]string{"has:links", "lang:en"}, []string{"103"}},
+		{[]string{"has:hashtags OR has:mentions"}, []string{"105", "104", "103", "102"}},
+		{[]string{"to:bob"}, []string{"104"}},
+		{[]string{"is:reply", "OR", "is:retweet"}, []string{"105", "104"}},
+		{[]string{"@alice", "-is:retweet"}, []string{"102"}},
+		{[]string{"#golang OR (hey carol)"}, []string{"105", "103", "102"}},
+		{[]string{`"it's carol"`, "-from:carol"}, []string{"105"}},
+		{[]string{"url:example.com"}, []string{"103"}},
+		{[]string{"retweets_of:carol"}, []string{"105"}},
+		{[]string{"conversation_id:100"}, []string{"100"}},
+		{[]string{"--", "-(hello OR carol) -is:nullcast"}, []string{"104", "103"}},
+		{[]string{"hell"}, nil},
+	}
+	for _, tc := range tests {
+		checkIDs(t, search(tc.query...), tc.want...)
+	}
+
+	if n := len(h.srv.Requests()); n != nreq {
+		t.Errorf("Search made %d API requests, want 0", n-nreq)
+	}
+
+	for _, query := range []string{"list:123", "is:verified", "(hello", "hello)", `"open`, "a -", "a OR"} {
+		if _, _, err := h.run("archive", "search", query); err == nil {
+			t.Errorf("Search %q: got nil error", query)
+		}
+	}
+}
+
+func TestBookmark(t *testing.T) {
+	h := newHarness(t)
+	bookmark := func(args ...string) string {
+		t.Helper()
+		return h.mustRun(append([]string{"-auth-user", "alice", "bookmark"}, args...)...)
+	}
+
+	if out := bookmark("add", "101"); out != "101: true\n" {
+		t.Errorf("Add: got %q, want 101: true", out)
+	}
+	h.withStdin("100\n{\"id\":\"102\"}\n", func() {
+		if got := lines(bookmark("add", "-")); len(got) != 2 {
+			t.Errorf("Add from stdin: got %q, want 2 results", got)
+		}
+	})
+	for _, id := range []string{"100", "101", "102"} {
+		if !h.srv.Bookmarked("1", id) {
+			t.Errorf("Tweet %s is not bookmarked", id)
+		}
+	}
+
+	checkIDs(t, bookmark("list"), "102", "101", "100")
+	checkIDs(t, bookmark("-max", "2", "list"), "102", "101")
+	checkIDs(t, bookmark("-page", "2", "list"), "100")
+	if out := bookmark("list", "+author_id"); !strings.Contains(out, `"author_id":"3"`) {
+		t.Errorf("List with fields: got %s", out)
+	}
+
+	if out := bookmark("remove", "101"); out != "101: false\n" {
+		t.Errorf("Remove: got %q, want 101: false", out)
+	}
+	if h.srv.Bookmarked("1", "101") {
+		t.Error("Tweet 101 is still bookmarked")
+	}
+	checkIDs(t, bookmark("list"), "102", "100")
+
+	for _, args := range [][]string{
+		{"bookmark", "list"},
+		{"-auth-user", "alice", "bookmark", "add", "999"},
+		{"-auth-user", "alice", "bookmark", "add"},
+		{"-auth-user", "alice", "bookmark", "list", "extra"},
+	} {
+		if _, _, err := h.run(args...); err == nil {
+			t.Errorf("Run %q: got nil error", args)
+		}
+	}
+}
+
+func TestModerate(t *testing.T) {
+	h := newHarness(t)
+	for _, tw := range []*types.Tweet{
+		{ID: "200", Text: "BUY cheap followers now", AuthorID: "2", ConversationID: "100"},
+		{ID: "201", Text: "nice post", AuthorID: "3", ConversationID: "100"},
+		{ID: "202", Text: "thanks, I will buy you a coffee", AuthorID: "1", ConversationID: "100"},
+		{ID: "203", Text: "buy this too", AuthorID: "2", ConversationID: "101"},
+	} {
+		h.srv.AddTweet(tw)
+	}
+	tweet := func(args ...string) string {
+		t.Helper()
+		return h.mustRun(append([]string{"-auth-user", "alice", "tweet"}, args...)...)
+	}
+
+	t.Run("HideUnhide", func(t *testing.T) {
+		tweet("hide", "201")
+		if !h.srv.Hidden("201") {
+			t.Error("Reply 201 is not hidden")
+		}
+		tweet("unhide", "201")
+		if h.srv.Hidden("201") {
+			t.Error("Reply 201 is still hidden")
+		}
+		if _, _, err := h.run("-auth-user", "alice", "tweet", "hide", "999"); err == nil {
+			t.Error("Hide of a missing tweet: got nil error")
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		checkIDs(t, tweet("moderate", "-list", "-match", "(?i)buy", "100"), "200")
+		checkIDs(t, tweet("moderate", "-list", "-author", "^carol$", "100"), "201")
+		checkIDs(t, tweet("moderate", "-list", "-match", "(?i)buy", "-author", "carol", "100"), "201", "200")
+		for _, id := range []string{"200", "201"} {
+			if h.srv.Hidden(id) {
+				t.Errorf("Listing hid reply %s", id)
+			}
+		}
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		_, log, err := h.run("-auth-user", "alice", "-dry-run", "tweet", "moderate", "-match", "(?i)buy", "100")
+		if err != nil {
+			t.Fatalf("Moderate: unexpected error: %v", err)
+		}
+		if !strings.Contains(log, "200 @bob: BUY cheap followers now") {
+			t.Errorf("Preview does not show reply 200:\n%s", log)
+		}
+		if h.srv.Hidden("200") {
+			t.Error("Dry run hid reply 200")
+		}
+	})
+
+	t.Run("Hide", func(t *testing.T) {
+		h.srv.Fail("PUT", "/2/tweets/200/hidden", http.StatusTooManyRequests, 1)
+		start := time.Now()
+		out, log, err := h.run("-auth-user", "alice", "-yes", "tweet", "moderate", "-match", "(?i)buy", "-author", "carol",
+			"-pace", "50ms", "-rate-wait", "1ms", "100")
+		if err != nil {
+			t.Fatalf("Moderate: unexpected error: %v", err)
+		}
+		if d := time.Since(start); d < 50*time.Millisecond {
+			t.Errorf("Hiding 2 replies took %v, want at least 50ms", d)
+		}
+		if !strings.Contains(log, "2 of 3 replies in conversation 100 match") || !strings.Contains(log, "Rate limit exceeded") {
+			t.Errorf("Moderate log: got %q", log)
+		}
+		if n := h.countRequests("PUT /2/tweets/200/hidden"); n != 2 {
+			t.Errorf("Got %d requests to hide 200, want 2", n)
+		}
+		if got, want := lines(out), []string{"201: true", "200: true"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Moderate output: got %q, want %q", got, want)
+		}
+		for id, want := range map[string]bool{"200": true, "201": true, "202": false, "203": false} {
+			if got := h.srv.Hidden(id); got != want {
+				t.Errorf("Reply %s hidden: got %v, want %v", id, got, want)
+			}
+		}
+	})
+
+	for _, args := range [][]string{
+		{"tweet", "moderate", "100"},
+		{"tweet", "moderate", "-match", "(", "100"},
+		{"tweet", "moderate", "-match", "buy"},
+	} {
+		if _, _, err := h.run(append([]string{"-auth-user", "alice"}, args...)...); err == nil {
+			t.Errorf("Run %q: got nil error", args)
+		}
+	}
+}
+
+func TestTweetMutateMany(t *testing.T) {
+	h := newHarness(t)
+	tweet := func(args ...string) (string, string, error) {
+		t.Helper()
+		return h.run(append([]string{"-auth-user", "alice", "tweet"}, args...)...)
+	}
+
+	t.Run("Like", func(t *testing.T) {
+		var out, log string
+		var err error
+		h.withStdin("102\n", func() {
+			out, log, err = tweet("like", "-workers", "2", "100", "101", "-")
+		})
+		if err != nil {
+			t.Fatalf("Like: unexpected error: %v", err)
+		}
+		if got, want := lines(out), []string{"100: true", "101: true", "102: true"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Like output: got %q, want %q", got, want)
+		}
+		if !strings.Contains(log, "succeeded: 3, already done: 0, failed: 0") {
+			t.Errorf("Like summary: got %q", log)
+		}
+		for _, id := range []string{"100", "101", "102"} {
+			if !h.srv.Liked("1", id) {
+				t.Errorf("Tweet %s was not liked", id)
+			}
+		}
+	})
+
+	t.Run("Already", func(t *testing.T) {
+		h.mustRun("-auth-user", "alice", "tweet", "retweet", "101")
+		out, log, err := tweet("retweet", "101", "102")
+		if err != nil {
+			t.Fatalf("Retweet: unexpected error: %v", err)
+		}
+		if got, want := lines(out), []string{"101: already", "102: true"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Retweet output: got %q, want %q", got, want)
+		}
+		if !strings.Contains(log, "succeeded: 1, already done: 1, failed: 0") {
+			t.Errorf("Retweet summary: got %q", log)
+		}
+
+		h.mustRun("-auth-user", "alice", "-yes", "tweet", "delete", "100")
+		out, _, err = h.run("-auth-user", "alice", "-yes", "tweet", "delete", "100")
+		if err != nil {
+			t.Fatalf("Delete: unexpected error: %v", err)
+		} else if out != "100: false\n" {
+			t.Errorf("Delete output: got %q, want 100: false", out)
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		// Tweets that do not exist are failures, not changes already made.
+		out, log, err := tweet("unlike", "101", "999", "998")
+		if err == nil || !strings.Contains(err.Error(), "2 of 3 changes failed") {
+			t.Errorf("Unlike: got error %v, want 2 of 3 failed", err)
+		}
+		if got, want := lines(out), []string{"101: false", "999: failed", "998: failed"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Unlike output: got %q, want %q", got, want)
+		}
+		if !strings.Contains(log, "Tweet 999: ") || !strings.Contains(log, "already done: 0") {
+			t.Errorf("Unlike log: got %q", log)
+		}
+
+		out, log, err = tweet("like", "101", "999", "998")
+		if err == nil || !strings.Contains(err.Error(), "2 of 3 changes failed") {
+			t.Errorf("Like: got error %v, want 2 of 3 failed", err)
+		}
+		if got, want := lines(out), []string{"101: true", "999: failed", "998: failed"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Like output: got %q, want %q", got, want)
+		}
+		if !strings.Contains(log, "Tweet 999: ") || !strings.Contains(log, "failed: 2") {
+			t.Errorf("Like log: got %q", log)
+		}
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		h.srv.Fail("DELETE", "/2/users/1/likes", http.StatusTooManyRequests, 1)
+		before := h.countRequests("DELETE /2/users/1/likes/102")
+		out, log, err := tweet("unlike", "-rate-wait", "1ms", "102")
+		if err != nil {
+			t.Fatalf("Unlike: unexpected error: %v", err)
+		} else if out != "102: false\n" {
+			t.Errorf("Unlike output: got %q", out)
+		}
+		if !strings.Contains(log, "Rate limit exceeded") {
+			t.Errorf("Unlike log: got %q, want rate limit message", log)
+		}
+		if n := h.countRequests("DELETE /2/users/1/likes/102") - before; n != 2 {
+			t.Errorf("Got %d unlike requests, want 2", n)
+		}
+	})
+
+	t.Run("Pace", func(t *testing.T) {
+		start := time.Now()
+		// Tweet 100 was deleted above, so unlike one of the others twice.
+		h.mustRun("-auth-user", "alice", "tweet", "unlike", "-pace", "25ms", "101", "102", "101")
+		if d := time.Since(start); d < 50*time.Millisecond {
+			t.Errorf("Unlike of 3 tweets took %v, want at least 50ms", d)
+		}
+	})
+
+	if _, _, err := tweet("like", "-workers", "0", "100"); err == nil {
+		t.Error("Like with -workers 0: got nil error")
+	}
+	if _, _, err := tweet("like"); err == nil {
+		t.Error("Like with no IDs: got nil error")
+	}
+}
+
+func TestEngagement(t *testing.T) {
+	h := newHarness(t)
+	h.srv.AddLike("1", "101")
+	h.srv.AddLike("1", "102")
+	h.srv.AddLike("2", "101")
+	h.srv.AddRetweet("3", "101")
+	h.srv.AddTweet(&types.Tweet{ID: "110", Text: "look at this", AuthorID: "2",
+		Referenced: []*types.Ref{{Type: "quoted", ID: "100"}}})
+	h.srv.AddTweet(&types.Tweet{ID: "111", Text: "so true", AuthorID: "3",
+		Referenced: []*types.Ref{{Type: "quoted", ID: "100"}}})
+
+	t.Run("LikingUsers", func(t *testing.T) {
+		checkIDs(t, h.mustRun("tweet", "liking-users", "101"), "1", "2")
+		checkIDs(t, h.mustRun("tweet", "liking-users", "-max", "1", "101"), "1")
+		checkIDs(t, h.mustRun("tweet", "liking-users", "100"))
+
+		// The service does not paginate this listing.
+		if _, _, err := h.run("tweet", "liking-users", "-page", "1", "101"); err == nil {
+			t.Error("liking-users -page: got nil error")
+		}
+		for _, req := range h.srv.Requests() {
+			if strings.Contains(req, "/liking_users?") && strings.Contains(req, "max_results=") {
+				t.Errorf("Request sets a page size: %s", req)
+			}
+		}
+	})
+
+	t.Run("RetweetedBy", func(t *testing.T) {
+		checkIDs(t, h.mustRun("tweet", "retweeted-by", "https://twitter.com/bob/status/101"), "3")
+	})
+
+	t.Run("Quotes", func(t *testing.T) {
+		checkIDs(t, h.mustRun("tweet", "quotes", "100"), "111", "110")
+		checkIDs(t, h.mustRun("tweet", "quotes", "-max", "1", "100", "+author_id"), "111")
+		var found bool
+		for _, req := range h.srv.Requests() {
+			if strings.HasPrefix(req, "GET /2/tweets/100/quote_tweets?") && strings.Contains(req, "expansions=author_id") {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Quotes request does not include the author_id expansion")
+		}
+	})
+
+	t.Run("LikedTweets", func(t *testing.T) {
+		checkIDs(t, h.mustRun("user", "liked-tweets", "@alice"), "102", "101")
+		checkIDs(t, h.mustRun("user", "liked-tweets", "-max", "1", "@alice"), "102")
+		checkIDs(t, h.mustRun("user", "liked-tweets", "2"), "101")
+
+		// Lookup still works alongside the subcommand.
+		checkIDs(t, h.mustRun("user", "@bob"), "2")
+	})
+
+	for _, args := range [][]string{
+		{"tweet", "liking-users"},
+		{"tweet", "liking-users", "101", "102"},
+		{"tweet", "quotes", "999"},
+		{"user", "liked-tweets", "@nobody"},
+	} {
+		if _, _, err := h.run(args...); err == nil {
+			t.Errorf("Run %q: got nil error", args)
+		}
+	}
+}